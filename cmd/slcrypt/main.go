@@ -0,0 +1,215 @@
+// Command slcrypt generates keys for and decrypts the fields slcrypt encrypted in sl structured JSON logs.
+//
+// Usage:
+//
+//	slcrypt keygen
+//	slcrypt decrypt -key 2024-01=<hex or base64 key> [-key ...] [file ...]
+//
+// decrypt writes every line with its encrypted values replaced by the original values and leaves the rest of the line
+// exactly as it was. It exits with 1 if any value could not be decrypted. Logs are read from the given files or from
+// stdin when no file or "-" is given.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slcrypt"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
+	"io"
+	"os"
+	"strings"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	if len(args) == 0 {
+		fmt.Fprintln(stderr, "usage: slcrypt keygen | slcrypt decrypt -key kid=key [file ...]")
+		return 2
+	}
+
+	switch args[0] {
+	case "decrypt":
+		return runDecrypt(args[1:], stdin, stdout, stderr)
+	case "keygen":
+		return runKeygen(stdout, stderr)
+	default:
+		fmt.Fprintf(stderr, "slcrypt: unknown command %q\n", args[0])
+		return 2
+	}
+}
+
+func runKeygen(stdout, stderr io.Writer) int {
+	key, err := slcrypt.GenerateKey()
+	if err != nil {
+		fmt.Fprintf(stderr, "slcrypt: %s\n", err)
+		return 1
+	}
+
+	fmt.Fprintln(stdout, hex.EncodeToString(key))
+	return 0
+}
+
+// keyFlag collects repeated -key kid=key flags
+type keyFlag map[string][]byte
+
+func (k keyFlag) String() string {
+	kids := make([]string, 0, len(k))
+	for kid := range k {
+		kids = append(kids, kid)
+	}
+
+	return strings.Join(kids, ",")
+}
+
+func (k keyFlag) Set(value string) error {
+	kid, encoded, ok := strings.Cut(value, "=")
+	if !ok || kid == "" {
+		return errors.New("expected kid=key")
+	}
+
+	key, err := slcrypt.ParseKey(encoded)
+	if err != nil {
+		return err
+	}
+
+	k[kid] = key
+	return nil
+}
+
+func runDecrypt(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("slcrypt decrypt", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	keys := keyFlag{}
+	flags.Var(keys, "key", "a key as kid=key in hex or base64, can be repeated")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if len(keys) == 0 {
+		fmt.Fprintln(stderr, "slcrypt: at least one -key is required")
+		return 2
+	}
+
+	keyring, err := slcrypt.NewDecryptOnlyKeyring(keys)
+	if err != nil {
+		fmt.Fprintf(stderr, "slcrypt: %s\n", err)
+		return 2
+	}
+
+	inputs := flags.Args()
+	if len(inputs) == 0 {
+		inputs = []string{"-"}
+	}
+
+	out := bufio.NewWriter(stdout)
+	defer out.Flush()
+
+	status := 0
+	for _, input := range inputs {
+		failures, err := decryptInput(input, stdin, out, stderr, keyring)
+		if err != nil {
+			fmt.Fprintf(stderr, "slcrypt: %s\n", err)
+			status = 1
+		} else if failures > 0 {
+			status = 1
+		}
+	}
+
+	return status
+}
+
+// decryptInput decrypts every line of input and returns the number of lines with values it could not decrypt
+func decryptInput(input string, stdin io.Reader, out io.Writer, stderr io.Writer, keyring *slcrypt.Keyring) (int, error) {
+	reader := stdin
+	if input != "-" {
+		file, err := os.Open(input)
+		if err != nil {
+			return 0, err
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	failures := 0
+	buffered := bufio.NewReader(reader)
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := buffered.ReadBytes('\n')
+		if len(line) > 0 {
+			decrypted, decryptErr := decryptLine(line, keyring)
+			if decryptErr != nil {
+				fmt.Fprintf(stderr, "slcrypt: %s: line %d: %s\n", input, lineNumber, decryptErr)
+				failures++
+			}
+
+			if _, writeErr := out.Write(decrypted); writeErr != nil {
+				return failures, writeErr
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			return failures, nil
+		} else if err != nil {
+			return failures, fmt.Errorf("%s: %w", input, err)
+		}
+	}
+}
+
+// decryptLine replaces every encrypted value of line with its original value. Lines that are not JSON are
+// returned unchanged and values that cannot be decrypted are kept and reported.
+func decryptLine(line []byte, keyring *slcrypt.Keyring) ([]byte, error) {
+	if !bytes.Contains(line, []byte(slcrypt.Prefix)) {
+		return line, nil
+	}
+
+	var value any
+	if err := json.Unmarshal(line, &value); err != nil {
+		return line, nil
+	}
+
+	var errs []error
+	replacements := make(map[string]string)
+	walk(value, func(field, encrypted string) {
+		plain, err := keyring.Decrypt(field, encrypted)
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		replacements[encrypted] = plain
+	})
+
+	for encrypted, plain := range replacements {
+		quotedEncrypted, _ := json.Marshal(encrypted)
+		quotedPlain, _ := json.Marshal(plain)
+		line = bytes.ReplaceAll(line, quotedEncrypted, quotedPlain)
+	}
+
+	return line, errors.Join(errs...)
+}
+
+// walk calls fn for every encrypted string value in value together with the declared key it is stored under
+func walk(value any, fn func(field, encrypted string)) {
+	switch x := value.(type) {
+	case map[string]any:
+		for key, child := range x {
+			if s, ok := child.(string); ok && slcrypt.IsEncrypted(s) {
+				fn(slutil.CanonicalKey(key), s)
+				continue
+			}
+			walk(child, fn)
+		}
+	case []any:
+		for _, child := range x {
+			walk(child, fn)
+		}
+	}
+}
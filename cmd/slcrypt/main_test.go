@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slapi"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slcrypt"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	key, err := slcrypt.GenerateKey()
+	require.NoError(t, err)
+	keyring, err := slcrypt.NewKeyring("k1", map[string][]byte{"k1": key})
+	require.NoError(t, err)
+
+	slutil.Encryption = keyring
+	slutil.LogErrorChain = true
+	defer func() {
+		slutil.Encryption = nil
+		slutil.LogErrorChain = false
+	}()
+
+	var logs bytes.Buffer
+	logger := zerolog.New(&logs)
+	inner := &slapi.APIError{OwnerID: "user-2", StatusCode: 404}
+	logger.Error().Object(slutil.ZLObjectKey, &slapi.APIError{CallerID: "admin-1", OwnerID: "user-1", StatusCode: 500, InnerError: inner}).Send()
+	logger.Info().Msg("plain line")
+	logs.WriteString("not json enc:k1:abc\n")
+
+	path := filepath.Join(t.TempDir(), "app.log")
+	require.NoError(t, os.WriteFile(path, logs.Bytes(), 0o600))
+	require.NotContains(t, logs.String(), "user-1")
+
+	t.Run("decrypts every encrypted field", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 0, run([]string{"decrypt", "-key", "k1=" + hex.EncodeToString(key), path}, nil, &stdout, &stderr))
+
+		lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+		require.Len(t, lines, 3)
+		assert.Contains(t, lines[0], `"ownerId":"user-1"`)
+		assert.Contains(t, lines[0], `"callerId":"admin-1"`)
+		assert.Contains(t, lines[0], `"ownerId":"user-2"`, "chain links are decrypted as well")
+		assert.NotContains(t, lines[0], slcrypt.Prefix)
+		assert.Equal(t, `{"level":"info","message":"plain line"}`, lines[1])
+		assert.Equal(t, "not json enc:k1:abc", lines[2])
+		assert.Empty(t, stderr.String())
+	})
+
+	t.Run("wrong keys are reported", func(t *testing.T) {
+		otherKey, err := slcrypt.GenerateKey()
+		require.NoError(t, err)
+
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 1, run([]string{"decrypt", "-key", "k1=" + hex.EncodeToString(otherKey)}, bytes.NewReader(logs.Bytes()), &stdout, &stderr))
+		assert.Equal(t, logs.String(), stdout.String())
+		assert.Contains(t, stderr.String(), "slcrypt: -: line 1: could not decrypt")
+	})
+
+	t.Run("keygen", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 0, run([]string{"keygen"}, nil, &stdout, &stderr))
+
+		generated, err := slcrypt.ParseKey(stdout.String())
+		require.NoError(t, err)
+		assert.Len(t, generated, 32)
+	})
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 2, run(nil, nil, &stdout, &stderr))
+		assert.Equal(t, 2, run([]string{"encrypt"}, nil, &stdout, &stderr))
+		assert.Equal(t, 2, run([]string{"decrypt"}, nil, &stdout, &stderr))
+		assert.Equal(t, 2, run([]string{"decrypt", "-key", "k1"}, nil, &stdout, &stderr))
+		assert.Equal(t, 2, run([]string{"decrypt", "-key", fmt.Sprintf("k1=%x", make([]byte, 5))}, nil, &stdout, &stderr))
+		assert.Equal(t, 1, run([]string{"decrypt", "-key", "k1=" + hex.EncodeToString(key), filepath.Join(t.TempDir(), "missing.log")}, nil, &stdout, &stderr))
+	})
+}
@@ -0,0 +1,284 @@
+// Command slq queries sl structured JSON logs.
+//
+// Usage:
+//
+//	slq [flags] [file ...]
+//
+// Logs are read from the given files or from stdin when no file or "-" is given. Every flag narrows the
+// selection and comma separated flag values match if any of the values matches, for example:
+//
+//	slq -status 503 -request req-123 api.log
+//	slq -type "Duplicate Entry" -table users -format csv db.log
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/seantcanavan/zerolog-json-structured-logs/sldb"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slread"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const formatCSV = "csv"
+const formatJSON = "json"
+const formatTable = "table"
+
+var columns = []string{"time", "level", "kind", "status", "dbType", "table", "package", "function", "line", "requestId", "ownerId", "message"}
+
+// now is replaced in tests to make relative time ranges deterministic
+var now = time.Now
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("slq", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	format := flags.String("format", formatTable, "output format: table, json or csv")
+	levels := flags.String("level", "", "comma separated log levels")
+	since := flags.String("since", "", "only records at or after this RFC3339 time or duration ago such as 15m")
+	until := flags.String("until", "", "only records before this RFC3339 time or duration ago such as 15m")
+	statusCodes := flags.String("status", "", "comma separated APIError status codes")
+	dbTypes := flags.String("type", "", "comma separated DatabaseError types such as \"Duplicate Entry\"")
+	tables := flags.String("table", "", "comma separated DatabaseError table names")
+	packages := flags.String("package", "", "comma separated package names of the logged ExecContext")
+	functions := flags.String("function", "", "comma separated function names of the logged ExecContext")
+	requestIDs := flags.String("request", "", "comma separated request IDs")
+	ownerIDs := flags.String("owner", "", "comma separated owner IDs")
+	services := flags.String("service", "", "comma separated service names")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	filter := slread.Filter{
+		Functions:  splitList(*functions),
+		Levels:     splitList(*levels),
+		OwnerIDs:   splitList(*ownerIDs),
+		Packages:   splitList(*packages),
+		RequestIDs: splitList(*requestIDs),
+		Services:   splitList(*services),
+		Tables:     splitList(*tables),
+	}
+
+	for _, dbType := range splitList(*dbTypes) {
+		filter.DBTypes = append(filter.DBTypes, sldb.EnumDBErrorType(dbType))
+	}
+
+	var err error
+	for _, statusCode := range splitList(*statusCodes) {
+		var code int
+		if code, err = strconv.Atoi(statusCode); err != nil {
+			fmt.Fprintf(stderr, "slq: invalid status code %q\n", statusCode)
+			return 2
+		}
+		filter.StatusCodes = append(filter.StatusCodes, code)
+	}
+
+	if filter.Since, err = parseTimeFlag(*since); err != nil {
+		fmt.Fprintf(stderr, "slq: invalid -since: %s\n", err)
+		return 2
+	}
+
+	if filter.Until, err = parseTimeFlag(*until); err != nil {
+		fmt.Fprintf(stderr, "slq: invalid -until: %s\n", err)
+		return 2
+	}
+
+	writer, err := newRecordWriter(*format, stdout)
+	if err != nil {
+		fmt.Fprintf(stderr, "slq: %s\n", err)
+		return 2
+	}
+
+	inputs := flags.Args()
+	if len(inputs) == 0 {
+		inputs = []string{"-"}
+	}
+
+	status := 0
+	for _, input := range inputs {
+		if err = query(input, stdin, filter, writer, stderr); err != nil {
+			fmt.Fprintf(stderr, "slq: %s\n", err)
+			status = 1
+		}
+	}
+
+	if err = writer.Flush(); err != nil {
+		fmt.Fprintf(stderr, "slq: %s\n", err)
+		return 1
+	}
+
+	return status
+}
+
+func query(input string, stdin io.Reader, filter slread.Filter, writer recordWriter, stderr io.Writer) error {
+	reader := stdin
+	if input != "-" {
+		file, err := os.Open(input)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	decoder := slread.NewDecoder(reader)
+	for {
+		record, err := decoder.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		var lineErr *slread.LineError
+		if errors.As(err, &lineErr) {
+			fmt.Fprintf(stderr, "slq: %s: skipping %s\n", input, lineErr)
+			continue
+		} else if err != nil {
+			return fmt.Errorf("%s: %w", input, err)
+		}
+
+		if record.Kind == slread.KindNone || !filter.Match(record) {
+			continue
+		}
+
+		if err = writer.Write(record); err != nil {
+			return err
+		}
+	}
+}
+
+func parseTimeFlag(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	if ago, err := time.ParseDuration(value); err == nil {
+		return now().Add(-ago), nil
+	}
+
+	return time.Parse(time.RFC3339Nano, value)
+}
+
+func splitList(value string) []string {
+	var res []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
+	}
+
+	return res
+}
+
+type recordWriter interface {
+	Write(record *slread.Record) error
+	Flush() error
+}
+
+func newRecordWriter(format string, w io.Writer) (recordWriter, error) {
+	switch format {
+	case formatTable:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(columns, "\t")))
+		return &tableWriter{tw: tw}, nil
+	case formatJSON:
+		return &jsonWriter{w: w}, nil
+	case formatCSV:
+		cw := csv.NewWriter(w)
+		return &csvWriter{cw: cw}, cw.Write(columns)
+	default:
+		return nil, fmt.Errorf("unknown format %q", format)
+	}
+}
+
+type tableWriter struct {
+	tw *tabwriter.Writer
+}
+
+func (t *tableWriter) Write(record *slread.Record) error {
+	values := rowValues(record)
+	for i, value := range values {
+		values[i] = strings.NewReplacer("\t", " ", "\n", " ").Replace(value)
+	}
+
+	_, err := fmt.Fprintln(t.tw, strings.Join(values, "\t"))
+	return err
+}
+
+func (t *tableWriter) Flush() error {
+	return t.tw.Flush()
+}
+
+type jsonWriter struct {
+	w io.Writer
+}
+
+func (j *jsonWriter) Write(record *slread.Record) error {
+	_, err := fmt.Fprintf(j.w, "%s\n", record.Raw)
+	return err
+}
+
+func (j *jsonWriter) Flush() error {
+	return nil
+}
+
+type csvWriter struct {
+	cw *csv.Writer
+}
+
+func (c *csvWriter) Write(record *slread.Record) error {
+	return c.cw.Write(rowValues(record))
+}
+
+func (c *csvWriter) Flush() error {
+	c.cw.Flush()
+	return c.cw.Error()
+}
+
+// rowValues returns the values of record in the order of columns
+func rowValues(record *slread.Record) []string {
+	var dbType, table string
+	if dbErrs := record.DatabaseErrors(); len(dbErrs) > 0 {
+		dbType, table = dbErrs[0].Type.String(), dbErrs[0].TableName
+	}
+
+	var status, message string
+	switch record.Kind {
+	case slread.KindAPI:
+		status, message = strconv.Itoa(record.API.StatusCode), record.API.Message
+	case slread.KindDB:
+		message = record.DB.Message
+	}
+
+	var timestamp string
+	if !record.Time.IsZero() {
+		timestamp = record.Time.Format(time.RFC3339Nano)
+	}
+
+	execCtx := record.ExecContext()
+
+	return []string{
+		timestamp,
+		record.Level,
+		record.Kind.String(),
+		status,
+		dbType,
+		table,
+		execCtx.Package,
+		execCtx.Function,
+		strconv.Itoa(execCtx.Line),
+		record.RequestID(),
+		record.OwnerID(),
+		message,
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"github.com/rs/zerolog"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slapi"
+	"github.com/seantcanavan/zerolog-json-structured-logs/sldb"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testStart = time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func writeQueryLogs(t *testing.T) string {
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+
+	for i, statusCode := range []int{503, 404, 503} {
+		apiErr := &slapi.APIError{
+			ExecContext: slutil.ExecContext{Function: "GetUser", Line: 42, Package: "api"},
+			InnerError:  errors.New("boom"),
+			Message:     "could not get user",
+			OwnerID:     "owner-1",
+			RequestID:   []string{"req-1", "req-2", "req-3"}[i],
+			StatusCode:  statusCode,
+		}
+		logger.Error().Time(zerolog.TimestampFieldName, testStart.Add(time.Duration(i)*time.Minute)).Object(slutil.ZLObjectKey, apiErr).Send()
+	}
+
+	dbErr := &sldb.DatabaseError{Message: "dupe", TableName: "users", Type: sldb.ErrDBDuplicateEntry}
+	logger.Error().Time(zerolog.TimestampFieldName, testStart).Object(slutil.ZLObjectKey, dbErr).Send()
+	logger.Info().Msg("no sl object")
+	buf.WriteString("{broken\n")
+
+	path := filepath.Join(t.TempDir(), "api.log")
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o600))
+
+	return path
+}
+
+func TestRun(t *testing.T) {
+	path := writeQueryLogs(t)
+
+	t.Run("table output filtered by status code", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 0, run([]string{"-status", "503", path}, nil, &stdout, &stderr))
+
+		lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+		require.Len(t, lines, 3)
+		assert.True(t, strings.HasPrefix(lines[0], "TIME"))
+		assert.Contains(t, lines[1], "req-1")
+		assert.Contains(t, lines[2], "req-3")
+		assert.Contains(t, stderr.String(), "skipping line 6")
+	})
+
+	t.Run("json output filtered by request id", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 0, run([]string{"-format", "json", "-status", "503", "-request", "req-3", path}, nil, &stdout, &stderr))
+
+		lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+		require.Len(t, lines, 1)
+		assert.Contains(t, lines[0], `"requestId":"req-3"`)
+	})
+
+	t.Run("csv output filtered by db type and table from stdin", func(t *testing.T) {
+		input, err := os.Open(path)
+		require.NoError(t, err)
+		defer input.Close()
+
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 0, run([]string{"-format", "csv", "-type", "Duplicate Entry", "-table", "users"}, input, &stdout, &stderr))
+
+		rows, err := csv.NewReader(&stdout).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, rows, 2)
+		assert.Equal(t, columns, rows[0])
+		assert.Equal(t, "db", rows[1][2])
+		assert.Equal(t, "Duplicate Entry", rows[1][4])
+		assert.Equal(t, "users", rows[1][5])
+	})
+
+	t.Run("relative time range", func(t *testing.T) {
+		now = func() time.Time { return testStart.Add(3 * time.Minute) }
+		defer func() { now = time.Now }()
+
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 0, run([]string{"-format", "json", "-since", "2m30s", "-until", testStart.Add(2 * time.Minute).Format(time.RFC3339), path}, nil, &stdout, &stderr))
+		require.Equal(t, 1, strings.Count(stdout.String(), "\n"))
+		assert.Contains(t, stdout.String(), `"requestId":"req-2"`)
+
+		stdout.Reset()
+		assert.Equal(t, 0, run([]string{"-format", "json", "-since", "2m30s", "-function", "GetUser", path}, nil, &stdout, &stderr))
+		assert.Equal(t, 2, strings.Count(stdout.String(), "\n"))
+
+		stdout.Reset()
+		assert.Equal(t, 0, run([]string{"-format", "json", "-since", "3m", "-function", "GetUser", path}, nil, &stdout, &stderr))
+		assert.Equal(t, 3, strings.Count(stdout.String(), "\n"))
+	})
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 2, run([]string{"-format", "xml", path}, nil, &stdout, &stderr))
+		assert.Equal(t, 2, run([]string{"-status", "abc", path}, nil, &stdout, &stderr))
+		assert.Equal(t, 2, run([]string{"-since", "yesterday", path}, nil, &stdout, &stderr))
+		assert.Equal(t, 1, run([]string{filepath.Join(t.TempDir(), "missing.log")}, nil, &stdout, &stderr))
+	})
+}
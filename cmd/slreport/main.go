@@ -0,0 +1,106 @@
+// Command slreport summarizes sl structured JSON logs by grouping errors on their fingerprint.
+//
+// Usage:
+//
+//	slreport [-top 20] [-format text|markdown] [-buckets 24] [file ...]
+//
+// Logs are read from the given files or from stdin when no file or "-" is given. Every group lists its count,
+// when it was first and last seen, its status codes and database error types, example request IDs,
+// the function it originated from and a histogram of its occurrences over the time range of the logs.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slread"
+	"io"
+	"os"
+)
+
+const formatMarkdown = "markdown"
+const formatText = "text"
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("slreport", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	buckets := flags.Int("buckets", 24, "number of histogram buckets")
+	format := flags.String("format", formatText, "output format: text or markdown")
+	top := flags.Int("top", 20, "number of groups to report, 0 for all")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *format != formatText && *format != formatMarkdown {
+		fmt.Fprintf(stderr, "slreport: unknown format %q\n", *format)
+		return 2
+	}
+
+	if *buckets < 1 {
+		fmt.Fprintln(stderr, "slreport: -buckets must be at least 1")
+		return 2
+	}
+
+	inputs := flags.Args()
+	if len(inputs) == 0 {
+		inputs = []string{"-"}
+	}
+
+	rep := newReport()
+	status := 0
+	for _, input := range inputs {
+		if err := collect(input, stdin, rep, stderr); err != nil {
+			fmt.Fprintf(stderr, "slreport: %s\n", err)
+			status = 1
+		}
+	}
+
+	groups := rep.top(*top)
+	if *format == formatMarkdown {
+		writeMarkdown(stdout, rep, groups, *buckets)
+	} else {
+		writeText(stdout, rep, groups, *buckets)
+	}
+
+	return status
+}
+
+func collect(input string, stdin io.Reader, rep *report, stderr io.Writer) error {
+	reader := stdin
+	if input != "-" {
+		file, err := os.Open(input)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	decoder := slread.NewDecoder(reader)
+	for {
+		record, err := decoder.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		var lineErr *slread.LineError
+		if errors.As(err, &lineErr) {
+			fmt.Fprintf(stderr, "slreport: %s: skipping %s\n", input, lineErr)
+			continue
+		} else if err != nil {
+			return fmt.Errorf("%s: %w", input, err)
+		}
+
+		if record.Kind == slread.KindNone {
+			continue
+		}
+
+		rep.add(record)
+	}
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"fmt"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slread"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+const maxExampleRequestIDs = 3
+
+var sparkBars = []rune("▁▂▃▄▅▆▇█")
+
+// group aggregates every record sharing a fingerprint
+type group struct {
+	count       int
+	dbTypes     map[string]int
+	example     *slread.Record
+	fingerprint string
+	firstSeen   time.Time
+	lastSeen    time.Time
+	requestIDs  []string
+	statusCodes map[int]int
+	times       []time.Time
+}
+
+func (g *group) add(record *slread.Record) {
+	g.count++
+
+	// records logged without a timestamp are counted but have no place in time
+	if !record.Time.IsZero() {
+		g.times = append(g.times, record.Time)
+
+		if g.firstSeen.IsZero() || record.Time.Before(g.firstSeen) {
+			g.firstSeen = record.Time
+		}
+
+		if record.Time.After(g.lastSeen) {
+			g.lastSeen = record.Time
+		}
+	}
+
+	if statusCode := record.StatusCode(); statusCode != 0 {
+		g.statusCodes[statusCode]++
+	}
+
+	for _, dbErr := range record.DatabaseErrors() {
+		g.dbTypes[dbErr.Type.String()]++
+	}
+
+	if requestID := record.RequestID(); requestID != "" && len(g.requestIDs) < maxExampleRequestIDs && !contains(g.requestIDs, requestID) {
+		g.requestIDs = append(g.requestIDs, requestID)
+	}
+}
+
+func (g *group) origin() string {
+	execCtx := g.example.ExecContext()
+	if execCtx.Function == "" {
+		return "unknown"
+	}
+
+	return fmt.Sprintf("%s.%s:%d", execCtx.Package, execCtx.Function, execCtx.Line)
+}
+
+func (g *group) message() string {
+	if apiErr := g.example.API; apiErr != nil {
+		return apiErr.Message
+	}
+
+	if dbErr := g.example.DB; dbErr != nil {
+		return dbErr.Message
+	}
+
+	return g.example.Message
+}
+
+// report groups records by fingerprint
+type report struct {
+	byFingerprint map[string]*group
+	end           time.Time
+	start         time.Time
+	total         int
+}
+
+func newReport() *report {
+	return &report{byFingerprint: make(map[string]*group)}
+}
+
+func (r *report) add(record *slread.Record) {
+	fingerprint := record.Fingerprint()
+	if fingerprint == "" {
+		return
+	}
+
+	g, ok := r.byFingerprint[fingerprint]
+	if !ok {
+		g = &group{
+			dbTypes:     make(map[string]int),
+			example:     record,
+			fingerprint: fingerprint,
+			statusCodes: make(map[int]int),
+		}
+		r.byFingerprint[fingerprint] = g
+	}
+
+	g.add(record)
+	r.total++
+
+	if record.Time.IsZero() {
+		return
+	}
+
+	if r.start.IsZero() || record.Time.Before(r.start) {
+		r.start = record.Time
+	}
+
+	if record.Time.After(r.end) {
+		r.end = record.Time
+	}
+}
+
+// top returns the n largest groups ordered by count, most recently seen first for equal counts
+func (r *report) top(n int) []*group {
+	groups := make([]*group, 0, len(r.byFingerprint))
+	for _, g := range r.byFingerprint {
+		groups = append(groups, g)
+	}
+
+	sort.Slice(groups, func(i, j int) bool {
+		if groups[i].count != groups[j].count {
+			return groups[i].count > groups[j].count
+		}
+		if !groups[i].lastSeen.Equal(groups[j].lastSeen) {
+			return groups[i].lastSeen.After(groups[j].lastSeen)
+		}
+		return groups[i].fingerprint < groups[j].fingerprint
+	})
+
+	if n > 0 && len(groups) > n {
+		groups = groups[:n]
+	}
+
+	return groups
+}
+
+// histogram counts the timestamped occurrences of g in buckets evenly spread over the time range of the whole report
+func (r *report) histogram(g *group, buckets int) []int {
+	counts := make([]int, buckets)
+	span := r.end.Sub(r.start)
+	for _, t := range g.times {
+		if t.IsZero() {
+			continue
+		}
+
+		bucket := 0
+		if span > 0 {
+			bucket = int(float64(t.Sub(r.start)) / float64(span) * float64(buckets))
+		}
+		bucket = max(0, min(bucket, buckets-1))
+		counts[bucket]++
+	}
+
+	return counts
+}
+
+func sparkline(counts []int) string {
+	highest := 0
+	for _, count := range counts {
+		if count > highest {
+			highest = count
+		}
+	}
+
+	var sb strings.Builder
+	for _, count := range counts {
+		if count == 0 {
+			sb.WriteRune(' ')
+			continue
+		}
+		sb.WriteRune(sparkBars[(count*len(sparkBars)-1)/highest])
+	}
+
+	return sb.String()
+}
+
+func writeText(w io.Writer, r *report, groups []*group, buckets int) {
+	fmt.Fprintf(w, "%d errors in %d groups from %s to %s\n", r.total, len(r.byFingerprint), formatTime(r.start), formatTime(r.end))
+
+	for i, g := range groups {
+		fmt.Fprintf(w, "\n#%d %s  %d occurrences\n", i+1, g.fingerprint, g.count)
+		fmt.Fprintf(w, "  kind:        %s\n", g.example.Kind)
+		fmt.Fprintf(w, "  message:     %s\n", g.message())
+		fmt.Fprintf(w, "  origin:      %s\n", g.origin())
+		fmt.Fprintf(w, "  first seen:  %s\n", formatTime(g.firstSeen))
+		fmt.Fprintf(w, "  last seen:   %s\n", formatTime(g.lastSeen))
+		if len(g.statusCodes) > 0 {
+			fmt.Fprintf(w, "  status:      %s\n", formatIntCounts(g.statusCodes))
+		}
+		if len(g.dbTypes) > 0 {
+			fmt.Fprintf(w, "  db types:    %s\n", formatStringCounts(g.dbTypes))
+		}
+		if len(g.requestIDs) > 0 {
+			fmt.Fprintf(w, "  requests:    %s\n", strings.Join(g.requestIDs, ", "))
+		}
+		fmt.Fprintf(w, "  histogram:   |%s|\n", sparkline(r.histogram(g, buckets)))
+	}
+}
+
+func writeMarkdown(w io.Writer, r *report, groups []*group, buckets int) {
+	fmt.Fprintf(w, "# Error report\n\n%d errors in %d groups from %s to %s\n\n", r.total, len(r.byFingerprint), formatTime(r.start), formatTime(r.end))
+	fmt.Fprintln(w, "| # | Fingerprint | Count | Kind | Message | Origin | First seen | Last seen | Status codes | DB types | Example requests | Histogram |")
+	fmt.Fprintln(w, "|---|---|---|---|---|---|---|---|---|---|---|---|")
+
+	for i, g := range groups {
+		fmt.Fprintf(w, "| %d | `%s` | %d | %s | %s | `%s` | %s | %s | %s | %s | %s | `%s` |\n",
+			i+1,
+			g.fingerprint,
+			g.count,
+			g.example.Kind,
+			escapeMarkdown(g.message()),
+			g.origin(),
+			formatTime(g.firstSeen),
+			formatTime(g.lastSeen),
+			formatIntCounts(g.statusCodes),
+			escapeMarkdown(formatStringCounts(g.dbTypes)),
+			escapeMarkdown(strings.Join(g.requestIDs, ", ")),
+			sparkline(r.histogram(g, buckets)),
+		)
+	}
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
+
+func formatIntCounts(counts map[int]int) string {
+	keys := make([]int, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Ints(keys)
+
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = fmt.Sprintf("%d×%d", key, counts[key])
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+func formatStringCounts(counts map[string]int) string {
+	keys := make([]string, 0, len(counts))
+	for key := range counts {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = fmt.Sprintf("%s×%d", key, counts[key])
+	}
+
+	return strings.Join(parts, ", ")
+}
+
+func escapeMarkdown(value string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(value)
+}
+
+func contains(values []string, value string) bool {
+	for _, current := range values {
+		if current == value {
+			return true
+		}
+	}
+
+	return false
+}
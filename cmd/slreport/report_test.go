@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slapi"
+	"github.com/seantcanavan/zerolog-json-structured-logs/sldb"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slread"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testStart = time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func writeReportLogs(t *testing.T) string {
+	slutil.LogErrorChain = true
+	defer func() { slutil.LogErrorChain = false }()
+
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+
+	// five occurrences of the same failure for different users spread over the first hour
+	for i := 0; i < 5; i++ {
+		dbErr := &sldb.DatabaseError{
+			ExecContext: slutil.ExecContext{Function: "FindUser", Line: 12, Package: "repo"},
+			InnerError:  errors.New("connection refused"),
+			Message:     fmt.Sprintf("could not load user %d", i),
+			TableName:   "users",
+			Type:        sldb.ErrDBConnectionFailed,
+		}
+		apiErr := &slapi.APIError{
+			ExecContext: slutil.ExecContext{Function: "GetUser", Line: 42, Package: "api"},
+			InnerError:  dbErr,
+			Message:     fmt.Sprintf("could not get user %d", i),
+			RequestID:   fmt.Sprintf("req-%d", i),
+			StatusCode:  503,
+		}
+		logger.Error().Time(zerolog.TimestampFieldName, testStart.Add(time.Duration(i)*15*time.Minute)).Object(slutil.ZLObjectKey, apiErr).Send()
+	}
+
+	// a single unrelated failure at the end of the second hour
+	dbErr := &sldb.DatabaseError{
+		ExecContext: slutil.ExecContext{Function: "InsertOrder", Line: 7, Package: "repo"},
+		InnerError:  errors.New("duplicate key"),
+		Message:     "order exists",
+		TableName:   "orders",
+		Type:        sldb.ErrDBDuplicateEntry,
+	}
+	logger.Error().Time(zerolog.TimestampFieldName, testStart.Add(2*time.Hour)).Object(slutil.ZLObjectKey, dbErr).Send()
+	logger.Info().Msg("no sl object")
+	buf.WriteString("{broken\n")
+
+	path := filepath.Join(t.TempDir(), "errors.log")
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o600))
+
+	return path
+}
+
+func TestReport(t *testing.T) {
+	file, err := os.Open(writeReportLogs(t))
+	require.NoError(t, err)
+	defer file.Close()
+
+	records, err := slread.ReadAll(file)
+	require.Error(t, err)
+
+	rep := newReport()
+	for _, record := range records {
+		if record.Kind != slread.KindNone {
+			rep.add(record)
+		}
+	}
+
+	groups := rep.top(0)
+	require.Len(t, groups, 2)
+	assert.Equal(t, 6, rep.total)
+
+	userGroup := groups[0]
+	assert.Equal(t, 5, userGroup.count)
+	assert.Equal(t, testStart, userGroup.firstSeen)
+	assert.Equal(t, testStart.Add(time.Hour), userGroup.lastSeen)
+	assert.Equal(t, map[int]int{503: 5}, userGroup.statusCodes)
+	assert.Equal(t, map[string]int{sldb.ErrDBConnectionFailed.String(): 5}, userGroup.dbTypes)
+	assert.Equal(t, []string{"req-0", "req-1", "req-2"}, userGroup.requestIDs)
+	assert.Equal(t, "api.GetUser:42", userGroup.origin())
+	assert.Equal(t, []int{1, 1, 1, 1, 1, 0, 0, 0}, rep.histogram(userGroup, 8))
+
+	orderGroup := groups[1]
+	assert.Equal(t, 1, orderGroup.count)
+	assert.Equal(t, "repo.InsertOrder:7", orderGroup.origin())
+	assert.Equal(t, "order exists", orderGroup.message())
+	assert.Equal(t, []int{0, 0, 0, 1}, rep.histogram(orderGroup, 4))
+
+	assert.Len(t, rep.top(1), 1)
+}
+
+func TestSparkline(t *testing.T) {
+	assert.Equal(t, "▁ █▄", sparkline([]int{1, 0, 8, 4}))
+	assert.Equal(t, "  ", sparkline([]int{0, 0}))
+}
+
+func TestRun(t *testing.T) {
+	path := writeReportLogs(t)
+
+	t.Run("text report", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 0, run([]string{"-buckets", "4", path}, nil, &stdout, &stderr))
+
+		output := stdout.String()
+		assert.True(t, strings.HasPrefix(output, "6 errors in 2 groups from 2023-05-01T12:00:00Z to 2023-05-01T14:00:00Z"))
+		assert.Contains(t, output, "#1 ")
+		assert.Contains(t, output, "5 occurrences")
+		assert.Contains(t, output, "origin:      api.GetUser:42")
+		assert.Contains(t, output, "status:      503×5")
+		assert.Contains(t, output, "db types:    Connection Failed×5")
+		assert.Contains(t, output, "requests:    req-0, req-1, req-2")
+		assert.Contains(t, output, "#2 ")
+		assert.Contains(t, stderr.String(), "skipping line 8")
+	})
+
+	t.Run("markdown report of the top group from stdin", func(t *testing.T) {
+		input, err := os.Open(path)
+		require.NoError(t, err)
+		defer input.Close()
+
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 0, run([]string{"-format", "markdown", "-top", "1"}, input, &stdout, &stderr))
+
+		lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+		require.Len(t, lines, 7)
+		assert.Equal(t, "# Error report", lines[0])
+		assert.True(t, strings.HasPrefix(lines[5], "|---"))
+		assert.Contains(t, lines[6], "| 5 | api |")
+		assert.Contains(t, lines[6], "`api.GetUser:42`")
+	})
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 2, run([]string{"-format", "html", path}, nil, &stdout, &stderr))
+		assert.Equal(t, 2, run([]string{"-buckets", "0", path}, nil, &stdout, &stderr))
+		assert.Equal(t, 1, run([]string{filepath.Join(t.TempDir(), "missing.log")}, nil, &stdout, &stderr))
+	})
+}
+
+func TestRun_MissingTimestamps(t *testing.T) {
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+
+	apiErr := &slapi.APIError{Message: "could not get user", StatusCode: 503}
+	logger.Error().Object(slutil.ZLObjectKey, apiErr).Send()
+	logger.Error().Time(zerolog.TimestampFieldName, testStart).Object(slutil.ZLObjectKey, apiErr).Send()
+	logger.Error().Object(slutil.ZLObjectKey, apiErr).Send()
+	logger.Error().Time(zerolog.TimestampFieldName, testStart.Add(time.Hour)).Object(slutil.ZLObjectKey, apiErr).Send()
+
+	records, err := slread.ReadAll(bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+
+	rep := newReport()
+	for _, record := range records {
+		rep.add(record)
+	}
+
+	groups := rep.top(0)
+	require.Len(t, groups, 1)
+	assert.Equal(t, 4, groups[0].count)
+	assert.Equal(t, testStart, groups[0].firstSeen)
+	assert.Equal(t, testStart.Add(time.Hour), groups[0].lastSeen)
+	assert.Equal(t, testStart, rep.start)
+	assert.Equal(t, []int{1, 0, 0, 1}, rep.histogram(groups[0], 4))
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 0, run(nil, bytes.NewReader(buf.Bytes()), &stdout, &stderr))
+	assert.True(t, strings.HasPrefix(stdout.String(), "4 errors in 1 groups from 2023-05-01T12:00:00Z to 2023-05-01T13:00:00Z"))
+
+	// only records without a timestamp
+	stdout.Reset()
+	lines := strings.SplitAfter(buf.String(), "\n")
+	assert.Equal(t, 0, run(nil, strings.NewReader(lines[0]+lines[2]), &stdout, &stderr))
+	assert.True(t, strings.HasPrefix(stdout.String(), "2 errors in 1 groups from - to -"))
+}
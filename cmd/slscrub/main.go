@@ -0,0 +1,389 @@
+// Command slscrub removes the records of users from sl structured JSON logs, e.g. to honor a right to be forgotten.
+//
+// Usage:
+//
+//	slscrub [-id user-1 ...] [-ids-file ids.txt] [-mode replace|drop] [-replacement text] [-pseudonym-key key]
+//		[-dry-run] [file ...]
+//
+// Every line with an ownerId or callerId, at any depth including the error chain, matching one of the identifiers is
+// either dropped or has the identifiers replaced in its ID fields and, where they appear as a whole token, in its
+// messages and request params. Keys, timestamps and every other field are left as they are.
+// Identifiers are replaced with -replacement or, when -pseudonym-key is given, with a keyed pseudonym so the lines of
+// one user can still be correlated. Values encrypted by slcrypt cannot be matched and have to be decrypted first.
+//
+// Files, gzip compressed or not, are rewritten in place. Every file is written to a temporary file next to it which
+// is read back and verified before it replaces the original, so a file is either scrubbed completely or not at all.
+// Logs are read from stdin and written to stdout when no file or "-" is given. A summary of every file is written to
+// stdout, or to stderr when reading stdin. slscrub exits with 1 if any file could not be scrubbed or verified.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slcrypt"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slredact"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+)
+
+const modeDrop = "drop"
+const modeReplace = "replace"
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// idsFlag collects repeated -id flags
+type idsFlag []string
+
+func (i *idsFlag) String() string {
+	return strings.Join(*i, ",")
+}
+
+func (i *idsFlag) Set(value string) error {
+	*i = append(*i, value)
+	return nil
+}
+
+// stats are the counts slscrub reports for every input
+type stats struct {
+	input     string
+	lines     int
+	matched   int
+	dropped   int
+	rewritten int
+	invalid   int
+	remaining int // lines with a matching ID field after scrubbing, must be 0
+	mentions  int // lines still containing an identifier outside the ID fields
+	err       error
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("slscrub", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	var ids idsFlag
+	flags.Var(&ids, "id", "an identifier to scrub, can be repeated")
+	dryRun := flags.Bool("dry-run", false, "report what would be scrubbed without writing anything")
+	idsFile := flags.String("ids-file", "", "a file with one identifier to scrub per line")
+	mode := flags.String("mode", modeReplace, "what to do with matching lines: replace or drop")
+	pseudonymKey := flags.String("pseudonym-key", "", "replace identifiers with keyed pseudonyms, the key in hex or base64")
+	replacement := flags.String("replacement", DefaultReplacement, "the text replacing identifiers")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	if *mode != modeReplace && *mode != modeDrop {
+		fmt.Fprintf(stderr, "slscrub: unknown mode %q\n", *mode)
+		return 2
+	}
+
+	if *idsFile != "" {
+		fileIDs, err := readIDs(*idsFile)
+		if err != nil {
+			fmt.Fprintf(stderr, "slscrub: %s\n", err)
+			return 2
+		}
+		ids = append(ids, fileIDs...)
+	}
+
+	if len(ids) == 0 {
+		fmt.Fprintln(stderr, "slscrub: at least one -id or an -ids-file is required")
+		return 2
+	}
+
+	replace := func(string) string { return *replacement }
+	if *pseudonymKey != "" {
+		key, err := slcrypt.ParseKey(*pseudonymKey)
+		if err != nil {
+			fmt.Fprintf(stderr, "slscrub: invalid -pseudonym-key: %s\n", err)
+			return 2
+		}
+		replace = func(id string) string { return slredact.Pseudonym(key, id) }
+	}
+
+	s := newScrubber(ids, *mode == modeDrop, replace)
+
+	inputs := flags.Args()
+	if len(inputs) == 0 {
+		inputs = []string{"-"}
+	}
+
+	summary := stdout
+	var results []stats
+	for _, input := range inputs {
+		var st stats
+		if input == "-" {
+			summary = stderr
+			st = scrubStdin(s, stdin, stdout, stderr)
+		} else {
+			st = scrubFile(s, input, *dryRun, stderr)
+		}
+
+		if st.err != nil {
+			fmt.Fprintf(stderr, "slscrub: %s\n", st.err)
+		}
+		results = append(results, st)
+	}
+
+	return writeSummary(summary, results, *dryRun)
+}
+
+func readIDs(path string) ([]string, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []string
+	for _, line := range strings.Split(string(content), "\n") {
+		if id := strings.TrimSpace(line); id != "" {
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
+
+// decompress returns a reader of the content of r, which is gunzipped if it starts with the gzip magic number
+func decompress(r io.Reader) (io.Reader, bool, error) {
+	buffered := bufio.NewReader(r)
+	magic, _ := buffered.Peek(2)
+	if !bytes.Equal(magic, []byte{0x1f, 0x8b}) {
+		return buffered, false, nil
+	}
+
+	gz, err := gzip.NewReader(buffered)
+	if err != nil {
+		return nil, true, err
+	}
+
+	return gz, true, nil
+}
+
+func scrubStdin(s *scrubber, stdin io.Reader, stdout, stderr io.Writer) stats {
+	st := stats{input: "-"}
+
+	reader, compressed, err := decompress(stdin)
+	if err != nil {
+		st.err = fmt.Errorf("-: %w", err)
+		return st
+	}
+
+	out := bufio.NewWriter(stdout)
+	var w io.Writer = out
+	var gz *gzip.Writer
+	if compressed {
+		gz = gzip.NewWriter(out)
+		w = gz
+	}
+
+	st.err = scrub(s, "-", reader, w, &st, stderr)
+	if gz != nil {
+		st.err = errors.Join(st.err, gz.Close())
+	}
+	st.err = errors.Join(st.err, out.Flush())
+
+	return st
+}
+
+// scrubFile scrubs path in place. The scrubbed content is written to a temporary file in the same directory which
+// replaces path only once it has been verified.
+func scrubFile(s *scrubber, path string, dryRun bool, stderr io.Writer) (st stats) {
+	st.input = path
+
+	file, err := os.Open(path)
+	if err != nil {
+		st.err = err
+		return st
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		st.err = err
+		return st
+	}
+
+	reader, compressed, err := decompress(file)
+	if err != nil {
+		st.err = fmt.Errorf("%s: %w", path, err)
+		return st
+	}
+
+	if dryRun {
+		st.err = scrub(s, path, reader, io.Discard, &st, stderr)
+		return st
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.slscrub")
+	if err != nil {
+		st.err = err
+		return st
+	}
+	defer func() {
+		if st.err != nil || st.matched == 0 {
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	st.err = writeScrubbed(s, path, reader, tmp, compressed, info.Mode().Perm(), &st, stderr)
+	if st.err != nil || st.matched == 0 {
+		return st
+	}
+
+	if st.err = verify(s, tmp.Name(), &st); st.err != nil {
+		return st
+	}
+
+	if err = os.Rename(tmp.Name(), path); err != nil {
+		st.err = err
+	}
+
+	return st
+}
+
+func writeScrubbed(s *scrubber, path string, reader io.Reader, tmp *os.File, compressed bool, perm os.FileMode, st *stats, stderr io.Writer) error {
+	out := bufio.NewWriter(tmp)
+	var w io.Writer = out
+	var gz *gzip.Writer
+	if compressed {
+		gz = gzip.NewWriter(out)
+		w = gz
+	}
+
+	err := scrub(s, path, reader, w, st, stderr)
+	if gz != nil {
+		err = errors.Join(err, gz.Close())
+	}
+
+	return errors.Join(err, out.Flush(), tmp.Chmod(perm), tmp.Sync(), tmp.Close())
+}
+
+// scrub copies every line of r to w scrubbed and counts what it did in st
+func scrub(s *scrubber, input string, r io.Reader, w io.Writer, st *stats, stderr io.Writer) error {
+	reader := bufio.NewReader(r)
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadBytes('\n')
+		if len(line) > 0 {
+			st.lines++
+
+			scrubbed, res := s.scrubLine(line)
+			switch res {
+			case resultDropped:
+				st.matched++
+				st.dropped++
+			case resultRewritten:
+				st.matched++
+				st.rewritten++
+			case resultInvalid:
+				st.invalid++
+				fmt.Fprintf(stderr, "slscrub: %s: line %d is not JSON and was left unchanged\n", input, lineNumber)
+			}
+
+			if scrubbed != nil {
+				st.count(s, scrubbed)
+				if _, writeErr := w.Write(scrubbed); writeErr != nil {
+					return writeErr
+				}
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("%s: %w", input, err)
+		}
+	}
+}
+
+// count counts line in remaining or mentions if it still contains an identifier
+func (st *stats) count(s *scrubber, line []byte) {
+	if !s.mentions(line) {
+		return
+	}
+
+	if _, res := s.scrubLine(line); res == resultDropped || res == resultRewritten {
+		st.remaining++
+	} else {
+		st.mentions++
+	}
+}
+
+// verify reads the scrubbed file at path back and recounts the lines still containing an identifier
+func verify(s *scrubber, path string, st *stats) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader, _, err := decompress(file)
+	if err != nil {
+		return fmt.Errorf("could not verify %s: %w", st.input, err)
+	}
+
+	st.remaining, st.mentions = 0, 0
+	buffered := bufio.NewReader(reader)
+	for {
+		line, err := buffered.ReadBytes('\n')
+		if len(line) > 0 {
+			st.count(s, line)
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		} else if err != nil {
+			return fmt.Errorf("could not verify %s: %w", st.input, err)
+		}
+	}
+
+	if st.remaining > 0 {
+		return fmt.Errorf("%s: %d lines still match after scrubbing, the file was left unchanged", st.input, st.remaining)
+	}
+
+	return nil
+}
+
+func writeSummary(w io.Writer, results []stats, dryRun bool) int {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "FILE\tLINES\tMATCHED\tDROPPED\tREWRITTEN\tNOT JSON\tREMAINING\tMENTIONS\tSTATUS")
+
+	status := 0
+	var mentions int
+	for _, st := range results {
+		state := "scrubbed"
+		switch {
+		case st.err != nil:
+			state = "failed"
+			status = 1
+		case dryRun:
+			state = "dry run"
+		case st.matched == 0:
+			state = "unchanged"
+		}
+		mentions += st.mentions
+
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%s\n",
+			st.input, st.lines, st.matched, st.dropped, st.rewritten, st.invalid, st.remaining, st.mentions, state)
+	}
+	tw.Flush()
+
+	if status == 0 {
+		fmt.Fprintln(w, "verified: no line with a matching ownerId or callerId remains")
+	}
+
+	if mentions > 0 {
+		fmt.Fprintf(w, "warning: %d lines without a matching ownerId or callerId still mention an identifier, review them manually\n", mentions)
+	}
+
+	return status
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"github.com/rs/zerolog"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slapi"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slredact"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func testLogs() []byte {
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+
+	logger.Error().Object(slutil.ZLObjectKey, &slapi.APIError{
+		Message:    "order of user-1 not found",
+		OwnerID:    "user-1",
+		PathParams: map[string]string{"userId": "user-1"},
+		StatusCode: 404,
+	}).Send()
+	logger.Error().Object(slutil.ZLObjectKey, &slapi.APIError{CallerID: "user-1", OwnerID: "user-2", StatusCode: 403}).Send()
+	logger.Error().Object(slutil.ZLObjectKey, &slapi.APIError{OwnerID: "user-3", StatusCode: 500}).Send()
+	logger.Info().Msg("user-1 logged in")
+	buf.WriteString("not json\n")
+
+	return buf.Bytes()
+}
+
+func writeGzip(t *testing.T, path string, content []byte) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write(content)
+	require.NoError(t, err)
+	require.NoError(t, gz.Close())
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o640))
+}
+
+func readGzip(t *testing.T, path string) string {
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+
+	gz, err := gzip.NewReader(file)
+	require.NoError(t, err)
+	content, err := io.ReadAll(gz)
+	require.NoError(t, err)
+
+	return string(content)
+}
+
+func TestRun(t *testing.T) {
+	logs := testLogs()
+
+	t.Run("replace in plain and gzip files", func(t *testing.T) {
+		dir := t.TempDir()
+		plain := filepath.Join(dir, "app.log")
+		compressed := filepath.Join(dir, "app.log.gz")
+		untouched := filepath.Join(dir, "other.log")
+		require.NoError(t, os.WriteFile(plain, logs, 0o640))
+		writeGzip(t, compressed, logs)
+		require.NoError(t, os.WriteFile(untouched, []byte(`{"level":"info"}`+"\n"), 0o600))
+
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 0, run([]string{"-id", "user-1", plain, compressed, untouched}, nil, &stdout, &stderr))
+
+		scrubbed, err := os.ReadFile(plain)
+		require.NoError(t, err)
+		lines := strings.Split(strings.TrimSpace(string(scrubbed)), "\n")
+		require.Len(t, lines, 5)
+		assert.NotContains(t, lines[0], "user-1")
+		assert.Contains(t, lines[0], `"ownerId":"[ERASED]"`)
+		assert.Contains(t, lines[0], `"pathParams":{"userId":"[ERASED]"}`)
+		assert.Contains(t, lines[0], `"message":"order of [ERASED] not found"`)
+		assert.Contains(t, lines[1], `"callerId":"[ERASED]"`)
+		assert.Contains(t, lines[1], `"ownerId":"user-2"`)
+		assert.Equal(t, strings.Split(string(logs), "\n")[2:5], lines[2:5], "other lines are left exactly as they were")
+
+		assert.Equal(t, string(scrubbed), readGzip(t, compressed))
+
+		info, err := os.Stat(plain)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0o640), info.Mode().Perm())
+
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		assert.Len(t, entries, 3, "no temporary files are left behind")
+
+		assert.Contains(t, stdout.String(), "verified: no line with a matching ownerId or callerId remains")
+		assert.Contains(t, stdout.String(), "warning: 2 lines without a matching ownerId or callerId still mention an identifier")
+		assert.Regexp(t, `app\.log\s+5\s+2\s+0\s+2\s+1\s+0\s+1\s+scrubbed`, stdout.String())
+		assert.Regexp(t, `other\.log\s+1\s+0\s+0\s+0\s+0\s+0\s+0\s+unchanged`, stdout.String())
+		assert.Contains(t, stderr.String(), "line 5 is not JSON and was left unchanged")
+	})
+
+	t.Run("drop from stdin", func(t *testing.T) {
+		idsFile := filepath.Join(t.TempDir(), "ids.txt")
+		require.NoError(t, os.WriteFile(idsFile, []byte("user-1\n\nuser-3\n"), 0o600))
+
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 0, run([]string{"-mode", "drop", "-ids-file", idsFile}, bytes.NewReader(logs), &stdout, &stderr))
+
+		lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+		assert.Equal(t, strings.Split(string(logs), "\n")[3:5], lines)
+		assert.Regexp(t, `-\s+5\s+3\s+3\s+0\s+1\s+0\s+1\s+scrubbed`, stderr.String())
+	})
+
+	t.Run("pseudonyms", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 0, run([]string{"-id", "user-1", "-pseudonym-key", "00ff"}, bytes.NewReader(logs), &stdout, &stderr))
+		assert.Contains(t, stdout.String(), `"ownerId":"`+slredact.Pseudonym([]byte{0x00, 0xff}, "user-1")+`"`)
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		path := filepath.Join(t.TempDir(), "app.log")
+		require.NoError(t, os.WriteFile(path, logs, 0o600))
+
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 0, run([]string{"-dry-run", "-id", "user-1", path}, nil, &stdout, &stderr))
+		assert.Contains(t, stdout.String(), "dry run")
+
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		assert.Equal(t, logs, content)
+	})
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 2, run(nil, nil, &stdout, &stderr))
+		assert.Equal(t, 2, run([]string{"-id", "user-1", "-mode", "erase"}, nil, &stdout, &stderr))
+		assert.Equal(t, 2, run([]string{"-id", "user-1", "-pseudonym-key", "not a key!"}, nil, &stdout, &stderr))
+		assert.Equal(t, 2, run([]string{"-ids-file", filepath.Join(t.TempDir(), "missing.txt")}, nil, &stdout, &stderr))
+		assert.Equal(t, 1, run([]string{"-id", "user-1", filepath.Join(t.TempDir(), "missing.log")}, nil, &stdout, &stderr))
+		assert.Contains(t, stdout.String(), "failed")
+	})
+}
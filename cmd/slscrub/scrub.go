@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/rs/zerolog"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slapi"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultReplacement replaces the identifiers of matching lines unless a pseudonym key is given.
+const DefaultReplacement = "[ERASED]"
+
+// IDKeys are the logged fields whose values are matched against the identifiers to scrub.
+var IDKeys = []string{slapi.CallerIDKey, slapi.OwnerIDKey}
+
+// TextKeys are the logged fields whose values are free text. Identifiers are replaced where they appear in them as a
+// whole token.
+var TextKeys = []string{slapi.InnerErrorKey, slapi.MessageKey, slutil.ChainMessageKey, zerolog.MessageFieldName}
+
+// ParamKeys are the logged objects holding request parameters. Identifiers are replaced where they appear in their
+// values as a whole token.
+var ParamKeys = []string{slapi.MultiParamsKey, slapi.PathParamsKey, slapi.QueryParamsKey}
+
+type result int
+
+const (
+	resultUnchanged result = iota
+	resultDropped
+	resultInvalid
+	resultRewritten
+)
+
+// scrubber drops or rewrites the log lines belonging to a set of identifiers
+type scrubber struct {
+	drop    bool
+	ids     map[string]bool
+	ordered []string // ids from the longest to the shortest so no id is replaced within another
+	replace func(id string) string
+}
+
+func newScrubber(ids []string, drop bool, replace func(id string) string) *scrubber {
+	s := &scrubber{drop: drop, ids: make(map[string]bool, len(ids)), replace: replace}
+	for _, id := range ids {
+		if id != "" && !s.ids[id] {
+			s.ids[id] = true
+			s.ordered = append(s.ordered, id)
+		}
+	}
+
+	sort.SliceStable(s.ordered, func(i, j int) bool {
+		return len(s.ordered[i]) > len(s.ordered[j])
+	})
+
+	return s
+}
+
+// scrubLine returns line with the identifiers in its ID fields, text fields and request parameters replaced if one of
+// its ID fields matches. It returns nil for lines that are dropped. Lines that are not JSON are returned unchanged.
+func (s *scrubber) scrubLine(line []byte) ([]byte, result) {
+	trimmed := bytes.TrimSpace(line)
+	if len(trimmed) == 0 {
+		return line, resultUnchanged
+	}
+
+	var value any
+	if err := json.Unmarshal(trimmed, &value); err != nil {
+		return line, resultInvalid
+	}
+
+	if !s.matches(value) {
+		return line, resultUnchanged
+	}
+
+	if s.drop {
+		return nil, resultDropped
+	}
+
+	return rewriteStrings(line, s.rewriteValue), resultRewritten
+}
+
+// matches reports whether any ID field of value, at any depth, holds one of the identifiers
+func (s *scrubber) matches(value any) bool {
+	switch x := value.(type) {
+	case map[string]any:
+		for key, child := range x {
+			if id, ok := child.(string); ok && s.ids[id] && isIDKey(key) {
+				return true
+			}
+
+			if s.matches(child) {
+				return true
+			}
+		}
+	case []any:
+		for _, child := range x {
+			if s.matches(child) {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+func isIDKey(key string) bool {
+	return hasKey(IDKeys, key)
+}
+
+// hasKey reports whether key is one of keys once canonical
+func hasKey(keys []string, key string) bool {
+	key = slutil.CanonicalKey(key)
+	for _, current := range keys {
+		if key == current {
+			return true
+		}
+	}
+
+	return false
+}
+
+// mentions reports whether line contains any of the identifiers anywhere
+func (s *scrubber) mentions(line []byte) bool {
+	for _, id := range s.ordered {
+		if bytes.Contains(line, []byte(id)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// rewriteValue returns the string value found under the member names of path with the identifiers it holds
+// replaced. ID fields are replaced when they hold a whole identifier, text fields and request parameters where they
+// contain one as a whole token and every other value is left alone.
+func (s *scrubber) rewriteValue(path []string, text string) string {
+	if len(path) == 0 {
+		return text
+	}
+
+	key := path[len(path)-1]
+	if isIDKey(key) {
+		if s.ids[text] {
+			return s.replace(text)
+		}
+		return text
+	}
+
+	if hasKey(TextKeys, key) {
+		return s.replaceTokens(text)
+	}
+
+	for _, ancestor := range path[:len(path)-1] {
+		if hasKey(ParamKeys, ancestor) {
+			return s.replaceTokens(text)
+		}
+	}
+
+	return text
+}
+
+// replaceTokens replaces every identifier found in text as a whole token, so neither "user-1" within "user-12" nor
+// "12" within "2024-01-12" is replaced.
+func (s *scrubber) replaceTokens(text string) string {
+	var res strings.Builder
+	last := 0
+	for i := 0; i < len(text); {
+		if i > 0 && !isTokenBoundary(text[:i], false) {
+			i++
+			continue
+		}
+
+		id := s.tokenAt(text, i)
+		if id == "" {
+			i++
+			continue
+		}
+
+		res.WriteString(text[last:i])
+		res.WriteString(s.replace(id))
+		i += len(id)
+		last = i
+	}
+
+	if last == 0 {
+		return text
+	}
+
+	res.WriteString(text[last:])
+	return res.String()
+}
+
+// tokenAt returns the longest identifier starting at i and ending on a token boundary
+func (s *scrubber) tokenAt(text string, i int) string {
+	for _, id := range s.ordered {
+		end := i + len(id)
+		if strings.HasPrefix(text[i:], id) && (end == len(text) || isTokenBoundary(text[end:], true)) {
+			return id
+		}
+	}
+
+	return ""
+}
+
+// isTokenBoundary reports whether the character at the start of text, when after is true, or at its end otherwise
+// separates tokens. Letters, digits, dashes and underscores are part of a token.
+func isTokenBoundary(text string, after bool) bool {
+	var r rune
+	if after {
+		r, _ = utf8.DecodeRuneInString(text)
+	} else {
+		r, _ = utf8.DecodeLastRuneInString(text)
+	}
+
+	return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '-' && r != '_'
+}
+
+// rewriteStrings applies fn to every string value of the JSON in line together with the member names leading to it
+// and leaves everything else, keys included, exactly as it was.
+func rewriteStrings(line []byte, fn func(path []string, text string) string) []byte {
+	var res bytes.Buffer
+	res.Grow(len(line))
+
+	// every open object or array with the member name of the current value of an object
+	type container struct {
+		object    bool
+		key       string
+		expectKey bool
+	}
+	var stack []container
+
+	for i := 0; i < len(line); {
+		switch line[i] {
+		case '{':
+			stack = append(stack, container{object: true, expectKey: true})
+		case '[':
+			stack = append(stack, container{})
+		case '}', ']':
+			if len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		case ',':
+			if len(stack) > 0 && stack[len(stack)-1].object {
+				stack[len(stack)-1].expectKey = true
+			}
+		case ':':
+			if len(stack) > 0 {
+				stack[len(stack)-1].expectKey = false
+			}
+		}
+
+		if line[i] != '"' {
+			res.WriteByte(line[i])
+			i++
+			continue
+		}
+
+		end := i + 1
+		for end < len(line) && line[end] != '"' {
+			if line[end] == '\\' {
+				end++
+			}
+			end++
+		}
+		if end >= len(line) {
+			res.Write(line[i:])
+			break
+		}
+
+		literal := line[i : end+1]
+		i = end + 1
+
+		if len(stack) > 0 && stack[len(stack)-1].object && stack[len(stack)-1].expectKey {
+			var key string
+			_ = json.Unmarshal(literal, &key)
+			stack[len(stack)-1].key = key
+			res.Write(literal)
+			continue
+		}
+
+		var path []string
+		for _, current := range stack {
+			if current.object {
+				path = append(path, current.key)
+			}
+		}
+
+		res.Write(rewriteLiteral(literal, func(text string) string {
+			return fn(path, text)
+		}))
+	}
+
+	return res.Bytes()
+}
+
+func rewriteLiteral(literal []byte, fn func(string) string) []byte {
+	var text string
+	if err := json.Unmarshal(literal, &text); err != nil {
+		return literal
+	}
+
+	rewritten := fn(text)
+	if rewritten == text {
+		return literal
+	}
+
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(rewritten); err != nil {
+		return literal
+	}
+
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+func TestScrubLine(t *testing.T) {
+	replace := func(string) string { return DefaultReplacement }
+	s := newScrubber([]string{"user-1", "user-10", ""}, false, replace)
+	assert.Equal(t, []string{"user-10", "user-1"}, s.ordered)
+
+	t.Run("matching lines are rewritten in place", func(t *testing.T) {
+		line := `{"level":"error","sl":{"ownerId":"user-1","pathParams":{"id":"user-1"},"message":"user-10 <b> not found"},"time":"2024-01-02T03:04:05Z"}` + "\n"
+
+		scrubbed, res := s.scrubLine([]byte(line))
+		assert.Equal(t, resultRewritten, res)
+		assert.Equal(t, `{"level":"error","sl":{"ownerId":"[ERASED]","pathParams":{"id":"[ERASED]"},"message":"[ERASED] <b> not found"},"time":"2024-01-02T03:04:05Z"}`+"\n", string(scrubbed))
+	})
+
+	t.Run("identifiers in the chain match", func(t *testing.T) {
+		line := `{"sl":{"ownerId":"user-2","chain":[{"callerId":"user-10"}]}}`
+
+		scrubbed, res := s.scrubLine([]byte(line))
+		assert.Equal(t, resultRewritten, res)
+		assert.Equal(t, `{"sl":{"ownerId":"user-2","chain":[{"callerId":"[ERASED]"}]}}`, string(scrubbed))
+	})
+
+	t.Run("only ID fields match", func(t *testing.T) {
+		line := `{"sl":{"ownerId":"user-2","message":"user-1 was mentioned"}}`
+
+		scrubbed, res := s.scrubLine([]byte(line))
+		assert.Equal(t, resultUnchanged, res)
+		assert.Equal(t, line, string(scrubbed))
+		assert.True(t, s.mentions(scrubbed))
+	})
+
+	t.Run("drop", func(t *testing.T) {
+		dropper := newScrubber([]string{"user-1"}, true, replace)
+
+		scrubbed, res := dropper.scrubLine([]byte(`{"sl":{"callerId":"user-1"}}`))
+		assert.Equal(t, resultDropped, res)
+		assert.Nil(t, scrubbed)
+	})
+
+	t.Run("invalid and blank lines are left unchanged", func(t *testing.T) {
+		scrubbed, res := s.scrubLine([]byte("user-1 is not json\n"))
+		assert.Equal(t, resultInvalid, res)
+		assert.Equal(t, "user-1 is not json\n", string(scrubbed))
+
+		scrubbed, res = s.scrubLine([]byte("\n"))
+		assert.Equal(t, resultUnchanged, res)
+		assert.Equal(t, "\n", string(scrubbed))
+	})
+}
+
+func TestScrubLine_Tokens(t *testing.T) {
+	replace := func(string) string { return DefaultReplacement }
+
+	t.Run("numeric identifiers within timestamps and other values are kept", func(t *testing.T) {
+		s := newScrubber([]string{"12"}, false, replace)
+		line := `{"12":"12","level":"error","sl":{"ownerId":"12","line":12,"requestId":"req-12","queryParams":{"page":"12"},"message":"order 12 of 2024-01-12 failed"},"time":"2024-01-12T12:12:12Z"}`
+
+		scrubbed, res := s.scrubLine([]byte(line))
+		assert.Equal(t, resultRewritten, res)
+		assert.Equal(t, `{"12":"12","level":"error","sl":{"ownerId":"[ERASED]","line":12,"requestId":"req-12","queryParams":{"page":"[ERASED]"},"message":"order [ERASED] of 2024-01-12 failed"},"time":"2024-01-12T12:12:12Z"}`, string(scrubbed))
+	})
+
+	t.Run("longer identifiers of other users are kept", func(t *testing.T) {
+		s := newScrubber([]string{"user-12"}, false, replace)
+		line := `{"sl":{"ownerId":"user-12","callerId":"user-123","multiParams":{"ids":["user-123","user-12"]},"message":"user-12 shared with user-123, user-12_b and user-12."}}`
+
+		scrubbed, res := s.scrubLine([]byte(line))
+		assert.Equal(t, resultRewritten, res)
+		assert.Equal(t, `{"sl":{"ownerId":"[ERASED]","callerId":"user-123","multiParams":{"ids":["user-123","[ERASED]"]},"message":"[ERASED] shared with user-123, user-12_b and [ERASED]."}}`, string(scrubbed))
+	})
+}
+
+func TestRewriteStrings(t *testing.T) {
+	upper := func(path []string, text string) string {
+		return strings.Join(path, ".") + "=" + strings.ToUpper(text)
+	}
+
+	assert.Equal(t, `{"a":"a=B \"C\" \\","n":1,"l":["l=ÉX",{"k":"l.k=V"}],"o":{"p":"o.p=Q"}}`, string(rewriteStrings([]byte(`{"a":"b \"c\" \\","n":1,"l":["\u00e9x",{"k":"v"}],"o":{"p":"q"}}`), upper)))
+	assert.Equal(t, `{"a":"unterminated`, string(rewriteStrings([]byte(`{"a":"unterminated`), upper)))
+}
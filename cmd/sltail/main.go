@@ -0,0 +1,199 @@
+// Command sltail renders sl structured JSON logs in a human-readable, colored form.
+//
+// Usage:
+//
+//	sltail [-f] [-new] [-no-color] [file ...]
+//	tail -f app.log | sltail
+//
+// Logs are read from the given files or from stdin when no file or "-" is given. With -f the files are followed
+// like tail -f, picking up appended lines and starting over when a file is truncated. Lines that are not JSON are
+// printed unchanged.
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slconsole"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"time"
+)
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	os.Exit(run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("sltail", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	follow := flags.Bool("f", false, "follow the files as they grow")
+	onlyNew := flags.Bool("new", false, "with -f only print lines appended after sltail started")
+	noColor := flags.Bool("no-color", false, "disable colors")
+	poll := flags.Duration("poll", 250*time.Millisecond, "how often followed files are checked for new lines")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	out := &lineRenderer{console: slconsole.NewConsoleWriter(func(w *zerolog.ConsoleWriter) {
+		w.Out = stdout
+		w.NoColor = *noColor
+	}), raw: stdout}
+
+	inputs := flags.Args()
+	if len(inputs) == 0 {
+		inputs = []string{"-"}
+	}
+
+	var wg sync.WaitGroup
+	errs := make([]error, len(inputs))
+	for i, input := range inputs {
+		if input == "-" {
+			errs[i] = render(stdin, out)
+			continue
+		}
+
+		if !*follow {
+			errs[i] = renderFile(input, out)
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, input string) {
+			defer wg.Done()
+			errs[i] = followFile(ctx, input, out, *poll, *onlyNew)
+		}(i, input)
+	}
+	wg.Wait()
+
+	status := 0
+	for _, err := range errs {
+		if err != nil {
+			fmt.Fprintf(stderr, "sltail: %s\n", err)
+			status = 1
+		}
+	}
+
+	return status
+}
+
+// lineRenderer writes JSON lines through the console writer and every other line unchanged.
+// It is safe for concurrent use so several followed files can share one output.
+type lineRenderer struct {
+	console zerolog.ConsoleWriter
+	mu      sync.Mutex
+	raw     io.Writer
+}
+
+func (l *lineRenderer) writeLine(line []byte) error {
+	line = bytes.TrimRight(line, "\r\n")
+	if len(bytes.TrimSpace(line)) == 0 {
+		return nil
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if line[0] == '{' {
+		if _, err := l.console.Write(line); err == nil {
+			return nil
+		}
+	}
+
+	_, err := fmt.Fprintf(l.raw, "%s\n", line)
+	return err
+}
+
+func render(r io.Reader, out *lineRenderer) error {
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if writeErr := out.writeLine(line); writeErr != nil {
+			return writeErr
+		}
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+func renderFile(path string, out *lineRenderer) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return render(file, out)
+}
+
+// followFile renders path and keeps rendering lines appended to it until ctx is done.
+// Partial lines are held back until their newline is written and a file that shrinks is read again from the start.
+func followFile(ctx context.Context, path string, out *lineRenderer, poll time.Duration, onlyNew bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	var offset int64
+	if onlyNew {
+		if offset, err = file.Seek(0, io.SeekEnd); err != nil {
+			return err
+		}
+	}
+
+	reader := bufio.NewReader(file)
+	var partial []byte
+	for {
+		line, err := reader.ReadBytes('\n')
+		offset += int64(len(line))
+
+		if err == nil {
+			if err = out.writeLine(append(partial, line...)); err != nil {
+				return err
+			}
+			partial = nil
+			continue
+		}
+
+		if !errors.Is(err, io.EOF) {
+			return err
+		}
+		partial = append(partial, line...)
+
+		select {
+		case <-ctx.Done():
+			return out.writeLine(partial)
+		case <-time.After(poll):
+		}
+
+		info, err := file.Stat()
+		if err != nil {
+			return err
+		}
+
+		if info.Size() < offset {
+			// the file was truncated, for example by log rotation with copytruncate
+			if _, err = file.Seek(0, io.SeekStart); err != nil {
+				return err
+			}
+			offset, partial = 0, nil
+			reader.Reset(file)
+		}
+	}
+}
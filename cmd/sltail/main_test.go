@@ -0,0 +1,99 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"github.com/rs/zerolog"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slapi"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func apiErrorLine(requestID string) string {
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	logger.Error().Object(slutil.ZLObjectKey, &slapi.APIError{StatusCode: 503, RequestID: requestID, InnerError: errors.New("boom")}).Send()
+	return buf.String()
+}
+
+// syncBuffer lets the test read the output while sltail is still writing to it
+type syncBuffer struct {
+	buf bytes.Buffer
+	mu  sync.Mutex
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buf.String()
+}
+
+func TestRun_Piped(t *testing.T) {
+	input := strings.NewReader(apiErrorLine("req-1") + "plain text line\n" + apiErrorLine("req-2"))
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 0, run(context.Background(), []string{"-no-color"}, input, &stdout, &stderr))
+
+	lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+	require.Len(t, lines, 3)
+	assert.Contains(t, lines[0], "ERR 503 req=req-1 → boom")
+	assert.Equal(t, "plain text line", lines[1])
+	assert.Contains(t, lines[2], "ERR 503 req=req-2 → boom")
+}
+
+func TestRun_Follow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	require.NoError(t, os.WriteFile(path, []byte(apiErrorLine("req-1")), 0o600))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var stdout syncBuffer
+	var stderr bytes.Buffer
+	done := make(chan int)
+	go func() {
+		done <- run(ctx, []string{"-f", "-no-color", "-poll", "5ms", path}, nil, &stdout, &stderr)
+	}()
+
+	require.Eventually(t, func() bool { return strings.Contains(stdout.String(), "req=req-1") }, time.Second, 5*time.Millisecond)
+
+	// a line written in two parts is only rendered once it is complete
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0o600)
+	require.NoError(t, err)
+	line := apiErrorLine("req-2")
+	_, err = file.WriteString(line[:10])
+	require.NoError(t, err)
+	time.Sleep(20 * time.Millisecond)
+	_, err = file.WriteString(line[10:])
+	require.NoError(t, err)
+	require.NoError(t, file.Close())
+
+	require.Eventually(t, func() bool { return strings.Contains(stdout.String(), "req=req-2") }, time.Second, 5*time.Millisecond)
+
+	// truncated files are read again from the start
+	require.NoError(t, os.WriteFile(path, []byte(apiErrorLine("req-3")), 0o600))
+	require.Eventually(t, func() bool { return strings.Contains(stdout.String(), "req=req-3") }, time.Second, 5*time.Millisecond)
+
+	cancel()
+	assert.Equal(t, 0, <-done)
+	assert.Equal(t, 3, strings.Count(stdout.String(), "ERR 503"))
+	assert.Empty(t, stderr.String())
+}
+
+func TestRun_MissingFile(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 1, run(context.Background(), []string{filepath.Join(t.TempDir(), "missing.log")}, nil, &stdout, &stderr))
+	assert.Equal(t, 2, run(context.Background(), []string{"-unknown"}, nil, &stdout, &stderr))
+}
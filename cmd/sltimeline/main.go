@@ -0,0 +1,158 @@
+// Command sltimeline reconstructs the timeline of a single request across several sl structured JSON log files.
+//
+// Usage:
+//
+//	sltimeline -request req-123 api.log worker.log db.log
+//	sltimeline -trace 4bf92f3577b34da6a3ce929d0e0e4736 api.log worker.log db.log
+//
+// Every APIError and DatabaseError logged for the request or W3C trace is merged into a single list ordered by
+// timestamp and printed with its offset from the first event, so the causal order of failures across services
+// is visible.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slconsole"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slread"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// event is a record together with the file it was read from
+type event struct {
+	record *slread.Record
+	source string
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("sltimeline", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	asJSON := flags.Bool("json", false, "print the merged raw JSON lines instead of the timeline")
+	requestIDs := flags.String("request", "", "comma separated request IDs to reconstruct")
+	traceIDs := flags.String("trace", "", "comma separated trace IDs to reconstruct")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	filter := slread.Filter{RequestIDs: splitList(*requestIDs), TraceIDs: splitList(*traceIDs)}
+	if len(filter.RequestIDs) == 0 && len(filter.TraceIDs) == 0 {
+		fmt.Fprintln(stderr, "sltimeline: -request or -trace is required")
+		return 2
+	}
+
+	inputs := flags.Args()
+	if len(inputs) == 0 {
+		inputs = []string{"-"}
+	}
+
+	var events []event
+	status := 0
+	for _, input := range inputs {
+		read, err := readEvents(input, stdin, filter, stderr)
+		if err != nil {
+			fmt.Fprintf(stderr, "sltimeline: %s\n", err)
+			status = 1
+		}
+		events = append(events, read...)
+	}
+
+	// events logged at the same instant keep the order of their files and lines
+	sort.SliceStable(events, func(i, j int) bool {
+		return events[i].record.Time.Before(events[j].record.Time)
+	})
+
+	if *asJSON {
+		for _, e := range events {
+			fmt.Fprintf(stdout, "%s\n", e.record.Raw)
+		}
+	} else {
+		writeTimeline(stdout, events)
+	}
+
+	return status
+}
+
+func readEvents(input string, stdin io.Reader, filter slread.Filter, stderr io.Writer) ([]event, error) {
+	reader, source := stdin, "stdin"
+	if input != "-" {
+		file, err := os.Open(input)
+		if err != nil {
+			return nil, err
+		}
+		defer file.Close()
+		reader, source = file, filepath.Base(input)
+	}
+
+	var events []event
+	decoder := slread.NewDecoder(reader)
+	for {
+		record, err := decoder.Next()
+		if errors.Is(err, io.EOF) {
+			return events, nil
+		}
+
+		var lineErr *slread.LineError
+		if errors.As(err, &lineErr) {
+			fmt.Fprintf(stderr, "sltimeline: %s: skipping %s\n", input, lineErr)
+			continue
+		} else if err != nil {
+			return events, fmt.Errorf("%s: %w", input, err)
+		}
+
+		if record.Kind == slread.KindNone || !filter.Match(record) {
+			continue
+		}
+
+		events = append(events, event{record: record, source: fmt.Sprintf("%s:%d", source, record.Line)})
+	}
+}
+
+func writeTimeline(w io.Writer, events []event) {
+	if len(events) == 0 {
+		fmt.Fprintln(w, "no events found")
+		return
+	}
+
+	start := events[0].record.Time
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "OFFSET\tTIME\tSOURCE\tLEVEL\tKIND\tEVENT")
+	for _, e := range events {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n",
+			formatOffset(e.record.Time.Sub(start)),
+			e.record.Time.UTC().Format(time.RFC3339Nano),
+			e.source,
+			e.record.Level,
+			e.record.Kind,
+			slconsole.Summary(e.record.Fields),
+		)
+	}
+	tw.Flush()
+}
+
+func formatOffset(offset time.Duration) string {
+	return fmt.Sprintf("+%.3fs", offset.Seconds())
+}
+
+func splitList(value string) []string {
+	var res []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			res = append(res, item)
+		}
+	}
+
+	return res
+}
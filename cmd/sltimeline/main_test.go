@@ -0,0 +1,115 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"github.com/rs/zerolog"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slapi"
+	"github.com/seantcanavan/zerolog-json-structured-logs/sldb"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+var testStart = time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+
+func writeLog(t *testing.T, dir, name string, write func(logger zerolog.Logger)) string {
+	var buf bytes.Buffer
+	write(zerolog.New(&buf))
+
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, buf.Bytes(), 0o600))
+
+	return path
+}
+
+func writeTimelineLogs(t *testing.T) []string {
+	dir := t.TempDir()
+
+	apiLog := writeLog(t, dir, "api.log", func(logger zerolog.Logger) {
+		apiErr := &slapi.APIError{Method: "GET", Path: "/users/1", RequestID: "req-1", StatusCode: 503, InnerError: errors.New("worker failed")}
+		logger.Error().Time(zerolog.TimestampFieldName, testStart.Add(4*time.Second)).Object(slutil.ZLObjectKey, apiErr).Send()
+
+		otherErr := &slapi.APIError{RequestID: "req-2", TraceID: testTraceID, StatusCode: 404, InnerError: errors.New("not found")}
+		logger.Error().Time(zerolog.TimestampFieldName, testStart).Object(slutil.ZLObjectKey, otherErr).Send()
+	})
+
+	workerLog := writeLog(t, dir, "worker.log", func(logger zerolog.Logger) {
+		apiErr := &slapi.APIError{Path: "/jobs", RequestID: "req-1", StatusCode: 500, InnerError: errors.New("db unavailable")}
+		logger.Error().Time(zerolog.TimestampFieldName, testStart.Add(3*time.Second)).Object(slutil.ZLObjectKey, apiErr).Send()
+	})
+
+	dbLog := writeLog(t, dir, "db.log", func(logger zerolog.Logger) {
+		dbErr := &sldb.DatabaseError{RequestID: "req-1", TableName: "users", TraceID: testTraceID, Type: sldb.ErrDBConnectionFailed, InnerError: errors.New("connection refused")}
+		logger.Error().Time(zerolog.TimestampFieldName, testStart.Add(time.Second)).Object(slutil.ZLObjectKey, dbErr).Send()
+		logger.Info().Msg("not an error")
+	})
+
+	return []string{apiLog, workerLog, dbLog}
+}
+
+func TestRun(t *testing.T) {
+	files := writeTimelineLogs(t)
+
+	t.Run("timeline is merged and ordered by time", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 0, run(append([]string{"-request", "req-1"}, files...), nil, &stdout, &stderr))
+
+		lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+		require.Len(t, lines, 4)
+		assert.True(t, strings.HasPrefix(lines[0], "OFFSET"))
+
+		assert.True(t, strings.HasPrefix(lines[1], "+0.000s"))
+		assert.Contains(t, lines[1], "db.log:1")
+		assert.Contains(t, lines[1], "DB Connection Failed users")
+
+		assert.True(t, strings.HasPrefix(lines[2], "+2.000s"))
+		assert.Contains(t, lines[2], "worker.log:1")
+		assert.Contains(t, lines[2], "500 /jobs req=req-1 → db unavailable")
+
+		assert.True(t, strings.HasPrefix(lines[3], "+3.000s"))
+		assert.Contains(t, lines[3], "api.log:1")
+		assert.Contains(t, lines[3], "503 GET /users/1 req=req-1 → worker failed")
+		assert.Empty(t, stderr.String())
+	})
+
+	t.Run("json output", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 0, run(append([]string{"-json", "-request", "req-1,req-2"}, files...), nil, &stdout, &stderr))
+
+		lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+		require.Len(t, lines, 4)
+		assert.Contains(t, lines[0], `"requestId":"req-2"`)
+		assert.Contains(t, lines[3], `"statusCode":503`)
+	})
+
+	t.Run("trace spanning several requests", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 0, run(append([]string{"-trace", testTraceID}, files...), nil, &stdout, &stderr))
+
+		lines := strings.Split(strings.TrimSpace(stdout.String()), "\n")
+		require.Len(t, lines, 3)
+		assert.Contains(t, lines[1], "404 req=req-2")
+		assert.True(t, strings.HasPrefix(lines[2], "+1.000s"))
+		assert.Contains(t, lines[2], "db.log:1")
+	})
+
+	t.Run("no matching events", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 0, run(append([]string{"-request", "req-404"}, files...), nil, &stdout, &stderr))
+		assert.Equal(t, "no events found\n", stdout.String())
+	})
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 2, run(files, nil, &stdout, &stderr))
+		assert.Equal(t, 1, run([]string{"-request", "req-1", filepath.Join(t.TempDir(), "missing.log")}, nil, &stdout, &stderr))
+	})
+}
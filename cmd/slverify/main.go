@@ -0,0 +1,92 @@
+// Command slverify checks the hash chains slaudit.Writer adds to sl structured JSON logs and reports every line
+// that was modified, removed, inserted or reordered.
+//
+// Usage:
+//
+//	slverify [-key hex or base64 HMAC key] [-allow-restarts] [-quiet] [file ...]
+//
+// Files are verified in the given order as one chain, so rotated files should be given from the oldest to the
+// newest. A chain starting over at seq 1 with an empty prevHash, as it does after a restart unless the writer
+// continued the chain with slaudit.LastState and slaudit.WithState, is a problem since it is indistinguishable from
+// lines cut from the end of the chain. With -allow-restarts it is only counted as a restart.
+// Logs are read from stdin when no file or "-" is given. slverify exits with 1 if the chain is broken or a file could
+// not be read.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slaudit"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slcrypt"
+	"io"
+	"os"
+)
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	flags := flag.NewFlagSet("slverify", flag.ContinueOnError)
+	flags.SetOutput(stderr)
+
+	allowRestarts := flags.Bool("allow-restarts", false, "count chains starting over at seq 1 as restarts instead of problems")
+	key := flags.String("key", "", "the HMAC key the logs were signed with in hex or base64")
+	quiet := flags.Bool("quiet", false, "only print the summary")
+
+	if err := flags.Parse(args); err != nil {
+		return 2
+	}
+
+	var options []func(*slaudit.Writer)
+	if *key != "" {
+		hmacKey, err := slcrypt.ParseKey(*key)
+		if err != nil {
+			fmt.Fprintf(stderr, "slverify: invalid -key: %s\n", err)
+			return 2
+		}
+		options = append(options, slaudit.WithHMACKey(hmacKey))
+	}
+
+	inputs := flags.Args()
+	if len(inputs) == 0 {
+		inputs = []string{"-"}
+	}
+
+	verifier := slaudit.NewVerifier(options...)
+	verifier.AllowRestarts = *allowRestarts
+	status := 0
+	for _, input := range inputs {
+		if err := verifyInput(verifier, input, stdin); err != nil {
+			fmt.Fprintf(stderr, "slverify: %s\n", err)
+			status = 1
+		}
+	}
+
+	if !*quiet {
+		for _, problem := range verifier.Problems {
+			fmt.Fprintln(stdout, problem)
+		}
+	}
+
+	fmt.Fprintf(stdout, "%d lines, %d problems, %d restarts\n", verifier.Lines, len(verifier.Problems), verifier.Restarts)
+	if !verifier.OK() {
+		status = 1
+	}
+
+	return status
+}
+
+func verifyInput(verifier *slaudit.Verifier, input string, stdin io.Reader) error {
+	reader := stdin
+	if input != "-" {
+		file, err := os.Open(input)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	return verifier.Verify(input, reader)
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"github.com/rs/zerolog"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slaudit"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRun(t *testing.T) {
+	var buf bytes.Buffer
+	logger := zerolog.New(slaudit.NewWriter(&buf, slaudit.WithHMACKey([]byte{0xab, 0xcd})))
+	for i := 0; i < 4; i++ {
+		logger.Info().Int("i", i).Send()
+	}
+	logs := buf.String()
+
+	t.Run("intact", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 0, run([]string{"-key", "abcd"}, strings.NewReader(logs), &stdout, &stderr))
+		assert.Equal(t, "4 lines, 0 problems, 0 restarts\n", stdout.String())
+		assert.Empty(t, stderr.String())
+	})
+
+	t.Run("rotated files", func(t *testing.T) {
+		lines := strings.SplitAfter(logs, "\n")
+		dir := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "app.log.1"), []byte(strings.Join(lines[:2], "")), 0o600))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "app.log"), []byte(strings.Join(lines[2:], "")), 0o600))
+
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 0, run([]string{"-key", "abcd", filepath.Join(dir, "app.log.1"), filepath.Join(dir, "app.log")}, nil, &stdout, &stderr))
+
+		assert.Equal(t, "4 lines, 0 problems, 0 restarts\n", stdout.String())
+
+		stdout.Reset()
+		assert.Equal(t, 1, run([]string{"-key", "abcd", filepath.Join(dir, "app.log"), filepath.Join(dir, "app.log.1")}, nil, &stdout, &stderr))
+		assert.Equal(t, filepath.Join(dir, "app.log.1")+":1: restart: a new chain starts after seq 4\n4 lines, 1 problems, 1 restarts\n", stdout.String(), "files in the wrong order look like a restart")
+
+		stdout.Reset()
+		assert.Equal(t, 0, run([]string{"-key", "abcd", "-allow-restarts", filepath.Join(dir, "app.log"), filepath.Join(dir, "app.log.1")}, nil, &stdout, &stderr))
+		assert.Equal(t, "4 lines, 0 problems, 1 restarts\n", stdout.String())
+	})
+
+	t.Run("tampered", func(t *testing.T) {
+		tampered := strings.Replace(logs, `"i":1`, `"i":5`, 1)
+
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 1, run([]string{"-key", "abcd"}, strings.NewReader(tampered), &stdout, &stderr))
+		assert.Equal(t, "-:2: modified: seq 2 does not match its hash\n4 lines, 1 problems, 0 restarts\n", stdout.String())
+
+		stdout.Reset()
+		assert.Equal(t, 1, run([]string{"-quiet"}, strings.NewReader(logs), &stdout, &stderr), "without the key")
+		assert.Equal(t, "4 lines, 4 problems, 0 restarts\n", stdout.String())
+	})
+
+	t.Run("invalid arguments", func(t *testing.T) {
+		var stdout, stderr bytes.Buffer
+		assert.Equal(t, 2, run([]string{"-key", "not a key!"}, nil, &stdout, &stderr))
+		assert.Equal(t, 2, run([]string{"-unknown"}, nil, &stdout, &stderr))
+		assert.Equal(t, 1, run([]string{filepath.Join(t.TempDir(), "missing.log")}, nil, &stdout, &stderr))
+	})
+}
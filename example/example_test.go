@@ -1,12 +1,18 @@
 package example
 
 import (
+	"bytes"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
 	"github.com/seantcanavan/zerolog-json-structured-logs/slapi"
 	"github.com/seantcanavan/zerolog-json-structured-logs/sldb"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"os"
 	"testing"
 )
 
@@ -83,3 +89,105 @@ func findLemonadeStandError(err error) (*lemonadeStandError, bool) {
 	}
 	return nil, false
 }
+
+func TestWrapDatabaseErrorChain(t *testing.T) {
+	var buf bytes.Buffer
+	log.Logger = zerolog.New(&buf)
+	defer func() { log.Logger = zerolog.New(os.Stderr) }()
+
+	slutil.LogErrorChain = true
+	defer func() { slutil.LogErrorChain = false }()
+
+	require.Error(t, wrapDatabaseError())
+
+	// the database error and the api error are both logged - the api error is the last line
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	require.Len(t, lines, 2)
+
+	var item slutil.ZLJSONItem
+	require.NoError(t, json.Unmarshal(lines[1], &item))
+
+	chain, ok := item.ErrorAsJSON[slutil.ChainKey].([]any)
+	require.True(t, ok)
+	require.Len(t, chain, 4) // fmt wrap -> DatabaseError -> fmt wrap -> sql error
+
+	dbLink := chain[1].(map[string]any)
+	assert.Equal(t, "*sldb.DatabaseError", dbLink[slutil.ChainErrorTypeKey])
+	assert.Equal(t, "testdb", dbLink["dbName"])
+	assert.Equal(t, "users", dbLink["tableName"])
+	assert.Equal(t, sldb.ErrDBConnectionFailed.String(), dbLink["type"])
+	assert.Equal(t, "SELECT * FROM users", dbLink["query"])
+	assert.Nil(t, dbLink[slutil.ChainKey])
+
+	rootLink := chain[3].(map[string]any)
+	assert.Equal(t, "*errors.errorString", rootLink[slutil.ChainErrorTypeKey])
+	assert.Equal(t, "sql: no rows in result set", rootLink[slutil.ChainMessageKey])
+}
+
+func TestWrapDatabaseErrorLogOnce(t *testing.T) {
+	var buf bytes.Buffer
+	log.Logger = zerolog.New(&buf)
+	defer func() { log.Logger = zerolog.New(os.Stderr) }()
+
+	slutil.Mode = slutil.LogModeBoundary
+	defer func() { slutil.Mode = slutil.LogModeEager }()
+
+	err := wrapDatabaseError()
+	assert.Empty(t, buf.Bytes(), "nothing is logged until the boundary")
+
+	require.Same(t, slapi.FindOutermostAPIError(err), slapi.LogFinal(err))
+	slapi.LogFinal(err)
+
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	require.Len(t, lines, 1)
+	assert.True(t, sldb.FindOutermostDatabaseError(err).Logged())
+
+	var item slutil.ZLJSONItem
+	require.NoError(t, json.Unmarshal(lines[0], &item))
+	chain, ok := item.ErrorAsJSON[slutil.ChainKey].([]any)
+	require.True(t, ok)
+	assert.Equal(t, "*sldb.DatabaseError", chain[1].(map[string]any)[slutil.ChainErrorTypeKey])
+}
+
+func TestWrapDatabaseErrorLogOnce_Eager(t *testing.T) {
+	var buf bytes.Buffer
+	log.Logger = zerolog.New(&buf)
+	defer func() { log.Logger = zerolog.New(os.Stderr) }()
+
+	err := wrapDatabaseError()
+	slapi.LogFinal(err)
+
+	// the api error is logged with its request details although the database error it wraps was logged already,
+	// LogFinal does not log either of them again
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	require.Len(t, lines, 2)
+
+	apiErr := slapi.FindOutermostAPIError(err)
+	var item slutil.ZLJSONItem
+	require.NoError(t, json.Unmarshal(lines[1], &item))
+	assert.Equal(t, apiErr.RequestID, item.ErrorAsJSON[slapi.RequestIDKey])
+	assert.Equal(t, float64(apiErr.StatusCode), item.ErrorAsJSON[slapi.StatusCodeKey])
+}
+
+func TestWrapDatabaseErrorJSONRoundTrip(t *testing.T) {
+	log.Logger = zerolog.Nop()
+	defer func() { log.Logger = zerolog.New(os.Stderr) }()
+
+	apiErr := slapi.FindOutermostAPIError(wrapDatabaseError())
+	require.NotNil(t, apiErr)
+
+	marshalled, err := json.Marshal(apiErr)
+	require.NoError(t, err)
+
+	var decoded slapi.APIError
+	require.NoError(t, json.Unmarshal(marshalled, &decoded))
+
+	// the database error wrapped with fmt.Errorf comes back as a *sldb.DatabaseError behind the same message
+	dbErrs := sldb.FindDatabaseErrors(&decoded)
+	require.Len(t, dbErrs, 1)
+	assert.Equal(t, "testdb", dbErrs[0].DBName)
+	assert.Equal(t, sldb.ErrDBConnectionFailed, dbErrs[0].Type)
+	assert.ErrorContains(t, dbErrs[0].InnerError, "sql: no rows in result set")
+	assert.EqualError(t, decoded.InnerError, apiErr.InnerError.Error())
+	assert.Equal(t, apiErr.Error(), decoded.Error())
+}
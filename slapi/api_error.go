@@ -2,12 +2,15 @@ package slapi
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"github.com/seantcanavan/zerolog-json-structured-logs/sltrace"
 	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
 	"net/http"
+	"strconv"
 )
 
 const CallerIDKey = "callerId"
@@ -20,15 +23,19 @@ const MessageKey = "message"
 const MethodKey = "method"
 const ModuleKey = "module"
 const MultiParamsKey = "multiParams"
+const OriginKey = "origin"
 const OwnerIDKey = "ownerId"
 const OwnerTypeKey = "ownerType"
 const PackageKey = "package"
 const PathKey = "path"
 const PathParamsKey = "pathParams"
 const QueryParamsKey = "queryParams"
+const RemoteKey = "remote"
 const RequestIDKey = "requestId"
+const SpanIDKey = "spanId"
 const StatusCodeKey = "statusCode"
 const StatusTextKey = "statusText"
+const TraceIDKey = "traceId"
 
 const DefaultAPIErrorMessage = "an API Error occurred"
 const DefaultAPIErrorStatusCode = http.StatusInternalServerError
@@ -42,19 +49,32 @@ type APIError struct {
 	Message     string
 	Method      string
 	MultiParams map[string][]string
+	Origin      string // the name of the service a remote APIError was returned by
 	OwnerID     string
 	OwnerType   string
 	Path        string
 	PathParams  map[string]string
 	QueryParams map[string]string
+	Remote      bool // whether the APIError was decoded from the error response of another service
 	RequestID   string
+	SpanID      string // the W3C trace context span ID of the request
 	StatusCode  int
+	TraceID     string // the W3C trace context trace ID of the request
 
 	slutil.ExecContext `json:"execContext"` // Embedded struct
+
+	logged bool // whether this error has already been written to the log
 }
 
 // Error returns the string representation of the APIError.
 func (e *APIError) Error() string {
+	if e.Remote {
+		if e.InnerError == nil {
+			return fmt.Sprintf("[APIError from %s] %d - %s at %s + %s", e.Origin, e.StatusCode, e.Message, e.Path, e.Method)
+		}
+		return fmt.Sprintf("[APIError from %s] %d - %s at %s + %s: %s", e.Origin, e.StatusCode, e.Message, e.Path, e.Method, e.InnerError)
+	}
+
 	return fmt.Sprintf("[APIError] %d - %s at %s + %s: %s", e.StatusCode, e.Message, e.Path, e.Method, e.InnerError)
 }
 
@@ -63,6 +83,16 @@ func (e *APIError) Unwrap() error {
 	return e.InnerError
 }
 
+// Logged reports whether the APIError has already been written to the log.
+func (e *APIError) Logged() bool {
+	return e.logged
+}
+
+// MarkLogged records that the APIError has been written to the log so it is not logged again.
+func (e *APIError) MarkLogged() {
+	e.logged = true
+}
+
 func addDefaults(apiErr *APIError) {
 	if apiErr.Message == "" {
 		apiErr.Message = DefaultAPIErrorMessage
@@ -94,10 +124,90 @@ func LogCtx(ctx context.Context, err error, calleePkg, calleeFn string, statusCo
 }
 
 func LogCtxMsg(ctx context.Context, err error, message string, statusCode int) error {
+	apiErr := fromCtx(ctx, err, message, statusCode)
+	apiErr.ExecContext = slutil.GetExecContext(3)
+
+	logEagerly(apiErr)
+
+	return apiErr
+}
+
+// NewCtxMsg builds the APIError LogCtxMsg would log from the request details in ctx without logging it.
+func NewCtxMsg(ctx context.Context, err error, message string, statusCode int) error {
+	apiErr := fromCtx(ctx, err, message, statusCode)
+	apiErr.ExecContext = slutil.GetExecContext(3)
+
+	return apiErr
+}
+
+func LogNew(apiErr APIError) error {
+	addDefaults(&apiErr)
+	apiErr.ExecContext = slutil.GetExecContext(3)
+
+	logEagerly(&apiErr)
+
+	return &apiErr
+}
+
+func New(apiErr APIError) error {
+	addDefaults(&apiErr)
+	apiErr.ExecContext = slutil.GetExecContext(3)
+
+	return &apiErr
+}
+
+// LogFinal logs err once at the outermost boundary of the application together with its whole chain.
+// The outermost error in the tree that can log itself is logged, or err is wrapped in a new APIError if there is none.
+// Errors that have already been logged are not logged again. The logged error is returned.
+func LogFinal(err error) error {
+	return logFinal(context.Background(), err)
+}
+
+// LogFinalCtx behaves like LogFinal but fills in the request details from ctx when err has to be wrapped in a new APIError.
+func LogFinalCtx(ctx context.Context, err error) error {
+	return logFinal(ctx, err)
+}
+
+// logFinal implements LogFinal and LogFinalCtx so both record the ExecContext of their caller
+func logFinal(ctx context.Context, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	loggable, ok := slutil.FindFirst[slutil.Loggable](err)
+	if !ok {
+		apiErr := fromCtx(ctx, err, slutil.PrettyErrMsgInternal(), DefaultAPIErrorStatusCode)
+		apiErr.ExecContext = slutil.GetExecContext(3)
+		loggable = apiErr
+	}
+
+	if slutil.IsLogged(loggable) {
+		return loggable
+	}
+
+	slutil.AddObject(log.Error(), loggable).Send()
+	slutil.MarkLogged(loggable)
+
+	return loggable
+}
+
+// logEagerly logs apiErr when the Log* functions are configured to log immediately. It is logged even if the error
+// it wraps already was, since only its line holds the request details. Use slutil.LogModeBoundary to log every
+// error exactly once.
+func logEagerly(apiErr *APIError) {
+	if !slutil.ShouldLogEagerly() {
+		return
+	}
+
+	slutil.AddObject(log.Error(), apiErr).Send()
+	slutil.MarkLogged(apiErr)
+}
+
+func fromCtx(ctx context.Context, err error, message string, statusCode int) *APIError {
+	traceID, spanID := sltrace.IDs(ctx)
 	apiErr := APIError{
 		CallerID:    slutil.FromCtxSafe[string](ctx, CallerIDKey),
 		CallerType:  slutil.FromCtxSafe[string](ctx, CallerTypeKey),
-		ExecContext: slutil.GetExecContext(3),
 		InnerError:  err,
 		Message:     message,
 		Method:      slutil.FromCtxSafe[string](ctx, MethodKey),
@@ -108,57 +218,140 @@ func LogCtxMsg(ctx context.Context, err error, message string, statusCode int) e
 		PathParams:  slutil.FromCtxSafe[map[string]string](ctx, PathParamsKey),
 		QueryParams: slutil.FromCtxSafe[map[string]string](ctx, QueryParamsKey),
 		RequestID:   slutil.FromCtxSafe[string](ctx, RequestIDKey),
+		SpanID:      spanID,
 		StatusCode:  statusCode,
+		TraceID:     traceID,
 	}
 
 	addDefaults(&apiErr)
 
-	log.Error().Object(slutil.ZLObjectKey, &apiErr).Send()
-
 	return &apiErr
 }
 
-func LogNew(apiErr APIError) error {
-	addDefaults(&apiErr)
-	apiErr.ExecContext = slutil.GetExecContext(3)
-
-	log.Error().Object(slutil.ZLObjectKey, &apiErr).Send()
-
-	return &apiErr
+// MarshalZerologObject allows APIError to be logged by zerolog.
+func (e *APIError) MarshalZerologObject(zle *zerolog.Event) {
+	e.MarshalZerologFields(zle)
+	zle.Str(slutil.FingerprintKey, slutil.Fingerprint(e))
+	slutil.AddService(zle)
+	slutil.AddChain(zle, e.InnerError)
 }
 
-func New(apiErr APIError) error {
-	addDefaults(&apiErr)
-	apiErr.ExecContext = slutil.GetExecContext(3)
+// FingerprintParts returns the fields that identify the kind of failure the APIError describes.
+func (e *APIError) FingerprintParts() []string {
+	parts := []string{
+		"api",
+		strconv.Itoa(e.StatusCode),
+		e.Package,
+		e.Function,
+		slutil.NormalizeMessage(e.Message),
+		slutil.RootCauseType(e.InnerError),
+	}
 
-	return &apiErr
+	if e.Remote {
+		parts = append(parts, "remote", e.Origin)
+	}
+
+	return parts
 }
 
-// MarshalZerologObject allows APIError to be logged by zerolog.
-func (e *APIError) MarshalZerologObject(zle *zerolog.Event) {
+// MarshalZerologFields logs the fields of APIError without the chain of errors it wraps.
+func (e *APIError) MarshalZerologFields(zle *zerolog.Event) {
+	var truncated slutil.Truncations
 	zle.
 		Int(LineKey, e.Line).
 		Int(StatusCodeKey, e.StatusCode).
-		Interface(MultiParamsKey, e.MultiParams).
-		Interface(PathParamsKey, e.PathParams).
-		Interface(QueryParamsKey, e.QueryParams).
-		Str(CallerIDKey, e.CallerID).
-		Str(CallerTypeKey, e.CallerType).
+		Bool(RemoteKey, e.Remote).
+		Interface(MultiParamsKey, truncated.MultiParams(MultiParamsKey, e.MultiParams, slutil.FieldLimits.Param)).
+		Interface(PathParamsKey, truncated.Params(PathParamsKey, e.PathParams, slutil.FieldLimits.Param)).
+		Interface(QueryParamsKey, truncated.Params(QueryParamsKey, e.QueryParams, slutil.FieldLimits.Param)).
+		Str(CallerIDKey, slutil.EncryptField(CallerIDKey, e.CallerID)).
+		Str(CallerTypeKey, slutil.EncryptField(CallerTypeKey, e.CallerType)).
 		Str(FileKey, e.File).
 		Str(FunctionKey, e.Function).
-		Str(MessageKey, e.Message).
+		Str(MessageKey, truncated.Text(MessageKey, e.Message, slutil.FieldLimits.Message)).
 		Str(MethodKey, e.Method).
 		Str(ModuleKey, e.Module).
-		Str(OwnerIDKey, e.OwnerID).
-		Str(OwnerTypeKey, e.OwnerType).
+		Str(OriginKey, e.Origin).
+		Str(OwnerIDKey, slutil.EncryptField(OwnerIDKey, e.OwnerID)).
+		Str(OwnerTypeKey, slutil.EncryptField(OwnerTypeKey, e.OwnerType)).
 		Str(PackageKey, e.Package).
 		Str(PathKey, e.Path).
 		Str(RequestIDKey, e.RequestID).
-		Str(StatusTextKey, http.StatusText(e.StatusCode))
+		Str(SpanIDKey, e.SpanID).
+		Str(StatusTextKey, http.StatusText(e.StatusCode)).
+		Str(TraceIDKey, e.TraceID)
 
-	if e.InnerError != nil {
-		zle.AnErr(InnerErrorKey, e.InnerError)
+	slutil.AddInnerError(zle, InnerErrorKey, e.InnerError, &truncated)
+	slutil.AddTruncated(zle, truncated)
+}
+
+func init() {
+	slutil.RegisterErrorType(func() error { return &APIError{} })
+}
+
+// MarshalJSON encodes APIError with the same field names MarshalZerologObject logs, including the
+// ExecContext fields and InnerError. Fields are encoded as they are, without redaction, encryption or truncation.
+func (e *APIError) MarshalJSON() ([]byte, error) {
+	return slutil.MarshalFieldsJSON(map[string]any{
+		CallerIDKey:           e.CallerID,
+		CallerTypeKey:         e.CallerType,
+		FileKey:               e.File,
+		FunctionKey:           e.Function,
+		LineKey:               e.Line,
+		MessageKey:            e.Message,
+		MethodKey:             e.Method,
+		ModuleKey:             e.Module,
+		MultiParamsKey:        e.MultiParams,
+		OriginKey:             e.Origin,
+		OwnerIDKey:            e.OwnerID,
+		OwnerTypeKey:          e.OwnerType,
+		PackageKey:            e.Package,
+		PathKey:               e.Path,
+		PathParamsKey:         e.PathParams,
+		QueryParamsKey:        e.QueryParams,
+		RemoteKey:             e.Remote,
+		RequestIDKey:          e.RequestID,
+		SpanIDKey:             e.SpanID,
+		StatusCodeKey:         e.StatusCode,
+		StatusTextKey:         http.StatusText(e.StatusCode),
+		TraceIDKey:            e.TraceID,
+		slutil.FingerprintKey: slutil.Fingerprint(e),
+	}, InnerErrorKey, e.InnerError)
+}
+
+// UnmarshalJSON decodes an APIError produced by MarshalJSON or read back from a log line.
+// InnerError is restored as a plain error holding the logged message or as an *slutil.ObjectError
+// when it was logged as an object. Typed sl errors encoded by MarshalJSON are restored as their concrete type.
+func (e *APIError) UnmarshalJSON(data []byte) error {
+	var obj slutil.JSONObject
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
 	}
+
+	return errors.Join(
+		obj.Decode(CallerIDKey, &e.CallerID),
+		obj.Decode(CallerTypeKey, &e.CallerType),
+		obj.Decode(FileKey, &e.File),
+		obj.Decode(FunctionKey, &e.Function),
+		obj.DecodeError(InnerErrorKey, &e.InnerError),
+		obj.Decode(LineKey, &e.Line),
+		obj.Decode(MessageKey, &e.Message),
+		obj.Decode(MethodKey, &e.Method),
+		obj.Decode(ModuleKey, &e.Module),
+		obj.Decode(MultiParamsKey, &e.MultiParams),
+		obj.Decode(OriginKey, &e.Origin),
+		obj.Decode(OwnerIDKey, &e.OwnerID),
+		obj.Decode(OwnerTypeKey, &e.OwnerType),
+		obj.Decode(PackageKey, &e.Package),
+		obj.Decode(PathKey, &e.Path),
+		obj.Decode(PathParamsKey, &e.PathParams),
+		obj.Decode(QueryParamsKey, &e.QueryParams),
+		obj.Decode(RemoteKey, &e.Remote),
+		obj.Decode(RequestIDKey, &e.RequestID),
+		obj.Decode(SpanIDKey, &e.SpanID),
+		obj.Decode(StatusCodeKey, &e.StatusCode),
+		obj.Decode(TraceIDKey, &e.TraceID),
+	)
 }
 
 // FindOutermostAPIError returns the final APIError in the error chain.
@@ -171,19 +364,10 @@ func FindOutermostAPIError(err error) *APIError {
 	return nil
 }
 
-// FindAPIErrors returns a slice of all APIError found in the error chain.
+// FindAPIErrors returns a slice of all APIError found in the error tree. Each APIError is returned
+// once in depth-first order and errors joined with errors.Join are searched as well.
 func FindAPIErrors(err error) []*APIError {
-	var errs []*APIError
-	for {
-		var apiErr *APIError
-		if errors.As(err, &apiErr) {
-			errs = append(errs, apiErr)
-		}
-		if err = errors.Unwrap(err); err == nil {
-			break
-		}
-	}
-	return errs
+	return slutil.FindAll[*APIError](err)
 }
 
 func GenerateRandomAPIError() APIError {
@@ -1,12 +1,14 @@
 package slapi
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slredact"
 	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -239,3 +241,211 @@ func verifyAPILogContents(t *testing.T, rawAPIError *APIError, loggedAPIError er
 		})
 	})
 }
+
+func TestFindAPIErrors(t *testing.T) {
+	innerAPIErr := &APIError{Message: "inner", StatusCode: http.StatusNotFound}
+	siblingAPIErr := &APIError{Message: "sibling", StatusCode: http.StatusConflict}
+	outerAPIErr := &APIError{Message: "outer", StatusCode: http.StatusBadGateway, InnerError: fmt.Errorf("wrapping error %w", innerAPIErr)}
+
+	t.Run("each APIError in a single chain is returned once", func(t *testing.T) {
+		found := FindAPIErrors(fmt.Errorf("wrapping error %w", outerAPIErr))
+		require.Len(t, found, 2)
+		assert.Same(t, outerAPIErr, found[0])
+		assert.Same(t, innerAPIErr, found[1])
+	})
+
+	t.Run("APIErrors joined with errors.Join are found", func(t *testing.T) {
+		joined := errors.Join(outerAPIErr, errors.New("plain"), siblingAPIErr)
+		found := FindAPIErrors(joined)
+		require.Len(t, found, 3)
+		assert.Same(t, outerAPIErr, found[0])
+		assert.Same(t, innerAPIErr, found[1])
+		assert.Same(t, siblingAPIErr, found[2])
+
+		assert.Same(t, outerAPIErr, FindOutermostAPIError(joined))
+	})
+
+	t.Run("no APIError in the tree", func(t *testing.T) {
+		assert.Empty(t, FindAPIErrors(errors.New("plain")))
+		assert.Nil(t, FindOutermostAPIError(errors.New("plain")))
+	})
+}
+
+func TestAPIError_JSON(t *testing.T) {
+	apiErr := GenerateNonRandomAPIError()
+
+	marshalled, err := json.Marshal(&apiErr)
+	require.NoError(t, err)
+
+	t.Run("json field names match the zerolog field names", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := zerolog.New(&buf)
+		logger.Error().Object(slutil.ZLObjectKey, &apiErr).Send()
+
+		var logged slutil.ZLJSONItem
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &logged))
+
+		var jsonFields map[string]any
+		require.NoError(t, json.Unmarshal(marshalled, &jsonFields))
+
+		assert.Equal(t, logged.ErrorAsJSON, jsonFields)
+		assert.Equal(t, "InnerError", jsonFields[InnerErrorKey])
+		assert.Equal(t, apiErr.Function, jsonFields[FunctionKey])
+	})
+
+	t.Run("unmarshalling restores every field", func(t *testing.T) {
+		var decoded APIError
+		require.NoError(t, json.Unmarshal(marshalled, &decoded))
+
+		assert.Equal(t, apiErr.CallerID, decoded.CallerID)
+		assert.Equal(t, apiErr.CallerType, decoded.CallerType)
+		assert.Equal(t, apiErr.ExecContext, decoded.ExecContext)
+		assert.Equal(t, apiErr.Message, decoded.Message)
+		assert.Equal(t, apiErr.Method, decoded.Method)
+		assert.Equal(t, apiErr.MultiParams, decoded.MultiParams)
+		assert.Equal(t, apiErr.OwnerID, decoded.OwnerID)
+		assert.Equal(t, apiErr.OwnerType, decoded.OwnerType)
+		assert.Equal(t, apiErr.Path, decoded.Path)
+		assert.Equal(t, apiErr.PathParams, decoded.PathParams)
+		assert.Equal(t, apiErr.QueryParams, decoded.QueryParams)
+		assert.Equal(t, apiErr.RequestID, decoded.RequestID)
+		assert.Equal(t, apiErr.StatusCode, decoded.StatusCode)
+		assert.EqualError(t, decoded.InnerError, apiErr.InnerError.Error())
+		assert.Equal(t, apiErr.Error(), decoded.Error())
+	})
+
+	t.Run("unmarshalling rejects mistyped fields", func(t *testing.T) {
+		var decoded APIError
+		assert.Error(t, json.Unmarshal([]byte(`{"statusCode":"five hundred"}`), &decoded))
+		assert.Error(t, json.Unmarshal([]byte(`[]`), &decoded))
+	})
+}
+
+func TestAPIError_JSONRoundTrip(t *testing.T) {
+	slutil.Redaction = slredact.New()
+	slutil.FieldLimits = slutil.Limits{InnerError: 4, Message: 4, Param: 4}
+	defer func() {
+		slutil.Redaction = nil
+		slutil.FieldLimits = slutil.Limits{}
+	}()
+
+	apiErr := GenerateNonRandomAPIError()
+	apiErr.Message = "could not mail jane@example.com"
+	apiErr.QueryParams = map[string]string{"email": "jane@example.com"}
+
+	marshalled, err := json.Marshal(&apiErr)
+	require.NoError(t, err)
+
+	// the JSON holds the fields as they are, only the log output is redacted and truncated
+	var decoded APIError
+	require.NoError(t, json.Unmarshal(marshalled, &decoded))
+	assert.Equal(t, apiErr.Message, decoded.Message)
+	assert.Equal(t, apiErr.MultiParams, decoded.MultiParams)
+	assert.Equal(t, apiErr.PathParams, decoded.PathParams)
+	assert.Equal(t, apiErr.QueryParams, decoded.QueryParams)
+	assert.EqualError(t, decoded.InnerError, apiErr.InnerError.Error())
+	assert.NotContains(t, string(marshalled), slutil.TruncatedKey)
+
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	logger.Error().Object(slutil.ZLObjectKey, &apiErr).Send()
+	assert.NotContains(t, buf.String(), "jane@example.com")
+	assert.Contains(t, buf.String(), slutil.TruncatedKey)
+}
+
+func TestAPIError_Fingerprint(t *testing.T) {
+	first := GenerateNonRandomAPIError()
+	second := GenerateNonRandomAPIError()
+	second.RequestID = "another request"
+	second.OwnerID = "another owner"
+	second.Message = "Message"
+
+	assert.Equal(t, slutil.Fingerprint(&first), slutil.Fingerprint(&second))
+
+	second.StatusCode = http.StatusBadGateway
+	assert.NotEqual(t, slutil.Fingerprint(&first), slutil.Fingerprint(&second))
+
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	logger.Error().Object(slutil.ZLObjectKey, &first).Send()
+
+	var logged slutil.ZLJSONItem
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &logged))
+	assert.Equal(t, slutil.Fingerprint(&first), logged.ErrorAsJSON[slutil.FingerprintKey])
+}
+
+func TestAPIError_Limits(t *testing.T) {
+	slutil.FieldLimits = slutil.Limits{InnerError: 5, Message: 6, Param: 4}
+	defer func() { slutil.FieldLimits = slutil.Limits{} }()
+
+	apiErr := APIError{
+		InnerError:  errors.New("<html>error page</html>"),
+		Message:     "héllo wörld",
+		MultiParams: map[string][]string{"tags": {"a", "abcdefgh"}},
+		PathParams:  map[string]string{"id": "123456"},
+		QueryParams: map[string]string{"q": "ok"},
+		StatusCode:  http.StatusBadGateway,
+	}
+
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	logger.Error().Object(slutil.ZLObjectKey, &apiErr).Send()
+
+	var logged slutil.ZLJSONItem
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &logged))
+
+	assert.Equal(t, "héllo", logged.ErrorAsJSON[MessageKey])
+	assert.Equal(t, "<html", logged.ErrorAsJSON[InnerErrorKey])
+	assert.Equal(t, map[string]any{"id": "1234"}, logged.ErrorAsJSON[PathParamsKey])
+	assert.Equal(t, map[string]any{"q": "ok"}, logged.ErrorAsJSON[QueryParamsKey])
+	assert.Equal(t, map[string]any{"tags": []any{"a", "abcd"}}, logged.ErrorAsJSON[MultiParamsKey])
+	assert.Equal(t, map[string]any{
+		InnerErrorKey:               float64(23),
+		MessageKey:                  float64(13),
+		MultiParamsKey + ".tags[1]": float64(8),
+		PathParamsKey + ".id":       float64(6),
+	}, logged.ErrorAsJSON[slutil.TruncatedKey])
+
+	assert.Equal(t, "héllo wörld", apiErr.Message, "the error itself is not modified")
+	assert.Equal(t, slutil.Fingerprint(&apiErr), logged.ErrorAsJSON[slutil.FingerprintKey], "the fingerprint uses the complete fields")
+}
+
+func TestAPIError_Service(t *testing.T) {
+	slutil.SetServiceInfo(slutil.ServiceInfo{Environment: "test", Name: "billing", Version: "v1.2.3"})
+	defer slutil.ClearServiceInfo()
+
+	logged := func(buf *bytes.Buffer) map[string]any {
+		var item slutil.ZLJSONItem
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &item))
+		require.IsType(t, map[string]any{}, item.ErrorAsJSON[slutil.ServiceKey])
+
+		return item.ErrorAsJSON[slutil.ServiceKey].(map[string]any)
+	}
+
+	t.Run("global logger", func(t *testing.T) {
+		var buf bytes.Buffer
+		previous := log.Logger
+		log.Logger = zerolog.New(&buf)
+		defer func() { log.Logger = previous }()
+
+		_ = LogNew(APIError{StatusCode: http.StatusConflict})
+
+		service := logged(&buf)
+		assert.Equal(t, "billing", service[slutil.ServiceNameKey])
+		assert.Equal(t, "v1.2.3", service[slutil.ServiceVersionKey])
+		assert.Equal(t, "test", service[slutil.ServiceEnvironmentKey])
+		assert.Equal(t, float64(os.Getpid()), service[slutil.ServicePIDKey])
+	})
+
+	t.Run("injected logger", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := zerolog.New(&buf)
+		logger.Error().Object(slutil.ZLObjectKey, &APIError{StatusCode: http.StatusConflict}).Send()
+
+		assert.Equal(t, "billing", logged(&buf)[slutil.ServiceNameKey])
+	})
+}
+
+func TestAPIError_DataKeys(t *testing.T) {
+	assert.Subset(t, slutil.DataKeys, []string{MultiParamsKey, PathParamsKey, QueryParamsKey}, "parameter names must never be renamed")
+}
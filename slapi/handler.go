@@ -0,0 +1,101 @@
+package slapi
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/seantcanavan/zerolog-json-structured-logs/sltrace"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
+	"net/http"
+)
+
+// RequestIDHeader is the header the request ID is read from and echoed back in
+const RequestIDHeader = "X-Request-ID"
+
+// HandlerFunc is an http handler that returns its error instead of writing an error response itself.
+type HandlerFunc func(w http.ResponseWriter, r *http.Request) error
+
+// Handler adapts h into an http.Handler that acts as the outermost logging boundary.
+// The request details and trace context are stored in the request context under the keys LogCtxMsg reads and any error returned
+// by h is logged exactly once with LogFinalCtx before an error response with its status code is written.
+// Plain status text is written unless WriteProblems is set, in which case clients accepting JSON receive a
+// problem+json response written by WriteProblem.
+func Handler(h HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := WithRequest(r.Context(), r)
+		w.Header().Set(RequestIDHeader, slutil.FromCtxSafe[string](ctx, RequestIDKey))
+
+		err := h(w, r.WithContext(ctx))
+		if err == nil {
+			return
+		}
+
+		err = LogFinalCtx(ctx, err)
+		if acceptsProblem(r) {
+			WriteProblem(w, err)
+			return
+		}
+
+		statusCode := StatusCode(err)
+		http.Error(w, http.StatusText(statusCode), statusCode)
+	})
+}
+
+// WithRequest returns a copy of ctx holding the method, path, query parameters and request ID of r under the keys
+// LogCtxMsg reads. The request ID is taken from the RequestIDHeader or generated if the header is empty.
+// Unless ctx already carries a span, for example one started by OpenTelemetry middleware, a new span continuing
+// the trace of the traceparent and tracestate headers of r is stored as well, or a new trace is started.
+func WithRequest(ctx context.Context, r *http.Request) context.Context {
+	queryParams := make(map[string]string)
+	multiParams := make(map[string][]string)
+	for key, values := range r.URL.Query() {
+		if len(values) > 1 {
+			multiParams[key] = values
+		} else if len(values) == 1 {
+			queryParams[key] = values[0]
+		}
+	}
+
+	requestID := r.Header.Get(RequestIDHeader)
+	if requestID == "" {
+		requestID = newRequestID()
+	}
+
+	ctx = context.WithValue(ctx, MethodKey, r.Method)
+	ctx = context.WithValue(ctx, MultiParamsKey, multiParams)
+	ctx = context.WithValue(ctx, PathKey, r.URL.Path)
+	ctx = context.WithValue(ctx, QueryParamsKey, queryParams)
+	ctx = context.WithValue(ctx, RequestIDKey, requestID)
+
+	if _, ok := sltrace.FromContext(ctx); !ok {
+		ctx = sltrace.NewContext(ctx, sltrace.FromHeaders(r.Header))
+	}
+
+	return ctx
+}
+
+// StatusCode returns the HTTP status code of the outermost APIError in the error tree of err.
+// The status code of the outermost error with an HTTPStatus method, such as sldb.DatabaseError, is used
+// if there is no APIError. DefaultAPIErrorStatusCode is returned when neither exists.
+func StatusCode(err error) int {
+	if apiErr := FindOutermostAPIError(err); apiErr != nil && apiErr.StatusCode != 0 {
+		return apiErr.StatusCode
+	}
+
+	var statusErr interface{ HTTPStatus() int }
+	if errors.As(err, &statusErr) {
+		return statusErr.HTTPStatus()
+	}
+
+	return DefaultAPIErrorStatusCode
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return ""
+	}
+
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,244 @@
+package slapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/seantcanavan/zerolog-json-structured-logs/sltrace"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"runtime"
+	"testing"
+)
+
+func bufferLogger() *bytes.Buffer {
+	var buf bytes.Buffer
+	log.Logger = zerolog.New(&buf)
+	return &buf
+}
+
+func resetLogger() {
+	log.Logger = zerolog.New(os.Stderr)
+	slutil.Mode = slutil.LogModeEager
+}
+
+func logLines(t *testing.T, buf *bytes.Buffer) []slutil.ZLJSONItem {
+	var items []slutil.ZLJSONItem
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+
+		var item slutil.ZLJSONItem
+		require.NoError(t, json.Unmarshal(line, &item))
+		items = append(items, item)
+	}
+
+	return items
+}
+
+func TestHandler(t *testing.T) {
+	buf := bufferLogger()
+	defer resetLogger()
+	slutil.Mode = slutil.LogModeBoundary
+
+	var handlerRequestID string
+	handler := Handler(func(w http.ResponseWriter, r *http.Request) error {
+		handlerRequestID = slutil.FromCtxSafe[string](r.Context(), RequestIDKey)
+		inner := LogCtx(r.Context(), errors.New("lemons sold out"), "lemonade", "Squeeze", http.StatusServiceUnavailable)
+		return LogNew(APIError{InnerError: fmt.Errorf("wrapping error %w", inner), StatusCode: http.StatusBadGateway})
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/lemonade?size=large&extra=ice&extra=sugar", nil)
+	req.Header.Set(RequestIDHeader, "req-abc")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadGateway, rec.Code)
+	assert.Equal(t, "req-abc", rec.Header().Get(RequestIDHeader))
+	assert.Equal(t, "req-abc", handlerRequestID)
+
+	// only one line is written for both errors and it contains the chain
+	items := logLines(t, buf)
+	require.Len(t, items, 1)
+	assert.Equal(t, float64(http.StatusBadGateway), items[0].ErrorAsJSON[StatusCodeKey])
+
+	chain, ok := items[0].ErrorAsJSON[slutil.ChainKey].([]any)
+	require.True(t, ok)
+	innerLink := chain[1].(map[string]any)
+	assert.Equal(t, "*slapi.APIError", innerLink[slutil.ChainErrorTypeKey])
+	assert.Equal(t, "req-abc", innerLink[RequestIDKey])
+	assert.Equal(t, "/lemonade", innerLink[PathKey])
+	assert.Equal(t, http.MethodGet, innerLink[MethodKey])
+	assert.Equal(t, map[string]any{"size": "large"}, innerLink[QueryParamsKey])
+	assert.Equal(t, map[string]any{"extra": []any{"ice", "sugar"}}, innerLink[MultiParamsKey])
+}
+
+func TestHandler_GeneratesRequestID(t *testing.T) {
+	buf := bufferLogger()
+	defer resetLogger()
+
+	handler := Handler(func(w http.ResponseWriter, r *http.Request) error {
+		return errors.New("plain error")
+	})
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/orders", nil))
+
+	assert.Equal(t, DefaultAPIErrorStatusCode, rec.Code)
+	requestID := rec.Header().Get(RequestIDHeader)
+	assert.Len(t, requestID, 32)
+
+	// plain errors are wrapped in an APIError built from the request context
+	items := logLines(t, buf)
+	require.Len(t, items, 1)
+	assert.Equal(t, requestID, items[0].ErrorAsJSON[RequestIDKey])
+	assert.Equal(t, "/orders", items[0].ErrorAsJSON[PathKey])
+	assert.Equal(t, "plain error", items[0].ErrorAsJSON[InnerErrorKey])
+}
+
+func TestHandler_TraceContext(t *testing.T) {
+	buf := bufferLogger()
+	defer resetLogger()
+
+	var handlerTrace sltrace.TraceContext
+	handler := Handler(func(w http.ResponseWriter, r *http.Request) error {
+		handlerTrace, _ = sltrace.FromContext(r.Context())
+		return LogCtxInternal(r.Context(), errors.New("out of cups"), http.StatusConflict)
+	})
+
+	t.Run("continues the incoming trace", func(t *testing.T) {
+		buf.Reset()
+		req := httptest.NewRequest(http.MethodGet, "/cups", nil)
+		req.Header.Set(sltrace.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		req.Header.Set(sltrace.TracestateHeader, "rojo=00f067aa0ba902b7")
+		handler.ServeHTTP(httptest.NewRecorder(), req)
+
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", handlerTrace.TraceID)
+		assert.Equal(t, "00f067aa0ba902b7", handlerTrace.ParentSpanID)
+		assert.Equal(t, "rojo=00f067aa0ba902b7", handlerTrace.TraceState)
+
+		items := logLines(t, buf)
+		require.Len(t, items, 1)
+		assert.Equal(t, handlerTrace.TraceID, items[0].ErrorAsJSON[TraceIDKey])
+		assert.Equal(t, handlerTrace.SpanID, items[0].ErrorAsJSON[SpanIDKey])
+	})
+
+	t.Run("starts a new trace", func(t *testing.T) {
+		buf.Reset()
+		handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/cups", nil))
+
+		assert.True(t, handlerTrace.IsValid())
+		assert.Empty(t, handlerTrace.ParentSpanID)
+
+		items := logLines(t, buf)
+		require.Len(t, items, 1)
+		assert.Equal(t, handlerTrace.TraceID, items[0].ErrorAsJSON[TraceIDKey])
+	})
+
+	t.Run("keeps a span already in the context", func(t *testing.T) {
+		existing := sltrace.New()
+		req := httptest.NewRequest(http.MethodGet, "/cups", nil)
+		req.Header.Set(sltrace.TraceparentHeader, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+		handler.ServeHTTP(httptest.NewRecorder(), req.WithContext(sltrace.NewContext(req.Context(), existing)))
+
+		assert.Equal(t, existing, handlerTrace)
+	})
+}
+
+func TestLogFinal(t *testing.T) {
+	t.Run("errors logged eagerly are not logged again", func(t *testing.T) {
+		buf := bufferLogger()
+		defer resetLogger()
+
+		err := LogNew(GenerateRandomAPIError())
+		require.Len(t, logLines(t, buf), 1)
+
+		assert.Same(t, err, LogFinal(fmt.Errorf("wrapping error %w", err)))
+		assert.Same(t, err, LogFinal(err))
+		assert.Len(t, logLines(t, buf), 1)
+	})
+
+	t.Run("boundary mode logs once at LogFinal", func(t *testing.T) {
+		buf := bufferLogger()
+		defer resetLogger()
+		slutil.Mode = slutil.LogModeBoundary
+
+		err := LogNew(GenerateRandomAPIError())
+		assert.Empty(t, logLines(t, buf))
+		assert.False(t, slutil.IsLogged(err))
+
+		LogFinal(err)
+		LogFinal(err)
+		assert.Len(t, logLines(t, buf), 1)
+		assert.True(t, slutil.IsLogged(err))
+	})
+
+	t.Run("plain errors are wrapped with the caller of LogFinal and LogFinalCtx", func(t *testing.T) {
+		bufferLogger()
+		defer resetLogger()
+
+		_, _, line, _ := runtime.Caller(0)
+		final := FindOutermostAPIError(LogFinal(errors.New("plain")))
+		finalCtx := FindOutermostAPIError(LogFinalCtx(context.Background(), errors.New("plain")))
+
+		require.NotNil(t, final)
+		require.NotNil(t, finalCtx)
+		assert.Equal(t, "TestLogFinal", final.Function)
+		assert.Equal(t, line+1, final.Line)
+		assert.Equal(t, "TestLogFinal", finalCtx.Function)
+		assert.Equal(t, line+2, finalCtx.Line)
+	})
+
+	t.Run("nil errors are ignored", func(t *testing.T) {
+		buf := bufferLogger()
+		defer resetLogger()
+
+		assert.Nil(t, LogFinal(nil))
+		assert.Empty(t, logLines(t, buf))
+	})
+}
+
+func TestLogEagerly_WrappingLoggedError(t *testing.T) {
+	buf := bufferLogger()
+	defer resetLogger()
+
+	inner := LogNew(GenerateRandomAPIError())
+	require.Len(t, logLines(t, buf), 1)
+
+	outer := LogNew(APIError{InnerError: fmt.Errorf("wrapping error %w", inner), StatusCode: http.StatusBadGateway})
+
+	final := LogCtxMsg(context.Background(), outer, "still failing", http.StatusBadGateway)
+
+	// every error holds request details the errors it wraps do not have, so each one is logged
+	items := logLines(t, buf)
+	require.Len(t, items, 3)
+	assert.Equal(t, "still failing", items[2].ErrorAsJSON[MessageKey])
+
+	assert.Same(t, final, LogFinal(final))
+	assert.Len(t, logLines(t, buf), 3)
+}
+
+func TestStatusCode(t *testing.T) {
+	assert.Equal(t, http.StatusTeapot, StatusCode(fmt.Errorf("wrapping error %w", &APIError{StatusCode: http.StatusTeapot})))
+	assert.Equal(t, http.StatusNotFound, StatusCode(statusError{}))
+	assert.Equal(t, DefaultAPIErrorStatusCode, StatusCode(errors.New("plain")))
+}
+
+type statusError struct{}
+
+func (statusError) Error() string {
+	return "status error"
+}
+
+func (statusError) HTTPStatus() int {
+	return http.StatusNotFound
+}
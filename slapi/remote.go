@@ -0,0 +1,162 @@
+package slapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// ProblemContentType is the media type of RFC 9457 problem details responses.
+const ProblemContentType = "application/problem+json"
+
+// MaxRemoteErrorBytes is the largest error response body DecodeRemoteError reads.
+var MaxRemoteErrorBytes int64 = 1 << 20
+
+// problem member names, see https://www.rfc-editor.org/rfc/rfc9457
+const (
+	problemDetailKey   = "detail"
+	problemInstanceKey = "instance"
+	problemStatusKey   = "status"
+	problemTitleKey    = "title"
+	problemTypeKey     = "type"
+)
+
+var ErrNotAnErrorBody = errors.New("response body is not a problem+json or sl error")
+
+// WriteProblems makes Handler answer clients accepting JSON with a problem+json response written by WriteProblem.
+// Handler writes the plain status text while it is false, which is the default.
+var WriteProblems bool
+
+// WriteProblem writes the outermost APIError of err as a problem+json response. It holds the standard problem
+// members, with the message of the APIError as detail and its path as instance, and the request and trace IDs under
+// the keys MarshalZerologObject uses so the calling service can correlate them after DecodeRemoteError.
+// Nothing else is written since the execution context, parameters and inner errors are not meant for clients.
+func WriteProblem(w http.ResponseWriter, err error) {
+	statusCode := StatusCode(err)
+	apiErr := FindOutermostAPIError(err)
+	if apiErr == nil {
+		apiErr = &APIError{Message: DefaultAPIErrorMessage, StatusCode: statusCode}
+	}
+
+	problem := map[string]any{
+		problemDetailKey: apiErr.Message,
+		problemStatusKey: statusCode,
+		problemTitleKey:  http.StatusText(statusCode),
+		problemTypeKey:   "about:blank",
+	}
+
+	if apiErr.Path != "" {
+		problem[problemInstanceKey] = apiErr.Path
+	}
+
+	if apiErr.RequestID != "" {
+		problem[RequestIDKey] = apiErr.RequestID
+	}
+
+	if apiErr.TraceID != "" {
+		problem[TraceIDKey] = apiErr.TraceID
+	}
+
+	w.Header().Set("Content-Type", ProblemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(statusCode)
+	json.NewEncoder(w).Encode(problem)
+}
+
+// acceptsProblem reports whether problem+json responses are enabled and the client of r asked for JSON error
+// responses
+func acceptsProblem(r *http.Request) bool {
+	if !WriteProblems {
+		return false
+	}
+
+	accept := r.Header.Get("Accept")
+	return strings.Contains(accept, ProblemContentType) || strings.Contains(accept, "application/json")
+}
+
+// DecodeRemoteError restores the APIError another service returned in the body of res. The body is read and
+// replaced so it can still be read by the caller. See ParseRemoteError for the formats that are understood.
+func DecodeRemoteError(res *http.Response, origin string) (*APIError, error) {
+	body, err := io.ReadAll(io.LimitReader(res.Body, MaxRemoteErrorBytes))
+	res.Body.Close()
+	res.Body = io.NopCloser(bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("could not read error response from %s: %w", origin, err)
+	}
+
+	return ParseRemoteError(body, res.StatusCode, origin)
+}
+
+// ParseRemoteError decodes an error response body returned by the service origin into an APIError marked as
+// remote. The body can be a problem+json document, the JSON of an APIError or a log line holding one in any
+// slutil.LogEncoding layout. statusCode is used when the body has none. The returned APIError is meant to be wrapped as
+// the InnerError of a local error so the chain across services is logged in one line.
+func ParseRemoteError(body []byte, statusCode int, origin string) (*APIError, error) {
+	var obj slutil.JSONObject
+	if err := json.Unmarshal(body, &obj); err != nil || obj == nil {
+		return nil, fmt.Errorf("%w from %s", ErrNotAnErrorBody, origin)
+	}
+
+	var line map[string]any
+	if json.Unmarshal(body, &line) == nil {
+		if fields, ok := slutil.LogObject(line); ok {
+			body, _ = json.Marshal(fields)
+			obj = nil
+			if err := json.Unmarshal(body, &obj); err != nil {
+				return nil, fmt.Errorf("%w from %s", ErrNotAnErrorBody, origin)
+			}
+		}
+	}
+
+	_, hasStatusCode := obj[StatusCodeKey]
+	_, hasStatus := obj[problemStatusKey]
+	_, hasTitle := obj[problemTitleKey]
+	if !hasStatusCode && !hasStatus && !hasTitle {
+		return nil, fmt.Errorf("%w from %s", ErrNotAnErrorBody, origin)
+	}
+
+	var apiErr APIError
+	var detail, instance, title string
+	var status int
+	err := errors.Join(
+		apiErr.UnmarshalJSON(body),
+		obj.Decode(problemDetailKey, &detail),
+		obj.Decode(problemInstanceKey, &instance),
+		obj.Decode(problemStatusKey, &status),
+		obj.Decode(problemTitleKey, &title),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode error response from %s: %w", origin, err)
+	}
+
+	if apiErr.StatusCode == 0 {
+		apiErr.StatusCode = status
+	}
+	if apiErr.StatusCode == 0 {
+		apiErr.StatusCode = statusCode
+	}
+
+	if apiErr.Message == "" {
+		apiErr.Message = detail
+	}
+	if apiErr.Message == "" {
+		apiErr.Message = title
+	}
+
+	if apiErr.Path == "" {
+		apiErr.Path = instance
+	}
+
+	// an error that was already remote keeps the service it came from
+	if !apiErr.Remote || apiErr.Origin == "" {
+		apiErr.Origin = origin
+	}
+	apiErr.Remote = true
+
+	return &apiErr, nil
+}
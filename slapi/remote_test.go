@@ -0,0 +1,171 @@
+package slapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestParseRemoteError(t *testing.T) {
+	t.Run("problem+json", func(t *testing.T) {
+		body := `{"type":"about:blank","title":"Not Found","status":404,"detail":"order 42 does not exist","instance":"/orders/42","requestId":"req-1"}`
+
+		apiErr, err := ParseRemoteError([]byte(body), http.StatusTeapot, "orders")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusNotFound, apiErr.StatusCode)
+		assert.Equal(t, "order 42 does not exist", apiErr.Message)
+		assert.Equal(t, "/orders/42", apiErr.Path)
+		assert.Equal(t, "req-1", apiErr.RequestID)
+		assert.True(t, apiErr.Remote)
+		assert.Equal(t, "orders", apiErr.Origin)
+	})
+
+	t.Run("APIError JSON", func(t *testing.T) {
+		original := GenerateNonRandomAPIError()
+		body, err := json.Marshal(&original)
+		require.NoError(t, err)
+
+		apiErr, err := ParseRemoteError(body, http.StatusBadGateway, "users")
+		require.NoError(t, err)
+		assert.Equal(t, original.StatusCode, apiErr.StatusCode)
+		assert.Equal(t, original.Function, apiErr.Function)
+		assert.Equal(t, original.RequestID, apiErr.RequestID)
+		assert.Equal(t, "InnerError", apiErr.InnerError.Error())
+		assert.Equal(t, "users", apiErr.Origin)
+	})
+
+	t.Run("log line", func(t *testing.T) {
+		body := `{"level":"error","sl":{"statusCode":503,"message":"queue full","function":"Enqueue","remote":true,"origin":"queue"}}`
+
+		apiErr, err := ParseRemoteError([]byte(body), http.StatusBadGateway, "worker")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusServiceUnavailable, apiErr.StatusCode)
+		assert.Equal(t, "Enqueue", apiErr.Function)
+		assert.Equal(t, "queue", apiErr.Origin, "an error relayed from another service keeps its origin")
+	})
+
+	t.Run("status code of the response is the fallback", func(t *testing.T) {
+		apiErr, err := ParseRemoteError([]byte(`{"title":"Service Unavailable"}`), http.StatusServiceUnavailable, "users")
+		require.NoError(t, err)
+		assert.Equal(t, http.StatusServiceUnavailable, apiErr.StatusCode)
+		assert.Equal(t, "Service Unavailable", apiErr.Message)
+	})
+
+	for _, body := range []string{"", "upstream connect error", `["error"]`, `{"data":null}`, "null"} {
+		_, err := ParseRemoteError([]byte(body), http.StatusBadGateway, "users")
+		assert.ErrorIs(t, err, ErrNotAnErrorBody, body)
+	}
+}
+
+func TestRemoteErrorRoundTrip(t *testing.T) {
+	bufferLogger()
+	defer resetLogger()
+
+	WriteProblems = true
+	defer func() { WriteProblems = false }()
+
+	server := httptest.NewServer(Handler(func(w http.ResponseWriter, r *http.Request) error {
+		return LogCtxMsg(r.Context(), errors.New("stock exhausted"), "no lemons left", http.StatusConflict)
+	}))
+	defer server.Close()
+
+	req, err := http.NewRequest(http.MethodPost, server.URL+"/lemons", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept", ProblemContentType)
+	req.Header.Set(RequestIDHeader, "req-remote")
+
+	res, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, ProblemContentType, res.Header.Get("Content-Type"))
+
+	remote, err := DecodeRemoteError(res, "lemonade")
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusConflict, remote.StatusCode)
+	assert.Equal(t, "no lemons left", remote.Message)
+	assert.Equal(t, "req-remote", remote.RequestID)
+	assert.Equal(t, "/lemons", remote.Path)
+	assert.NotEmpty(t, remote.TraceID)
+	assert.Nil(t, remote.InnerError, "inner errors are not sent to clients")
+	assert.Equal(t, "[APIError from lemonade] 409 - no lemons left at /lemons + ", remote.Error())
+
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(string(body), "{"), "the body can still be read")
+
+	t.Run("remote errors are logged as part of the local chain", func(t *testing.T) {
+		buf := bufferLogger()
+		slutil.LogErrorChain = true
+		defer func() { slutil.LogErrorChain = false }()
+
+		LogNew(APIError{InnerError: fmt.Errorf("calling lemonade: %w", remote), StatusCode: http.StatusBadGateway})
+
+		items := logLines(t, buf)
+		require.Len(t, items, 1)
+		chain := items[0].ErrorAsJSON[slutil.ChainKey].([]any)
+		remoteLink := chain[1].(map[string]any)
+		assert.Equal(t, true, remoteLink[RemoteKey])
+		assert.Equal(t, "lemonade", remoteLink[OriginKey])
+		assert.Equal(t, "no lemons left", remoteLink[MessageKey])
+	})
+}
+
+func TestWriteProblem_PlainError(t *testing.T) {
+	rec := httptest.NewRecorder()
+	WriteProblem(rec, statusError{})
+
+	var problem map[string]any
+	require.NoError(t, json.NewDecoder(bytes.NewReader(rec.Body.Bytes())).Decode(&problem))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Equal(t, float64(http.StatusNotFound), problem["status"])
+	assert.Equal(t, DefaultAPIErrorMessage, problem["detail"])
+	assert.NotContains(t, problem, "instance")
+}
+
+func TestWriteProblem_OnlyStandardMembers(t *testing.T) {
+	apiErr := GenerateNonRandomAPIError()
+	apiErr.Path = "/lemons"
+	apiErr.TraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+
+	rec := httptest.NewRecorder()
+	WriteProblem(rec, &apiErr)
+
+	var problem map[string]any
+	require.NoError(t, json.NewDecoder(bytes.NewReader(rec.Body.Bytes())).Decode(&problem))
+	assert.Equal(t, map[string]any{
+		"detail":     apiErr.Message,
+		"instance":   "/lemons",
+		"status":     float64(http.StatusInternalServerError),
+		"title":      http.StatusText(http.StatusInternalServerError),
+		"type":       "about:blank",
+		RequestIDKey: apiErr.RequestID,
+		TraceIDKey:   apiErr.TraceID,
+	}, problem)
+}
+
+func TestHandler_ProblemsAreOptIn(t *testing.T) {
+	bufferLogger()
+	defer resetLogger()
+
+	handler := Handler(func(w http.ResponseWriter, r *http.Request) error {
+		return LogCtxMsg(r.Context(), errors.New("stock exhausted"), "no lemons left", http.StatusConflict)
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/lemons", nil)
+	req.Header.Set("Accept", ProblemContentType)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	assert.Equal(t, "text/plain; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, http.StatusText(http.StatusConflict)+"\n", rec.Body.String())
+}
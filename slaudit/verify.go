@@ -0,0 +1,141 @@
+package slaudit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ProblemKind classifies a break of the chain found by Verifier.
+type ProblemKind int
+
+const (
+	ProblemBrokenLink ProblemKind = iota // prevHash does not match the hash of the line before
+	ProblemGap                           // lines are missing
+	ProblemMalformed                     // the line is not a chained JSON line
+	ProblemModified                      // the line does not match its own hash
+	ProblemReordered                     // seq went backwards or repeated
+	ProblemRestart                       // a new chain started at seq 1 while restarts are not allowed
+)
+
+func (k ProblemKind) String() string {
+	switch k {
+	case ProblemBrokenLink:
+		return "broken link"
+	case ProblemGap:
+		return "gap"
+	case ProblemMalformed:
+		return "malformed"
+	case ProblemModified:
+		return "modified"
+	case ProblemReordered:
+		return "reordered"
+	case ProblemRestart:
+		return "restart"
+	default:
+		return "unknown"
+	}
+}
+
+// Problem is a single break of the chain.
+type Problem struct {
+	Detail string
+	Input  string
+	Kind   ProblemKind
+	Line   int    // the 1-based line number in Input
+	Seq    uint64 // 0 if the line is malformed
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s:%d: %s: %s", p.Input, p.Line, p.Kind, p.Detail)
+}
+
+// Verifier checks the chains written by Writer. The state is kept between calls to Verify so rotated files can be
+// verified in order as one chain. A new chain starting after the first line is reported as a problem unless
+// AllowRestarts is set, e.g. for logs of a process restarted without WithState.
+type Verifier struct {
+	AllowRestarts bool      // accept a chain starting over at seq 1 with an empty prevHash instead of reporting it
+	Lines         int       // the number of non-empty lines read
+	Problems      []Problem // every break found so far
+	Restarts      int       // the number of times a chain started over at seq 1 after the first line
+
+	hmacKey  []byte
+	prevHash string
+	prevSeq  uint64
+	started  bool
+}
+
+// NewVerifier returns a Verifier for lines written by a Writer with the same options. Only WithHMACKey applies.
+func NewVerifier(options ...func(*Writer)) *Verifier {
+	w := NewWriter(nil, options...)
+	return &Verifier{hmacKey: w.hmacKey}
+}
+
+// Verify reads every line of r, which is named input in the problems found, and returns an error only if r could
+// not be read. The first chained line is trusted to continue whatever came before it.
+func (v *Verifier) Verify(input string, r io.Reader) error {
+	reader := bufio.NewReader(r)
+	for lineNumber := 1; ; lineNumber++ {
+		line, err := reader.ReadBytes('\n')
+		if line = bytes.TrimRight(line, "\r\n"); len(line) > 0 {
+			v.Lines++
+			v.verifyLine(input, lineNumber, line)
+		}
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("%s: %w", input, err)
+		}
+	}
+}
+
+// OK reports whether no problem has been found.
+func (v *Verifier) OK() bool {
+	return len(v.Problems) == 0
+}
+
+func (v *Verifier) verifyLine(input string, lineNumber int, line []byte) {
+	add := func(kind ProblemKind, seq uint64, format string, args ...any) {
+		v.Problems = append(v.Problems, Problem{
+			Detail: fmt.Sprintf(format, args...),
+			Input:  input,
+			Kind:   kind,
+			Line:   lineNumber,
+			Seq:    seq,
+		})
+	}
+
+	e, ok := parseLine(line)
+	if !ok {
+		add(ProblemMalformed, 0, "line has no %s, %s and %s", SeqKey, PrevHashKey, HashKey)
+		return
+	}
+
+	if subtle.ConstantTimeCompare([]byte(Sum(v.hmacKey, e.canonical)), []byte(e.hash)) != 1 {
+		add(ProblemModified, e.seq, "seq %d does not match its hash", e.seq)
+	}
+
+	switch {
+	case !v.started:
+	case e.seq == 1 && e.prevHash == "":
+		// a restart looks exactly like lines cut from the end of a chain followed by another chain
+		v.Restarts++
+		if !v.AllowRestarts {
+			add(ProblemRestart, e.seq, "a new chain starts after seq %d", v.prevSeq)
+		}
+	case e.seq <= v.prevSeq:
+		add(ProblemReordered, e.seq, "seq %d follows seq %d", e.seq, v.prevSeq)
+	case e.seq > v.prevSeq+1:
+		add(ProblemGap, e.seq, "seq %d to %d are missing", v.prevSeq+1, e.seq-1)
+	case e.prevHash != v.prevHash:
+		add(ProblemBrokenLink, e.seq, "%s of seq %d does not match the hash of seq %d", PrevHashKey, e.seq, v.prevSeq)
+	}
+
+	v.started = true
+	v.prevSeq = e.seq
+	v.prevHash = e.hash
+}
@@ -0,0 +1,131 @@
+package slaudit
+
+import (
+	"bytes"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func chainedLines(t *testing.T, count int, options ...func(*Writer)) []string {
+	var buf bytes.Buffer
+	logger := zerolog.New(NewWriter(&buf, options...))
+	for i := 0; i < count; i++ {
+		logger.Info().Int("i", i).Msg("event")
+	}
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, count)
+
+	return lines
+}
+
+func verify(t *testing.T, lines []string, options ...func(*Writer)) *Verifier {
+	v := NewVerifier(options...)
+	require.NoError(t, v.Verify("app.log", strings.NewReader(strings.Join(lines, "\n")+"\n")))
+
+	return v
+}
+
+func kinds(v *Verifier) []ProblemKind {
+	var res []ProblemKind
+	for _, problem := range v.Problems {
+		res = append(res, problem.Kind)
+	}
+
+	return res
+}
+
+func TestVerifier(t *testing.T) {
+	lines := chainedLines(t, 5)
+
+	t.Run("intact", func(t *testing.T) {
+		v := verify(t, lines)
+		assert.True(t, v.OK())
+		assert.Equal(t, 5, v.Lines)
+		assert.Equal(t, 0, v.Restarts)
+	})
+
+	t.Run("modified", func(t *testing.T) {
+		modified := append([]string{}, lines...)
+		modified[2] = strings.Replace(modified[2], `"i":2`, `"i":7`, 1)
+
+		v := verify(t, modified)
+		require.Equal(t, []ProblemKind{ProblemModified}, kinds(v))
+		assert.Equal(t, "app.log:3: modified: seq 3 does not match its hash", v.Problems[0].String())
+	})
+
+	t.Run("gap", func(t *testing.T) {
+		v := verify(t, append(append([]string{}, lines[:1]...), lines[3:]...))
+		require.Equal(t, []ProblemKind{ProblemGap}, kinds(v))
+		assert.Equal(t, "seq 2 to 3 are missing", v.Problems[0].Detail)
+	})
+
+	t.Run("reordered", func(t *testing.T) {
+		v := verify(t, []string{lines[0], lines[2], lines[1], lines[3]})
+		assert.Equal(t, []ProblemKind{ProblemGap, ProblemReordered, ProblemGap}, kinds(v))
+	})
+
+	t.Run("rehashed line", func(t *testing.T) {
+		// an edited line with a recomputed hash still breaks the link of the line after it
+		var buf bytes.Buffer
+		_, err := NewWriter(&buf, WithState(1, strings.Repeat("0", 64))).Write([]byte(`{"i":1,"message":"forged"}`))
+		require.NoError(t, err)
+
+		v := verify(t, []string{lines[0], strings.TrimSpace(buf.String()), lines[2]})
+		assert.Equal(t, []ProblemKind{ProblemBrokenLink, ProblemBrokenLink}, kinds(v))
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		v := verify(t, []string{lines[0], `{"level":"info"}`, lines[1]})
+		assert.Equal(t, []ProblemKind{ProblemMalformed}, kinds(v))
+	})
+
+	t.Run("restarts and rotated files", func(t *testing.T) {
+		restarted := append(append([]string{}, lines[2:]...), chainedLines(t, 2)...)
+		v := verify(t, restarted)
+		assert.Equal(t, []ProblemKind{ProblemRestart}, kinds(v))
+		assert.Equal(t, 1, v.Restarts)
+
+		v = NewVerifier()
+		v.AllowRestarts = true
+		require.NoError(t, v.Verify("app.log", strings.NewReader(strings.Join(restarted, "\n"))))
+		assert.True(t, v.OK(), v.Problems)
+		assert.Equal(t, 1, v.Restarts)
+
+		v = NewVerifier()
+		require.NoError(t, v.Verify("app.log.1", strings.NewReader(strings.Join(lines[:3], "\n"))))
+		require.NoError(t, v.Verify("app.log", strings.NewReader(strings.Join(lines[3:], "\n"))))
+		assert.True(t, v.OK(), v.Problems)
+	})
+
+	t.Run("spliced chains", func(t *testing.T) {
+		// the end of the chain is cut and a forged chain appended to it
+		forged := chainedLines(t, 3)
+		spliced := append(append([]string{}, lines[:3]...), forged...)
+
+		v := verify(t, spliced)
+		require.Len(t, v.Problems, 1)
+		assert.Equal(t, ProblemRestart, v.Problems[0].Kind)
+		assert.Equal(t, 4, v.Problems[0].Line)
+		assert.Equal(t, "app.log:4: restart: a new chain starts after seq 3", v.Problems[0].String())
+
+		// a forged chain inserted in the middle is reported even when restarts are allowed
+		v = NewVerifier()
+		v.AllowRestarts = true
+		inserted := append(append(append([]string{}, lines[:2]...), forged[0]), lines[2:]...)
+		require.NoError(t, v.Verify("app.log", strings.NewReader(strings.Join(inserted, "\n"))))
+		assert.Equal(t, []ProblemKind{ProblemGap}, kinds(v))
+	})
+
+	t.Run("HMAC", func(t *testing.T) {
+		key := WithHMACKey([]byte("key"))
+		signed := chainedLines(t, 3, key)
+
+		assert.True(t, verify(t, signed, key).OK())
+		assert.Equal(t, []ProblemKind{ProblemModified, ProblemModified, ProblemModified}, kinds(verify(t, signed)))
+		assert.Equal(t, []ProblemKind{ProblemModified, ProblemModified, ProblemModified}, kinds(verify(t, signed, WithHMACKey([]byte("other")))))
+	})
+}
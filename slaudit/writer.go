@@ -0,0 +1,175 @@
+// Package slaudit makes zerolog output tamper-evident by chaining every log line to the one before it.
+//
+// Writer appends a seq counter, the hash of the previous line as prevHash and the hash of the line itself as hash to
+// every event. The hash is the hex SHA-256, or HMAC-SHA256 when a key is given, of the exact bytes of the line
+// without its hash field, so editing, removing, inserting or reordering lines breaks the chain. Verifier detects
+// those breaks.
+//
+// Without a key anybody able to rewrite the whole file can recompute every hash, so use a key kept away from the
+// logs when the logs themselves cannot be trusted.
+//
+//	logger := zerolog.New(slaudit.NewWriter(file, slaudit.WithHMACKey(key)))
+package slaudit
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"io"
+	"strconv"
+	"sync"
+)
+
+const HashKey = "hash"
+const PrevHashKey = "prevHash"
+const SeqKey = "seq"
+
+var ErrNotJSONObject = errors.New("event is not a JSON object")
+
+// Writer chains the JSON events written to it and writes them to the wrapped writer. It is safe for concurrent use.
+type Writer struct {
+	hmacKey  []byte
+	mu       sync.Mutex
+	out      io.Writer
+	prevHash string
+	seq      uint64
+}
+
+// NewWriter returns a Writer writing to out. The chain starts at seq 1 with an empty prevHash unless WithState is
+// given.
+func NewWriter(out io.Writer, options ...func(*Writer)) *Writer {
+	w := &Writer{out: out}
+	for _, option := range options {
+		option(w)
+	}
+
+	return w
+}
+
+// WithHMACKey signs every line with HMAC-SHA256 and key instead of hashing it with plain SHA-256.
+func WithHMACKey(key []byte) func(*Writer) {
+	return func(w *Writer) {
+		w.hmacKey = key
+	}
+}
+
+// WithState continues an existing chain after the line with seq and hash, e.g. as returned by LastState for the
+// file being appended to.
+func WithState(seq uint64, hash string) func(*Writer) {
+	return func(w *Writer) {
+		w.seq = seq
+		w.prevHash = hash
+	}
+}
+
+// Write chains and writes a single JSON object, which is how zerolog writes its events.
+func (w *Writer) Write(p []byte) (int, error) {
+	event := bytes.TrimRight(p, "\r\n")
+	if len(event) < 2 || event[0] != '{' || event[len(event)-1] != '}' {
+		return 0, ErrNotJSONObject
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	seq := w.seq + 1
+
+	line := make([]byte, 0, len(event)+160)
+	line = append(line, event[:len(event)-1]...)
+	if len(bytes.TrimSpace(event[1:len(event)-1])) > 0 {
+		line = append(line, ',')
+	}
+	line = append(line, `"`+SeqKey+`":`...)
+	line = strconv.AppendUint(line, seq, 10)
+	line = append(line, `,"`+PrevHashKey+`":`...)
+	line = strconv.AppendQuote(line, w.prevHash)
+
+	sum := Sum(w.hmacKey, append(line, '}'))
+	line = append(line, `,"`+HashKey+`":"`...)
+	line = append(line, sum...)
+	line = append(line, "\"}\n"...)
+
+	if _, err := w.out.Write(line); err != nil {
+		return 0, err
+	}
+
+	w.seq = seq
+	w.prevHash = sum
+
+	return len(p), nil
+}
+
+// Sum returns the hex encoded hash of canonical, the line without its hash field, as Writer computes it.
+func Sum(hmacKey []byte, canonical []byte) string {
+	var h hash.Hash
+	if hmacKey != nil {
+		h = hmac.New(sha256.New, hmacKey)
+	} else {
+		h = sha256.New()
+	}
+
+	h.Write(canonical)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// LastState returns the seq and hash of the last chained line of r so a Writer appending to the same file can
+// continue its chain with WithState. It returns 0 and an empty hash if r has no chained lines.
+func LastState(r io.Reader) (uint64, string, error) {
+	var seq uint64
+	var last string
+
+	reader := bufio.NewReader(r)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if entry, ok := parseLine(bytes.TrimSpace(line)); ok {
+			seq, last = entry.seq, entry.hash
+		}
+
+		if errors.Is(err, io.EOF) {
+			return seq, last, nil
+		} else if err != nil {
+			return 0, "", err
+		}
+	}
+}
+
+// entry is a chained line split into the parts Verifier checks
+type entry struct {
+	canonical []byte
+	hash      string
+	prevHash  string
+	seq       uint64
+}
+
+// parseLine splits a line written by Writer. It reports false for lines that are not chained.
+func parseLine(line []byte) (entry, bool) {
+	suffix := []byte(`,"` + HashKey + `":"`)
+	index := bytes.LastIndex(line, suffix)
+	if index < 0 || !bytes.HasSuffix(line, []byte(`"}`)) {
+		return entry{}, false
+	}
+
+	var fields struct {
+		PrevHash *string `json:"prevHash"`
+		Seq      *uint64 `json:"seq"`
+	}
+	if err := json.Unmarshal(line, &fields); err != nil || fields.Seq == nil || fields.PrevHash == nil {
+		return entry{}, false
+	}
+
+	canonical := make([]byte, 0, index+1)
+	canonical = append(canonical, line[:index]...)
+	canonical = append(canonical, '}')
+
+	return entry{
+		canonical: canonical,
+		hash:      string(line[index+len(suffix) : len(line)-2]),
+		prevHash:  *fields.PrevHash,
+		seq:       *fields.Seq,
+	}, true
+}
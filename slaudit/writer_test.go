@@ -0,0 +1,97 @@
+package slaudit
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	logger := zerolog.New(NewWriter(&buf))
+	logger.Info().Str("user", "a").Msg("first")
+	logger.Error().Msg("second")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	require.Len(t, lines, 2)
+
+	first := Sum(nil, []byte(`{"level":"info","user":"a","message":"first","seq":1,"prevHash":""}`))
+	assert.Equal(t, `{"level":"info","user":"a","message":"first","seq":1,"prevHash":"","hash":"`+first+`"}`, lines[0])
+
+	var second map[string]any
+	require.NoError(t, json.Unmarshal([]byte(lines[1]), &second))
+	assert.Equal(t, float64(2), second[SeqKey])
+	assert.Equal(t, first, second[PrevHashKey])
+	assert.Len(t, second[HashKey], 64)
+
+	t.Run("HMAC", func(t *testing.T) {
+		var signed bytes.Buffer
+		_, err := NewWriter(&signed, WithHMACKey([]byte("key"))).Write([]byte(`{}` + "\n"))
+		require.NoError(t, err)
+
+		sum := Sum([]byte("key"), []byte(`{"seq":1,"prevHash":""}`))
+		assert.NotEqual(t, Sum(nil, []byte(`{"seq":1,"prevHash":""}`)), sum)
+		assert.Equal(t, `{"seq":1,"prevHash":"","hash":"`+sum+`"}`+"\n", signed.String())
+	})
+
+	t.Run("continues an existing chain", func(t *testing.T) {
+		seq, hash, err := LastState(strings.NewReader(buf.String() + "not chained\n"))
+		require.NoError(t, err)
+		assert.Equal(t, uint64(2), seq)
+		assert.Equal(t, second[HashKey], hash)
+
+		_, err = NewWriter(&buf, WithState(seq, hash)).Write([]byte(`{"message":"third"}`))
+		require.NoError(t, err)
+
+		v := NewVerifier()
+		require.NoError(t, v.Verify("app.log", &buf))
+		assert.True(t, v.OK(), v.Problems)
+		assert.Equal(t, 3, v.Lines)
+	})
+
+	t.Run("rejects anything but JSON objects", func(t *testing.T) {
+		_, err := NewWriter(&buf).Write([]byte("plain text\n"))
+		assert.ErrorIs(t, err, ErrNotJSONObject)
+	})
+
+	t.Run("failed writes do not advance the chain", func(t *testing.T) {
+		w := NewWriter(failingWriter{})
+		_, err := w.Write([]byte(`{}`))
+		assert.Error(t, err)
+		assert.Equal(t, uint64(0), w.seq)
+	})
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+func TestWriter_Concurrent(t *testing.T) {
+	var buf bytes.Buffer
+	logger := zerolog.New(NewWriter(&buf))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				logger.Info().Int("j", j).Send()
+			}
+		}()
+	}
+	wg.Wait()
+
+	v := NewVerifier()
+	require.NoError(t, v.Verify("app.log", &buf))
+	assert.True(t, v.OK(), v.Problems)
+	assert.Equal(t, 100, v.Lines)
+}
@@ -0,0 +1,227 @@
+package slconsole
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slapi"
+	"github.com/seantcanavan/zerolog-json-structured-logs/sldb"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// MaxQueryLength is the number of characters of a DatabaseError query shown before it is cut off
+var MaxQueryLength = 40
+
+const (
+	colorRed      = 31
+	colorGreen    = 32
+	colorYellow   = 33
+	colorBlue     = 34
+	colorDarkGray = 90
+)
+
+// NewConsoleWriter returns a zerolog.ConsoleWriter that renders the sl object of every line as a one line summary
+// colored by level, followed by the wrapped error chain indented below it. The options are applied last so
+// any setting can be overridden.
+func NewConsoleWriter(options ...func(w *zerolog.ConsoleWriter)) zerolog.ConsoleWriter {
+	w := zerolog.NewConsoleWriter()
+	w.FieldsExclude = append(w.FieldsExclude, slutil.ZLObjectKey)
+	if slutil.LogEncoding.ObjectKey != "" {
+		w.FieldsExclude = append(w.FieldsExclude, slutil.LogEncoding.ObjectKey)
+	}
+	w.FormatExtra = func(evt map[string]any, buf *bytes.Buffer) error {
+		fields, ok := slutil.LogObject(evt)
+		if !ok {
+			return nil
+		}
+
+		level, _ := evt[zerolog.LevelFieldName].(string)
+		if buf.Len() > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(colorize(Summary(fields), levelColor(level), w.NoColor))
+
+		for _, line := range ChainLines(fields) {
+			buf.WriteByte('\n')
+			buf.WriteString(colorize(line, colorDarkGray, w.NoColor))
+		}
+
+		return nil
+	}
+
+	for _, option := range options {
+		option(&w)
+	}
+
+	return w
+}
+
+// Summary renders an sl object as a single line such as
+// 503 GET /users/{id} req=abc api.GetUser:42 → DB Connection Failed users (SELECT ...)
+func Summary(fields map[string]any) string {
+	var parts []string
+	if isAPIError(fields) {
+		parts = appendNonEmpty(parts, str(fields, slapi.StatusCodeKey), str(fields, slapi.MethodKey), str(fields, slapi.PathKey))
+		if requestID := str(fields, slapi.RequestIDKey); requestID != "" {
+			parts = append(parts, "req="+requestID)
+		}
+		parts = appendNonEmpty(parts, origin(fields))
+		if message := str(fields, slapi.MessageKey); message != "" && message != slapi.DefaultAPIErrorMessage {
+			parts = append(parts, strconv.Quote(message))
+		}
+	} else if isDBError(fields) {
+		parts = append(parts, dbSummary(fields))
+		parts = appendNonEmpty(parts, origin(fields))
+	} else {
+		parts = appendNonEmpty(parts, origin(fields), str(fields, slapi.MessageKey))
+	}
+
+	if cause := causeSummary(fields); cause != "" {
+		parts = append(parts, "→", cause)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// ChainLines renders every link of the logged chain of an sl object indented by its depth.
+func ChainLines(fields map[string]any) []string {
+	links, _ := fields[slutil.ChainKey].([]any)
+
+	var lines []string
+	for _, link := range links {
+		linkFields, ok := link.(map[string]any)
+		if !ok {
+			continue
+		}
+
+		depth, _ := strconv.Atoi(str(linkFields, slutil.ChainDepthKey))
+		var rendered string
+		switch {
+		case isAPIError(linkFields), isDBError(linkFields):
+			rendered = Summary(withoutCause(linkFields))
+		default:
+			rendered = str(linkFields, slutil.ChainMessageKey)
+		}
+
+		lines = append(lines, fmt.Sprintf("%s↳ %s %s", strings.Repeat("  ", depth+1), str(linkFields, slutil.ChainErrorTypeKey), rendered))
+	}
+
+	return lines
+}
+
+// causeSummary describes the most relevant wrapped error: the first APIError or DatabaseError in the logged
+// chain, or the inner error itself when no chain was logged
+func causeSummary(fields map[string]any) string {
+	links, _ := fields[slutil.ChainKey].([]any)
+	for _, link := range links {
+		if linkFields, ok := link.(map[string]any); ok && isDBError(linkFields) {
+			return dbSummary(linkFields)
+		}
+	}
+
+	switch inner := fields[slapi.InnerErrorKey].(type) {
+	case map[string]any:
+		if isDBError(inner) {
+			return dbSummary(inner)
+		}
+		return Summary(inner)
+	case string:
+		return inner
+	}
+
+	return ""
+}
+
+func dbSummary(fields map[string]any) string {
+	parts := appendNonEmpty([]string{"DB"}, str(fields, sldb.TypeKey), str(fields, sldb.TableNameKey))
+	if query := str(fields, sldb.QueryKey); query != "" {
+		if len([]rune(query)) > MaxQueryLength {
+			query = string([]rune(query)[:MaxQueryLength]) + "..."
+		}
+		parts = append(parts, "("+query+")")
+	}
+
+	return strings.Join(parts, " ")
+}
+
+func origin(fields map[string]any) string {
+	function := str(fields, slapi.FunctionKey)
+	if function == "" {
+		return ""
+	}
+
+	return fmt.Sprintf("%s.%s:%s", str(fields, slapi.PackageKey), function, str(fields, slapi.LineKey))
+}
+
+func isAPIError(fields map[string]any) bool {
+	_, ok := fields[slapi.StatusCodeKey]
+	return ok
+}
+
+func isDBError(fields map[string]any) bool {
+	_, hasTable := fields[sldb.TableNameKey]
+	_, hasType := fields[sldb.TypeKey]
+	return !isAPIError(fields) && (hasTable || hasType)
+}
+
+func withoutCause(fields map[string]any) map[string]any {
+	res := make(map[string]any, len(fields))
+	for key, value := range fields {
+		if key != slapi.InnerErrorKey && key != slutil.ChainKey {
+			res[key] = value
+		}
+	}
+
+	return res
+}
+
+// str renders the value stored under key whether it was decoded as a string, a json.Number or a float64
+func str(fields map[string]any, key string) string {
+	switch x := fields[key].(type) {
+	case string:
+		return x
+	case json.Number:
+		return x.String()
+	case float64:
+		return strconv.FormatFloat(x, 'f', -1, 64)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprintf("%v", x)
+	}
+}
+
+func appendNonEmpty(parts []string, values ...string) []string {
+	for _, value := range values {
+		if value != "" {
+			parts = append(parts, value)
+		}
+	}
+
+	return parts
+}
+
+func levelColor(level string) int {
+	switch level {
+	case zerolog.LevelErrorValue, zerolog.LevelFatalValue, zerolog.LevelPanicValue:
+		return colorRed
+	case zerolog.LevelWarnValue:
+		return colorYellow
+	case zerolog.LevelInfoValue:
+		return colorGreen
+	default:
+		return colorBlue
+	}
+}
+
+func colorize(s string, color int, disabled bool) string {
+	if disabled || os.Getenv("NO_COLOR") != "" {
+		return s
+	}
+
+	return fmt.Sprintf("\x1b[%dm%s\x1b[0m", color, s)
+}
@@ -0,0 +1,114 @@
+package slconsole
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slapi"
+	"github.com/seantcanavan/zerolog-json-structured-logs/sldb"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func testErrors() (*slapi.APIError, *sldb.DatabaseError) {
+	dbErr := &sldb.DatabaseError{
+		ExecContext: slutil.ExecContext{Function: "FindUser", Line: 12, Package: "repo"},
+		InnerError:  errors.New("dial tcp: connection refused"),
+		Message:     "could not load user",
+		Query:       "SELECT id, name, email, created_at FROM users WHERE id = $1",
+		TableName:   "users",
+		Type:        sldb.ErrDBConnectionFailed,
+	}
+
+	apiErr := &slapi.APIError{
+		ExecContext: slutil.ExecContext{Function: "GetUser", Line: 42, Package: "api"},
+		InnerError:  fmt.Errorf("wrapping error %w", dbErr),
+		Message:     slapi.DefaultAPIErrorMessage,
+		Method:      "GET",
+		Path:        "/users/{id}",
+		RequestID:   "abc",
+		StatusCode:  503,
+	}
+
+	return apiErr, dbErr
+}
+
+func renderLine(t *testing.T, log func(logger zerolog.Logger)) string {
+	var jsonLine bytes.Buffer
+	log(zerolog.New(&jsonLine).With().Timestamp().Logger())
+
+	var rendered bytes.Buffer
+	w := NewConsoleWriter(func(w *zerolog.ConsoleWriter) {
+		w.Out = &rendered
+		w.NoColor = true
+		w.PartsExclude = []string{zerolog.TimestampFieldName}
+	})
+
+	_, err := w.Write(jsonLine.Bytes())
+	require.NoError(t, err)
+
+	return strings.TrimRight(rendered.String(), "\n")
+}
+
+func TestNewConsoleWriter(t *testing.T) {
+	apiErr, dbErr := testErrors()
+
+	t.Run("api error with chain", func(t *testing.T) {
+		slutil.LogErrorChain = true
+		defer func() { slutil.LogErrorChain = false }()
+
+		rendered := renderLine(t, func(logger zerolog.Logger) {
+			logger.Error().Object(slutil.ZLObjectKey, apiErr).Send()
+		})
+
+		lines := strings.Split(rendered, "\n")
+		require.Len(t, lines, 4)
+		assert.Equal(t, "ERR 503 GET /users/{id} req=abc api.GetUser:42 → DB Connection Failed users (SELECT id, name, email, created_at FROM ...)", lines[0])
+		assert.Equal(t, "  ↳ *fmt.wrapError wrapping error [DatabaseError]  operation on .users with query: SELECT id, name, email, created_at FROM users WHERE id = $1 - could not load user - dial tcp: connection refused", lines[1])
+		assert.Equal(t, "    ↳ *sldb.DatabaseError DB Connection Failed users (SELECT id, name, email, created_at FROM ...) repo.FindUser:12", lines[2])
+		assert.Equal(t, "      ↳ *errors.errorString dial tcp: connection refused", lines[3])
+	})
+
+	t.Run("api error without chain uses the inner error", func(t *testing.T) {
+		rendered := renderLine(t, func(logger zerolog.Logger) {
+			logger.Error().Object(slutil.ZLObjectKey, &slapi.APIError{StatusCode: 404, Message: "user not found", InnerError: errors.New("no rows")}).Send()
+		})
+
+		assert.Equal(t, `ERR 404 "user not found" → no rows`, rendered)
+	})
+
+	t.Run("database error", func(t *testing.T) {
+		rendered := renderLine(t, func(logger zerolog.Logger) {
+			logger.Warn().Object(slutil.ZLObjectKey, dbErr).Msg(dbErr.Message)
+		})
+
+		assert.Equal(t, "WRN could not load user DB Connection Failed users (SELECT id, name, email, created_at FROM ...) repo.FindUser:12 → dial tcp: connection refused", rendered)
+	})
+
+	t.Run("lines without an sl object are rendered as usual", func(t *testing.T) {
+		rendered := renderLine(t, func(logger zerolog.Logger) {
+			logger.Info().Str("port", "8080").Msg("listening")
+		})
+
+		assert.Equal(t, "INF listening port=8080", rendered)
+	})
+}
+
+func TestSummary_Colors(t *testing.T) {
+	apiErr, _ := testErrors()
+
+	var jsonLine, rendered bytes.Buffer
+	logger := zerolog.New(&jsonLine)
+	logger.Error().Object(slutil.ZLObjectKey, apiErr).Send()
+
+	t.Setenv("NO_COLOR", "")
+	w := NewConsoleWriter(func(w *zerolog.ConsoleWriter) { w.Out = &rendered })
+	_, err := w.Write(jsonLine.Bytes())
+	require.NoError(t, err)
+
+	assert.Contains(t, rendered.String(), "\x1b[31m503 GET /users/{id}")
+}
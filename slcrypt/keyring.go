@@ -0,0 +1,186 @@
+// Package slcrypt encrypts sensitive identifiers such as APIError.OwnerID with AES-GCM before they are logged so
+// they can be recovered later by whoever holds the key.
+//
+// Encrypted values are logged as enc:<kid>:<base64url nonce and ciphertext>. The kid names the key that was used so
+// keys can be rotated while older logs stay readable. The name of the field is authenticated as additional data so
+// a value cannot be moved to another field unnoticed.
+//
+//	keyring, err := slcrypt.NewKeyring("2024-01", map[string][]byte{"2024-01": key})
+//	slutil.Encryption = keyring
+package slcrypt
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slapi"
+	"strings"
+)
+
+// Prefix starts every encrypted value.
+const Prefix = "enc:"
+
+// FailedMask is logged instead of a selected value that could not be encrypted, so the value never ends up in the
+// log in clear text.
+const FailedMask = "[ENCRYPTION FAILED]"
+
+// DefaultFields are the fields a Keyring encrypts unless Fields is set.
+var DefaultFields = []string{slapi.CallerIDKey, slapi.OwnerIDKey}
+
+var ErrNotEncrypted = errors.New("value is not encrypted")
+var ErrUnknownKey = errors.New("unknown key ID")
+
+// Keyring holds the AES keys by key ID and encrypts with the active one.
+type Keyring struct {
+	Active string
+	Fields []string // the logged field names to encrypt, DefaultFields if nil
+
+	aeads map[string]cipher.AEAD
+}
+
+// NewKeyring returns a Keyring encrypting with the key with ID active, which has to be one of keys. Keys have to be
+// 16, 24 or 32 bytes long for AES-128, AES-192 or AES-256.
+func NewKeyring(active string, keys map[string][]byte) (*Keyring, error) {
+	if _, ok := keys[active]; !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownKey, active)
+	}
+
+	return newKeyring(active, keys)
+}
+
+// NewDecryptOnlyKeyring returns a Keyring without an active key, e.g. for reading logs back. Its EncryptField logs
+// FailedMask for every selected field.
+func NewDecryptOnlyKeyring(keys map[string][]byte) (*Keyring, error) {
+	return newKeyring("", keys)
+}
+
+func newKeyring(active string, keys map[string][]byte) (*Keyring, error) {
+	k := &Keyring{Active: active, aeads: make(map[string]cipher.AEAD, len(keys))}
+	for kid, key := range keys {
+		if kid == "" || strings.Contains(kid, ":") {
+			return nil, fmt.Errorf("invalid key ID %q", kid)
+		}
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %s: %w", kid, err)
+		}
+
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("invalid key %s: %w", kid, err)
+		}
+		k.aeads[kid] = aead
+	}
+
+	return k, nil
+}
+
+// EncryptField implements slutil.FieldEncrypter. Values of fields that are not selected are returned unchanged, as
+// are values of selected fields this Keyring already encrypted for the field. Since logging must not fail, a value
+// that cannot be encrypted is replaced with FailedMask.
+func (k *Keyring) EncryptField(key, value string) string {
+	if !k.selected(key) {
+		return value
+	}
+
+	if _, err := k.Decrypt(key, value); err == nil {
+		return value
+	}
+
+	encrypted, err := k.Encrypt(key, value)
+	if err != nil {
+		return FailedMask
+	}
+
+	return encrypted
+}
+
+func (k *Keyring) selected(key string) bool {
+	fields := k.Fields
+	if fields == nil {
+		fields = DefaultFields
+	}
+
+	for _, field := range fields {
+		if field == key {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Encrypt encrypts the value of field with the active key.
+func (k *Keyring) Encrypt(field, value string) (string, error) {
+	aead, ok := k.aeads[k.Active]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownKey, k.Active)
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(value)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(value), []byte(field))
+	return Prefix + k.Active + ":" + base64.RawURLEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a value Encrypt produced for field with the key named in it.
+func (k *Keyring) Decrypt(field, value string) (string, error) {
+	kid, encoded, ok := strings.Cut(strings.TrimPrefix(value, Prefix), ":")
+	if !IsEncrypted(value) || !ok {
+		return "", ErrNotEncrypted
+	}
+
+	aead, ok := k.aeads[kid]
+	if !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnknownKey, kid)
+	}
+
+	sealed, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", fmt.Errorf("malformed %s value: %w", field, ErrNotEncrypted)
+	}
+
+	plain, err := aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], []byte(field))
+	if err != nil {
+		return "", fmt.Errorf("could not decrypt %s with key %s: %w", field, kid, err)
+	}
+
+	return string(plain), nil
+}
+
+// IsEncrypted reports whether value looks like a value produced by Encrypt.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, Prefix)
+}
+
+// GenerateKey returns a new random AES-256 key.
+func GenerateKey() ([]byte, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// ParseKey decodes a key given as hex or as standard base64.
+func ParseKey(encoded string) ([]byte, error) {
+	encoded = strings.TrimSpace(encoded)
+	if key, err := hex.DecodeString(encoded); err == nil {
+		return key, nil
+	}
+
+	if key, err := base64.StdEncoding.DecodeString(encoded); err == nil {
+		return key, nil
+	}
+
+	return nil, errors.New("key is neither hex nor base64")
+}
@@ -0,0 +1,149 @@
+package slcrypt
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/rs/zerolog"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slapi"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func testKeyring(t *testing.T) *Keyring {
+	oldKey, err := GenerateKey()
+	require.NoError(t, err)
+	newKey, err := GenerateKey()
+	require.NoError(t, err)
+
+	keyring, err := NewKeyring("new", map[string][]byte{"old": oldKey, "new": newKey})
+	require.NoError(t, err)
+
+	return keyring
+}
+
+func TestKeyring(t *testing.T) {
+	keyring := testKeyring(t)
+
+	encrypted, err := keyring.Encrypt(slapi.OwnerIDKey, "user-123")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(encrypted, "enc:new:"))
+	assert.NotContains(t, encrypted, "user-123")
+
+	again, err := keyring.Encrypt(slapi.OwnerIDKey, "user-123")
+	require.NoError(t, err)
+	assert.NotEqual(t, encrypted, again, "every encryption uses a new nonce")
+
+	decrypted, err := keyring.Decrypt(slapi.OwnerIDKey, encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "user-123", decrypted)
+
+	t.Run("values of another field are rejected", func(t *testing.T) {
+		_, err := keyring.Decrypt(slapi.CallerIDKey, encrypted)
+		assert.Error(t, err)
+	})
+
+	t.Run("rotated keys still decrypt", func(t *testing.T) {
+		keyring.Active = "old"
+		encrypted, err := keyring.Encrypt(slapi.OwnerIDKey, "user-456")
+		require.NoError(t, err)
+		keyring.Active = "new"
+
+		decrypted, err := keyring.Decrypt(slapi.OwnerIDKey, encrypted)
+		require.NoError(t, err)
+		assert.Equal(t, "user-456", decrypted)
+	})
+
+	t.Run("unknown keys and plain values", func(t *testing.T) {
+		_, err := keyring.Decrypt(slapi.OwnerIDKey, "enc:gone:AAAA")
+		assert.ErrorIs(t, err, ErrUnknownKey)
+
+		_, err = keyring.Decrypt(slapi.OwnerIDKey, "user-123")
+		assert.ErrorIs(t, err, ErrNotEncrypted)
+	})
+}
+
+func TestNewKeyring(t *testing.T) {
+	_, err := NewKeyring("missing", map[string][]byte{"k1": make([]byte, 32)})
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	_, err = NewKeyring("", map[string][]byte{"k1": make([]byte, 32)})
+	assert.ErrorIs(t, err, ErrUnknownKey)
+
+	_, err = NewKeyring("k1", map[string][]byte{"k1": make([]byte, 10)})
+	assert.Error(t, err)
+
+	_, err = NewKeyring("k:1", map[string][]byte{"k:1": make([]byte, 32)})
+	assert.Error(t, err)
+}
+
+func TestParseKey(t *testing.T) {
+	hexKey, err := ParseKey(strings.Repeat("ab", 16))
+	require.NoError(t, err)
+	assert.Len(t, hexKey, 16)
+
+	base64Key, err := ParseKey("AAECAwQFBgcICQoLDA0ODw==")
+	require.NoError(t, err)
+	assert.Len(t, base64Key, 16)
+
+	_, err = ParseKey("not a key!")
+	assert.Error(t, err)
+}
+
+func TestEncryptLoggedAPIError(t *testing.T) {
+	keyring := testKeyring(t)
+	slutil.Encryption = keyring
+	defer func() { slutil.Encryption = nil }()
+
+	apiErr := slapi.GenerateNonRandomAPIError()
+
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	logger.Error().Object(slutil.ZLObjectKey, &apiErr).Send()
+
+	var logged slutil.ZLJSONItem
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &logged))
+
+	ownerID := logged.ErrorAsJSON[slapi.OwnerIDKey].(string)
+	assert.True(t, IsEncrypted(ownerID))
+	assert.Equal(t, apiErr.OwnerType, logged.ErrorAsJSON[slapi.OwnerTypeKey], "fields that are not selected are logged as they are")
+
+	decrypted, err := keyring.Decrypt(slapi.OwnerIDKey, ownerID)
+	require.NoError(t, err)
+	assert.Equal(t, apiErr.OwnerID, decrypted)
+
+	callerID, err := keyring.Decrypt(slapi.CallerIDKey, logged.ErrorAsJSON[slapi.CallerIDKey].(string))
+	require.NoError(t, err)
+	assert.Equal(t, apiErr.CallerID, callerID)
+}
+
+func TestEncryptField(t *testing.T) {
+	keyring := testKeyring(t)
+
+	t.Run("values that merely look encrypted are encrypted", func(t *testing.T) {
+		encrypted := keyring.EncryptField(slapi.OwnerIDKey, "enc:alice")
+		assert.NotEqual(t, "enc:alice", encrypted)
+
+		decrypted, err := keyring.Decrypt(slapi.OwnerIDKey, encrypted)
+		require.NoError(t, err)
+		assert.Equal(t, "enc:alice", decrypted)
+	})
+
+	t.Run("values already encrypted for the field are kept", func(t *testing.T) {
+		encrypted, err := keyring.Encrypt(slapi.OwnerIDKey, "alice")
+		require.NoError(t, err)
+		assert.Equal(t, encrypted, keyring.EncryptField(slapi.OwnerIDKey, encrypted))
+		assert.NotEqual(t, encrypted, keyring.EncryptField(slapi.CallerIDKey, encrypted), "the value of another field is encrypted again")
+	})
+
+	t.Run("values that cannot be encrypted are masked", func(t *testing.T) {
+		decryptOnly, err := NewDecryptOnlyKeyring(map[string][]byte{"k1": make([]byte, 32)})
+		require.NoError(t, err)
+
+		assert.Equal(t, FailedMask, decryptOnly.EncryptField(slapi.OwnerIDKey, "alice@example.com"))
+		assert.Equal(t, FailedMask, (&Keyring{}).EncryptField(slapi.CallerIDKey, "alice@example.com"))
+		assert.Equal(t, "user", decryptOnly.EncryptField(slapi.OwnerTypeKey, "user"))
+	})
+}
@@ -1,13 +1,33 @@
 package sldb
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"github.com/seantcanavan/zerolog-json-structured-logs/sltrace"
 	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
 )
 
+const ConstraintKey = "constraint"
+const DBNameKey = "dbName"
+const FileKey = "file"
+const FunctionKey = "function"
+const InnerErrorKey = "innerError"
+const LineKey = "line"
+const MessageKey = "message"
+const ModuleKey = "module"
+const OperationKey = "operation"
+const PackageKey = "package"
+const QueryKey = "query"
+const RequestIDKey = "requestId"
+const SpanIDKey = "spanId"
+const TableNameKey = "tableName"
+const TraceIDKey = "traceId"
+const TypeKey = "type"
+
 // DatabaseError represents an error that occurred in the database layer of the application.
 // It includes details that might be relevant for debugging database issues.
 type DatabaseError struct {
@@ -17,10 +37,15 @@ type DatabaseError struct {
 	Message    string          `json:"message,omitempty"`
 	Operation  string          `json:"operation,omitempty"`
 	Query      string          `json:"query,omitempty"`
+	RequestID  string          `json:"requestId,omitempty"`
+	SpanID     string          `json:"spanId,omitempty"`
 	TableName  string          `json:"tableName,omitempty"`
+	TraceID    string          `json:"traceId,omitempty"`
 	Type       EnumDBErrorType `json:"type,omitempty"`
 
 	slutil.ExecContext `json:"execContext,omitempty"` // Embedded struct
+
+	logged bool // whether this error has already been written to the log
 }
 
 // Error returns the string representation of the DatabaseError.
@@ -34,6 +59,21 @@ func (e *DatabaseError) Unwrap() error {
 	return e.InnerError
 }
 
+// HTTPStatus translates the Type of the DatabaseError to an HTTP status code.
+func (e *DatabaseError) HTTPStatus() int {
+	return e.Type.HTTPStatus()
+}
+
+// Logged reports whether the DatabaseError has already been written to the log.
+func (e *DatabaseError) Logged() bool {
+	return e.logged
+}
+
+// MarkLogged records that the DatabaseError has been written to the log so it is not logged again.
+func (e *DatabaseError) MarkLogged() {
+	e.logged = true
+}
+
 // NewDBErr is required because we have to json.Marshal DatabaseError so execContext needs
 // to be public however we don't want users to have to provide that
 type NewDBErr struct {
@@ -43,11 +83,32 @@ type NewDBErr struct {
 	Message    string          `json:"message,omitempty"`
 	Operation  string          `json:"operation,omitempty"`
 	Query      string          `json:"query,omitempty"`
+	RequestID  string          `json:"requestId,omitempty"`
+	SpanID     string          `json:"spanId,omitempty"`
 	TableName  string          `json:"tableName,omitempty"`
+	TraceID    string          `json:"traceId,omitempty"`
 	Type       EnumDBErrorType `json:"type,omitempty"`
 }
 
 func LogNewDBErr(newDBErr NewDBErr) error {
+	return logNewDBErr(newDBErr, slutil.GetExecContext(3))
+}
+
+// LogNewDBErrCtx behaves like LogNewDBErr but takes the request ID and trace context from ctx when newDBErr does
+// not have them so that database errors can be correlated with the request and trace that caused them.
+func LogNewDBErrCtx(ctx context.Context, newDBErr NewDBErr) error {
+	if newDBErr.RequestID == "" {
+		newDBErr.RequestID = slutil.FromCtxSafe[string](ctx, RequestIDKey)
+	}
+
+	if newDBErr.TraceID == "" {
+		newDBErr.TraceID, newDBErr.SpanID = sltrace.IDs(ctx)
+	}
+
+	return logNewDBErr(newDBErr, slutil.GetExecContext(3))
+}
+
+func logNewDBErr(newDBErr NewDBErr, execCtx slutil.ExecContext) error {
 	if newDBErr.Message == "" {
 		newDBErr.Message = "A database error occurred"
 	}
@@ -55,42 +116,129 @@ func LogNewDBErr(newDBErr NewDBErr) error {
 	dbErr := DatabaseError{
 		Constraint:  newDBErr.Constraint,
 		DBName:      newDBErr.DBName,
-		ExecContext: slutil.GetExecContext(3),
+		ExecContext: execCtx,
 		InnerError:  fmt.Errorf("wrapping error %w", newDBErr.InnerError),
 		Message:     newDBErr.Message,
 		Operation:   newDBErr.Operation,
 		Query:       newDBErr.Query,
+		RequestID:   newDBErr.RequestID,
+		SpanID:      newDBErr.SpanID,
 		TableName:   newDBErr.TableName,
+		TraceID:     newDBErr.TraceID,
 		Type:        newDBErr.Type,
 	}
 
-	log.Error().
-		Object(slutil.ZLObjectKey, &dbErr).
-		Msg(newDBErr.Message)
+	// in boundary mode the error is only logged once by the outermost handler together with its chain
+	if slutil.ShouldLogEagerly() {
+		slutil.AddObject(log.Error(), &dbErr).
+			Msg(slutil.LimitMessage(newDBErr.Message))
+		slutil.MarkLogged(&dbErr)
+	}
 
 	return &dbErr
 }
 
 // MarshalZerologObject allows DatabaseError to be logged by zerolog.
 func (e *DatabaseError) MarshalZerologObject(zle *zerolog.Event) {
+	e.MarshalZerologFields(zle)
+	zle.Str(slutil.FingerprintKey, slutil.Fingerprint(e))
+	slutil.AddService(zle)
+	slutil.AddChain(zle, e.InnerError)
+}
+
+// FingerprintParts returns the fields that identify the kind of failure the DatabaseError describes.
+func (e *DatabaseError) FingerprintParts() []string {
+	return []string{
+		"db",
+		e.Type.String(),
+		e.Package,
+		e.Function,
+		slutil.NormalizeMessage(e.Message),
+		slutil.RootCauseType(e.InnerError),
+	}
+}
+
+// MarshalZerologFields logs the fields of DatabaseError without the chain of errors it wraps.
+func (e *DatabaseError) MarshalZerologFields(zle *zerolog.Event) {
+	var truncated slutil.Truncations
 	zle.
-		Int("line", e.Line).
-		Str("constraint", e.Constraint).
-		Str("dbName", e.DBName).
-		Str("file", e.File).
-		Str("function", e.Function).
-		Str("message", e.Message).
-		Str("operation", e.Operation).
-		Str("query", e.Query).
-		Str("type", e.Type.String()).
-		Str("tableName", e.TableName)
-
-	if e.InnerError != nil {
-		zle.AnErr("innerError", e.InnerError)
+		Int(LineKey, e.Line).
+		Str(ConstraintKey, e.Constraint).
+		Str(DBNameKey, e.DBName).
+		Str(FileKey, e.File).
+		Str(FunctionKey, e.Function).
+		Str(MessageKey, truncated.Text(MessageKey, e.Message, slutil.FieldLimits.Message)).
+		Str(ModuleKey, e.Module).
+		Str(OperationKey, e.Operation).
+		Str(PackageKey, e.Package).
+		Str(QueryKey, truncated.Text(QueryKey, e.Query, slutil.FieldLimits.Query)).
+		Str(RequestIDKey, e.RequestID).
+		Str(SpanIDKey, e.SpanID).
+		Str(TypeKey, e.Type.String()).
+		Str(TableNameKey, e.TableName).
+		Str(TraceIDKey, e.TraceID)
+
+	slutil.AddInnerError(zle, InnerErrorKey, e.InnerError, &truncated)
+	slutil.AddTruncated(zle, truncated)
+}
+
+func init() {
+	slutil.RegisterErrorType(func() error { return &DatabaseError{} })
+}
+
+// MarshalJSON encodes DatabaseError with the same field names MarshalZerologObject logs, including the
+// ExecContext fields and InnerError. Fields are encoded as they are, without redaction or truncation.
+func (e *DatabaseError) MarshalJSON() ([]byte, error) {
+	return slutil.MarshalFieldsJSON(map[string]any{
+		ConstraintKey:         e.Constraint,
+		DBNameKey:             e.DBName,
+		FileKey:               e.File,
+		FunctionKey:           e.Function,
+		LineKey:               e.Line,
+		MessageKey:            e.Message,
+		ModuleKey:             e.Module,
+		OperationKey:          e.Operation,
+		PackageKey:            e.Package,
+		QueryKey:              e.Query,
+		RequestIDKey:          e.RequestID,
+		SpanIDKey:             e.SpanID,
+		TableNameKey:          e.TableName,
+		TraceIDKey:            e.TraceID,
+		TypeKey:               e.Type.String(),
+		slutil.FingerprintKey: slutil.Fingerprint(e),
+	}, InnerErrorKey, e.InnerError)
+}
+
+// UnmarshalJSON decodes a DatabaseError produced by MarshalJSON or read back from a log line.
+// InnerError is restored as a plain error holding the logged message or as an *slutil.ObjectError
+// when it was logged as an object. Typed sl errors encoded by MarshalJSON are restored as their concrete type.
+func (e *DatabaseError) UnmarshalJSON(data []byte) error {
+	var obj slutil.JSONObject
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
 	}
+
+	return errors.Join(
+		obj.Decode(ConstraintKey, &e.Constraint),
+		obj.Decode(DBNameKey, &e.DBName),
+		obj.Decode(FileKey, &e.File),
+		obj.Decode(FunctionKey, &e.Function),
+		obj.DecodeError(InnerErrorKey, &e.InnerError),
+		obj.Decode(LineKey, &e.Line),
+		obj.Decode(MessageKey, &e.Message),
+		obj.Decode(ModuleKey, &e.Module),
+		obj.Decode(OperationKey, &e.Operation),
+		obj.Decode(PackageKey, &e.Package),
+		obj.Decode(QueryKey, &e.Query),
+		obj.Decode(RequestIDKey, &e.RequestID),
+		obj.Decode(SpanIDKey, &e.SpanID),
+		obj.Decode(TableNameKey, &e.TableName),
+		obj.Decode(TraceIDKey, &e.TraceID),
+		obj.Decode(TypeKey, &e.Type),
+	)
 }
 
-// FindOutermostDatabaseError returns the final APIError in the error chain.
+// FindOutermostDatabaseError returns the outermost DatabaseError in the error chain.
 func FindOutermostDatabaseError(err error) *DatabaseError {
 	res := FindDatabaseErrors(err)
 	if len(res) > 0 {
@@ -100,17 +248,8 @@ func FindOutermostDatabaseError(err error) *DatabaseError {
 	return nil
 }
 
-// FindDatabaseErrors returns a slice of all APIError found in the error chain.
+// FindDatabaseErrors returns a slice of all DatabaseError found in the error tree. Each DatabaseError is
+// returned once in depth-first order and errors joined with errors.Join are searched as well.
 func FindDatabaseErrors(err error) []*DatabaseError {
-	var errs []*DatabaseError
-	for {
-		var dbErr *DatabaseError
-		if errors.As(err, &dbErr) {
-			errs = append(errs, dbErr)
-		}
-		if err = errors.Unwrap(err); err == nil {
-			break
-		}
-	}
-	return errs
+	return slutil.FindAll[*DatabaseError](err)
 }
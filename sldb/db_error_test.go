@@ -1,11 +1,15 @@
 package sldb
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slredact"
+	"github.com/seantcanavan/zerolog-json-structured-logs/sltrace"
 	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -246,3 +250,197 @@ func TestFindLastDatabaseError(t *testing.T) {
 	assert.Equal(t, firstErrorUnwrapped.TableName, firstErrorUnwrapped.TableName)
 	assert.Equal(t, firstErrorUnwrapped.Type, firstErrorUnwrapped.Type)
 }
+
+func TestFindDatabaseErrors(t *testing.T) {
+	usersErr := &DatabaseError{TableName: "users", Type: ErrDBRecordNotFound, InnerError: errors.New("sql: no rows in result set")}
+	ordersErr := &DatabaseError{TableName: "orders", Type: ErrDBTimeout, InnerError: errors.New("context deadline exceeded")}
+	outerErr := &DatabaseError{TableName: "invoices", Type: ErrDBInvalidTransaction, InnerError: fmt.Errorf("wrapping error %w", usersErr)}
+
+	t.Run("each DatabaseError in a single chain is returned once", func(t *testing.T) {
+		found := FindDatabaseErrors(fmt.Errorf("wrapping error %w", outerErr))
+		require.Len(t, found, 2)
+		assert.Same(t, outerErr, found[0])
+		assert.Same(t, usersErr, found[1])
+	})
+
+	t.Run("DatabaseErrors joined with errors.Join are found", func(t *testing.T) {
+		found := FindDatabaseErrors(errors.Join(outerErr, ordersErr))
+		require.Len(t, found, 3)
+		assert.Same(t, outerErr, found[0])
+		assert.Same(t, usersErr, found[1])
+		assert.Same(t, ordersErr, found[2])
+
+		assert.Same(t, outerErr, FindOutermostDatabaseError(errors.Join(errors.New("plain"), outerErr)))
+	})
+
+	t.Run("no DatabaseError in the tree", func(t *testing.T) {
+		assert.Empty(t, FindDatabaseErrors(errors.New("plain")))
+		assert.Nil(t, FindOutermostDatabaseError(errors.New("plain")))
+	})
+}
+
+func TestDatabaseError_JSONRoundTrip(t *testing.T) {
+	slutil.Redaction = slredact.New()
+	slutil.FieldLimits = slutil.Limits{InnerError: 4, Message: 4, Query: 4}
+	defer func() {
+		slutil.Redaction = nil
+		slutil.FieldLimits = slutil.Limits{}
+	}()
+
+	dbErr := DatabaseError{
+		InnerError: errors.New("duplicate key jane@example.com"),
+		Message:    "could not insert jane@example.com",
+		Query:      "INSERT INTO users (email) VALUES ('jane@example.com')",
+		Type:       ErrDBDuplicateEntry,
+	}
+
+	marshalled, err := json.Marshal(&dbErr)
+	require.NoError(t, err)
+
+	// the JSON holds the fields as they are, only the log output is redacted and truncated
+	var decoded DatabaseError
+	require.NoError(t, json.Unmarshal(marshalled, &decoded))
+	assert.Equal(t, dbErr.Message, decoded.Message)
+	assert.Equal(t, dbErr.Query, decoded.Query)
+	assert.EqualError(t, decoded.InnerError, dbErr.InnerError.Error())
+	assert.NotContains(t, string(marshalled), slutil.TruncatedKey)
+}
+
+func TestDatabaseError_JSON(t *testing.T) {
+	dbErr := DatabaseError{
+		Constraint:  "pk_users",
+		DBName:      "testdb",
+		ExecContext: slutil.GetExecContext(1),
+		InnerError:  errors.New("sql: no rows in result set"),
+		Message:     "no users found",
+		Operation:   "SELECT",
+		Query:       "SELECT * FROM users",
+		TableName:   "users",
+		Type:        ErrDBRecordNotFound,
+	}
+
+	marshalled, err := json.Marshal(&dbErr)
+	require.NoError(t, err)
+
+	t.Run("json field names match the zerolog field names", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := zerolog.New(&buf)
+		logger.Error().Object(slutil.ZLObjectKey, &dbErr).Send()
+
+		var logged slutil.ZLJSONItem
+		require.NoError(t, json.Unmarshal(buf.Bytes(), &logged))
+
+		var jsonFields map[string]any
+		require.NoError(t, json.Unmarshal(marshalled, &jsonFields))
+
+		assert.Equal(t, logged.ErrorAsJSON, jsonFields)
+		assert.Equal(t, "sql: no rows in result set", jsonFields[InnerErrorKey])
+		assert.Equal(t, ErrDBRecordNotFound.String(), jsonFields[TypeKey])
+	})
+
+	t.Run("unmarshalling restores every field", func(t *testing.T) {
+		var decoded DatabaseError
+		require.NoError(t, json.Unmarshal(marshalled, &decoded))
+
+		assert.Equal(t, dbErr.Constraint, decoded.Constraint)
+		assert.Equal(t, dbErr.DBName, decoded.DBName)
+		assert.Equal(t, dbErr.ExecContext, decoded.ExecContext)
+		assert.Equal(t, dbErr.Message, decoded.Message)
+		assert.Equal(t, dbErr.Operation, decoded.Operation)
+		assert.Equal(t, dbErr.Query, decoded.Query)
+		assert.Equal(t, dbErr.TableName, decoded.TableName)
+		assert.Equal(t, dbErr.Type, decoded.Type)
+		assert.EqualError(t, decoded.InnerError, dbErr.InnerError.Error())
+		assert.Equal(t, dbErr.Error(), decoded.Error())
+	})
+
+	t.Run("unmarshalling rejects mistyped fields", func(t *testing.T) {
+		var decoded DatabaseError
+		assert.Error(t, json.Unmarshal([]byte(`{"line":"forty two"}`), &decoded))
+	})
+}
+
+func TestDatabaseError_Fingerprint(t *testing.T) {
+	first := &DatabaseError{Message: "user 1 not found", Query: "SELECT * FROM users WHERE id = 1", Type: ErrDBRecordNotFound, InnerError: errors.New("no rows")}
+	second := &DatabaseError{Message: "user 2 not found", Query: "SELECT * FROM users WHERE id = 2", Type: ErrDBRecordNotFound, InnerError: errors.New("no rows")}
+	assert.Equal(t, slutil.Fingerprint(first), slutil.Fingerprint(second))
+
+	second.Type = ErrDBTimeout
+	assert.NotEqual(t, slutil.Fingerprint(first), slutil.Fingerprint(second))
+
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	logger.Error().Object(slutil.ZLObjectKey, first).Send()
+
+	var logged slutil.ZLJSONItem
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &logged))
+	assert.Equal(t, slutil.Fingerprint(first), logged.ErrorAsJSON[slutil.FingerprintKey])
+}
+
+func TestLogNewDBErrCtx(t *testing.T) {
+	var buf bytes.Buffer
+	log.Logger = zerolog.New(&buf)
+	defer func() { log.Logger = zerolog.New(os.Stderr) }()
+
+	trace := sltrace.New()
+	ctx := sltrace.NewContext(context.WithValue(context.Background(), RequestIDKey, "req-123"), trace)
+
+	loggedErr := LogNewDBErrCtx(ctx, NewDBErr{TableName: "users", Type: ErrDBTimeout, InnerError: errors.New("timeout")})
+	explicitErr := LogNewDBErrCtx(ctx, NewDBErr{RequestID: "req-456", TableName: "users"})
+
+	assert.Equal(t, "req-123", FindOutermostDatabaseError(loggedErr).RequestID)
+	assert.Equal(t, "req-456", FindOutermostDatabaseError(explicitErr).RequestID)
+	assert.True(t, FindOutermostDatabaseError(loggedErr).Logged())
+
+	var logged slutil.ZLJSONItem
+	require.NoError(t, json.Unmarshal(bytes.Split(buf.Bytes(), []byte("\n"))[0], &logged))
+	assert.Equal(t, "req-123", logged.ErrorAsJSON[RequestIDKey])
+	assert.Equal(t, trace.TraceID, logged.ErrorAsJSON[TraceIDKey])
+	assert.Equal(t, trace.SpanID, logged.ErrorAsJSON[SpanIDKey])
+	assert.Equal(t, "tRunner", logged.ErrorAsJSON[FunctionKey]) // GetExecContext(3) reports the caller of the test function
+}
+
+func TestDatabaseError_Limits(t *testing.T) {
+	slutil.FieldLimits = slutil.Limits{InnerError: 8, Message: 100, Query: 20}
+	defer func() { slutil.FieldLimits = slutil.Limits{} }()
+
+	query := "INSERT INTO users VALUES " + strings.Repeat("('ü'),", 1000)
+	dbErr := DatabaseError{
+		InnerError: errors.New("pq: value too long"),
+		Message:    "bulk insert failed",
+		Query:      query,
+		Type:       ErrDBConstraintViolated,
+	}
+
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	logger.Error().Object(slutil.ZLObjectKey, &dbErr).Send()
+
+	var logged slutil.ZLJSONItem
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &logged))
+
+	assert.Equal(t, "INSERT INTO users VA", logged.ErrorAsJSON[QueryKey])
+	assert.Equal(t, "pq: valu", logged.ErrorAsJSON[InnerErrorKey])
+	assert.Equal(t, "bulk insert failed", logged.ErrorAsJSON[MessageKey])
+	assert.Equal(t, map[string]any{
+		InnerErrorKey: float64(18),
+		QueryKey:      float64(len(query)),
+	}, logged.ErrorAsJSON[slutil.TruncatedKey])
+}
+
+func TestLogNewDBErr_RedactsMessage(t *testing.T) {
+	var buf bytes.Buffer
+	log.Logger = zerolog.New(&buf)
+	defer func() { log.Logger = zerolog.New(os.Stderr) }()
+
+	slutil.Redaction = slredact.New()
+	defer func() { slutil.Redaction = nil }()
+
+	_ = LogNewDBErr(NewDBErr{Message: "no user jane@example.com", TableName: "users"})
+
+	assert.NotContains(t, buf.String(), "jane@example.com")
+
+	var line map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+	assert.Equal(t, "no user "+slredact.DefaultMask, line[zerolog.MessageFieldName])
+}
@@ -0,0 +1,276 @@
+// Package slecs writes logged errors in the Elastic Common Schema (ECS) so Elasticsearch and Kibana recognize their
+// fields without an ingest pipeline.
+//
+// Enable the ECS layout once at start-up, before anything is logged:
+//
+//	restore := slecs.Enable()
+//	defer restore()
+//
+// The fields of an error become dotted top-level keys such as error.message, http.request.method and db.statement,
+// next to ecs.version. Fields without an ECS counterpart, such as the request parameters, stay under the sl object.
+// Empty fields are left out.
+package slecs
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slapi"
+	"github.com/seantcanavan/zerolog-json-structured-logs/sldb"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slhttp"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
+	"strconv"
+	"strings"
+)
+
+// Version is the ECS version the fields are written for, logged under VersionKey.
+const Version = "8.11.0"
+
+const DBNameKey = "db.name"
+const DBOperationKey = "db.operation"
+const DBSQLTableKey = "db.sql.table"
+const DBStatementKey = "db.statement"
+const ErrorCodeKey = "error.code"
+const ErrorIDKey = "error.id"
+const ErrorMessageKey = "error.message"
+const ErrorStackTraceKey = "error.stack_trace"
+const ErrorTypeKey = "error.type"
+const HostHostnameKey = "host.hostname"
+const HTTPRequestIDKey = "http.request.id"
+const HTTPRequestMethodKey = "http.request.method"
+const HTTPResponseStatusCodeKey = "http.response.status_code"
+const LabelsCommitKey = "labels.commit"
+const LogLevelKey = "log.level"
+const LogOriginFileLineKey = "log.origin.file.line"
+const LogOriginFileNameKey = "log.origin.file.name"
+const LogOriginFunctionKey = "log.origin.function"
+const ProcessPIDKey = "process.pid"
+const ServiceEnvironmentKey = "service.environment"
+const ServiceNameKey = "service.name"
+const ServiceVersionKey = "service.version"
+const SpanIDKey = "span.id"
+const TimestampKey = "@timestamp"
+const TraceIDKey = "trace.id"
+const URLFullKey = "url.full"
+const URLPathKey = "url.path"
+const UserIDKey = "user.id"
+const UserTargetIDKey = "user.target.id"
+const VersionKey = "ecs.version"
+
+// field maps a declared key of the logged errors to its ECS field
+type field struct {
+	key  string
+	name string
+}
+
+// fields are written in this order when the logged error has a value for them
+var fields = []field{
+	{sldb.TypeKey, ErrorCodeKey},
+	{slutil.FingerprintKey, ErrorIDKey},
+	{slapi.MethodKey, HTTPRequestMethodKey},
+	{slapi.PathKey, URLPathKey},
+	{slhttp.URLKey, URLFullKey},
+	{slapi.StatusCodeKey, HTTPResponseStatusCodeKey},
+	{slapi.RequestIDKey, HTTPRequestIDKey},
+	{slapi.TraceIDKey, TraceIDKey},
+	{slapi.SpanIDKey, SpanIDKey},
+	{slapi.CallerIDKey, UserIDKey},
+	{slapi.OwnerIDKey, UserTargetIDKey},
+	{slapi.FileKey, LogOriginFileNameKey},
+	{slapi.LineKey, LogOriginFileLineKey},
+}
+
+// dbFields are taken from the first error of the chain that has them when the logged error has none, so an APIError
+// wrapping a DatabaseError still carries the statement that failed
+var dbFields = []field{
+	{sldb.QueryKey, DBStatementKey},
+	{sldb.DBNameKey, DBNameKey},
+	{sldb.OperationKey, DBOperationKey},
+	{sldb.TableNameKey, DBSQLTableKey},
+}
+
+// written are the declared keys that are not repeated under the sl object, either because they have an ECS field or
+// because error.message and error.stack_trace already hold them
+var written = []string{
+	slapi.FunctionKey, slapi.InnerErrorKey, slapi.MessageKey, slapi.PackageKey, slutil.ChainKey, slutil.ServiceKey,
+}
+
+// Formatter is a slutil.Formatter writing errors with ECS fields.
+type Formatter struct{}
+
+// Enable writes every logged error with a Formatter and renames the timestamp, level and error fields of zerolog to
+// their ECS names. It returns a function restoring the previous configuration.
+func Enable() func() {
+	format := slutil.OutputFormat
+	errorKey, levelKey, timestampKey := zerolog.ErrorFieldName, zerolog.LevelFieldName, zerolog.TimestampFieldName
+
+	slutil.OutputFormat = Formatter{}
+	zerolog.ErrorFieldName = ErrorMessageKey
+	zerolog.LevelFieldName = LogLevelKey
+	zerolog.TimestampFieldName = TimestampKey
+
+	return func() {
+		slutil.OutputFormat = format
+		zerolog.ErrorFieldName = errorKey
+		zerolog.LevelFieldName = levelKey
+		zerolog.TimestampFieldName = timestampKey
+	}
+}
+
+// FormatObject implements slutil.Formatter. The values are taken from the sl rendering of obj so they are redacted,
+// encrypted and truncated the same way.
+func (Formatter) FormatObject(zle *zerolog.Event, obj zerolog.LogObjectMarshaler) {
+	zle.Str(VersionKey, Version).Str(ErrorTypeKey, fmt.Sprintf("%T", obj))
+
+	var logged slutil.JSONObject
+	raw, err := slutil.MarshalObjectJSON(obj)
+	if err == nil {
+		err = json.Unmarshal(raw, &logged)
+	}
+	if err != nil {
+		zle.Object(slutil.ZLObjectKey, obj)
+		return
+	}
+
+	var links []slutil.JSONObject
+	if err, ok := obj.(error); ok {
+		links = slutil.ChainObjects(err)
+	}
+
+	if message := slutil.ErrorText(logged, obj); message != "" {
+		zle.Str(ErrorMessageKey, message)
+	}
+	if trace := stackTrace(links); trace != "" {
+		zle.Str(ErrorStackTraceKey, trace)
+	}
+
+	rest := make(map[string]json.RawMessage, len(logged))
+	for key, value := range logged {
+		if !isEmpty(value) {
+			rest[key] = value
+		}
+	}
+	for _, key := range written {
+		delete(rest, key)
+	}
+
+	for _, f := range fields {
+		if value, ok := logged[f.key]; ok {
+			addRaw(zle, f.name, value)
+			delete(rest, f.key)
+		}
+	}
+
+	if function := location(logged.Str(slapi.PackageKey), logged.Str(slapi.FunctionKey)); function != "" {
+		zle.Str(LogOriginFunctionKey, function)
+	}
+
+	for _, f := range dbFields {
+		delete(rest, f.key)
+		if value, ok := logged[f.key]; ok && !isEmpty(value) {
+			addRaw(zle, f.name, value)
+			continue
+		}
+
+		for _, link := range links {
+			if value, ok := link[f.key]; ok && !isEmpty(value) {
+				addRaw(zle, f.name, value)
+				break
+			}
+		}
+	}
+
+	addService(zle, logged)
+
+	if len(rest) > 0 {
+		if raw, err = json.Marshal(rest); err == nil {
+			zle.RawJSON(slutil.ZLObjectKey, raw)
+		}
+	}
+}
+
+func addService(zle *zerolog.Event, logged slutil.JSONObject) {
+	var service slutil.ServiceInfo
+	if err := logged.Decode(slutil.ServiceKey, &service); err != nil {
+		return
+	}
+
+	addStr(zle, ServiceNameKey, service.Name)
+	addStr(zle, ServiceVersionKey, service.Version)
+	addStr(zle, ServiceEnvironmentKey, service.Environment)
+	addStr(zle, HostHostnameKey, service.Host)
+	addStr(zle, LabelsCommitKey, service.Commit)
+
+	if service.PID != 0 {
+		zle.Int(ProcessPIDKey, service.PID)
+	}
+}
+
+// stackTrace describes every link of the chain on its own line, indented by its depth and followed by the function
+// that created it when known
+func stackTrace(links []slutil.JSONObject) string {
+	var b strings.Builder
+	for _, link := range links {
+		var truncated int
+		if link.Decode(slutil.TruncatedKey, &truncated) == nil && truncated > 0 {
+			fmt.Fprintf(&b, "... %d errors in total\n", truncated)
+			continue
+		}
+
+		var depth int
+		_ = link.Decode(slutil.ChainDepthKey, &depth)
+		indent := strings.Repeat("  ", depth)
+
+		b.WriteString(indent + link.Str(slutil.ChainErrorTypeKey))
+		if message := link.Str(slutil.ChainMessageKey); message != "" {
+			b.WriteString(": " + message)
+		}
+		b.WriteByte('\n')
+
+		function := location(link.Str(slapi.PackageKey), link.Str(slapi.FunctionKey))
+		if function == "" {
+			continue
+		}
+
+		b.WriteString(indent + "    at " + function)
+		if file := link.Str(slapi.FileKey); file != "" {
+			var line int
+			_ = link.Decode(slapi.LineKey, &line)
+			b.WriteString(" (" + file + ":" + strconv.Itoa(line) + ")")
+		}
+		b.WriteByte('\n')
+	}
+
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+// location qualifies function with its package, e.g. users.GetUser
+func location(pkg, function string) string {
+	if function == "" || pkg == "" {
+		return function
+	}
+
+	return pkg + "." + function
+}
+
+func addRaw(zle *zerolog.Event, key string, value json.RawMessage) {
+	if !isEmpty(value) {
+		zle.RawJSON(key, value)
+	}
+}
+
+func addStr(zle *zerolog.Event, key, value string) {
+	if value != "" {
+		zle.Str(key, value)
+	}
+}
+
+func isEmpty(value json.RawMessage) bool {
+	switch string(bytes.TrimSpace(value)) {
+	case `""`, `0`, `null`, `{}`, `[]`:
+		return true
+	default:
+		return false
+	}
+}
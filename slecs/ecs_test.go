@@ -0,0 +1,184 @@
+package slecs
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slapi"
+	"github.com/seantcanavan/zerolog-json-structured-logs/sldb"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+func logLine(t *testing.T, obj zerolog.LogObjectMarshaler) map[string]any {
+	t.Helper()
+
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	slutil.AddObject(logger.Error(), obj).Msg("failed")
+
+	var line map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+
+	return line
+}
+
+func testErrors() (*slapi.APIError, *sldb.DatabaseError) {
+	dbErr := &sldb.DatabaseError{
+		DBName:      "accounts",
+		InnerError:  errors.New("duplicate key"),
+		Message:     "could not insert user",
+		Operation:   "INSERT",
+		Query:       "INSERT INTO users (email) VALUES ($1)",
+		TableName:   "users",
+		Type:        sldb.ErrDBDuplicateEntry,
+		ExecContext: slutil.ExecContext{File: "/src/repo/users.go", Function: "InsertUser", Line: 17, Package: "repo"},
+	}
+	apiErr := &slapi.APIError{
+		CallerID:    "caller-1",
+		InnerError:  fmt.Errorf("wrapping error %w", dbErr),
+		Message:     "could not sign up",
+		Method:      "POST",
+		OwnerID:     "owner-1",
+		Path:        "/users",
+		PathParams:  map[string]string{"org": "acme"},
+		RequestID:   "req-1",
+		SpanID:      "00f067aa0ba902b7",
+		StatusCode:  409,
+		TraceID:     "4bf92f3577b34da6a3ce929d0e0e4736",
+		ExecContext: slutil.ExecContext{File: "/src/api/users.go", Function: "SignUp", Line: 42, Package: "api"},
+	}
+
+	return apiErr, dbErr
+}
+
+func TestFormatter_APIError(t *testing.T) {
+	restore := Enable()
+	defer restore()
+
+	apiErr, _ := testErrors()
+	line := logLine(t, apiErr)
+
+	assert.Equal(t, Version, line[VersionKey])
+	assert.Equal(t, "error", line[LogLevelKey])
+	assert.Equal(t, "*slapi.APIError", line[ErrorTypeKey])
+	assert.Equal(t, "could not sign up", line[ErrorMessageKey])
+	assert.Equal(t, slutil.Fingerprint(apiErr), line[ErrorIDKey])
+	assert.Equal(t, "POST", line[HTTPRequestMethodKey])
+	assert.Equal(t, "/users", line[URLPathKey])
+	assert.Equal(t, float64(409), line[HTTPResponseStatusCodeKey])
+	assert.Equal(t, "req-1", line[HTTPRequestIDKey])
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", line[TraceIDKey])
+	assert.Equal(t, "00f067aa0ba902b7", line[SpanIDKey])
+	assert.Equal(t, "caller-1", line[UserIDKey])
+	assert.Equal(t, "owner-1", line[UserTargetIDKey])
+	assert.Equal(t, "/src/api/users.go", line[LogOriginFileNameKey])
+	assert.Equal(t, float64(42), line[LogOriginFileLineKey])
+	assert.Equal(t, "api.SignUp", line[LogOriginFunctionKey])
+
+	// taken from the wrapped DatabaseError
+	assert.Equal(t, "INSERT INTO users (email) VALUES ($1)", line[DBStatementKey])
+	assert.Equal(t, "accounts", line[DBNameKey])
+	assert.Equal(t, "INSERT", line[DBOperationKey])
+	assert.Equal(t, "users", line[DBSQLTableKey])
+
+	assert.Equal(t, "*slapi.APIError: could not sign up\n"+
+		"    at api.SignUp (/src/api/users.go:42)\n"+
+		"  *fmt.wrapError: wrapping error [DatabaseError] INSERT operation on accounts.users with query: INSERT INTO users (email) VALUES ($1) - could not insert user - duplicate key\n"+
+		"    *sldb.DatabaseError: could not insert user\n"+
+		"        at repo.InsertUser (/src/repo/users.go:17)\n"+
+		"      *errors.errorString: duplicate key", line[ErrorStackTraceKey])
+
+	// fields without an ECS counterpart stay under the sl object
+	sl, ok := line[slutil.ZLObjectKey].(map[string]any)
+	require.True(t, ok)
+	assert.Equal(t, map[string]any{"org": "acme"}, sl[slapi.PathParamsKey])
+	assert.NotContains(t, sl, slapi.MessageKey)
+	assert.NotContains(t, sl, slapi.StatusCodeKey)
+	assert.NotContains(t, sl, slapi.InnerErrorKey)
+	assert.NotContains(t, line, "level")
+}
+
+func TestFormatter_DatabaseError(t *testing.T) {
+	restore := Enable()
+	defer restore()
+
+	_, dbErr := testErrors()
+	line := logLine(t, dbErr)
+
+	assert.Equal(t, Version, line[VersionKey])
+	assert.Equal(t, "*sldb.DatabaseError", line[ErrorTypeKey])
+	assert.Equal(t, "could not insert user", line[ErrorMessageKey])
+	assert.Equal(t, string(sldb.ErrDBDuplicateEntry), line[ErrorCodeKey])
+	assert.Equal(t, "INSERT INTO users (email) VALUES ($1)", line[DBStatementKey])
+	assert.Equal(t, "accounts", line[DBNameKey])
+	assert.Equal(t, "INSERT", line[DBOperationKey])
+	assert.Equal(t, "repo.InsertUser", line[LogOriginFunctionKey])
+	assert.NotContains(t, line, HTTPResponseStatusCodeKey)
+	assert.NotContains(t, line, TraceIDKey)
+}
+
+func TestFormatter_Service(t *testing.T) {
+	restore := Enable()
+	defer restore()
+
+	slutil.SetServiceInfo(slutil.ServiceInfo{Commit: "abc123", Environment: "prod", Host: "web-1", Name: "users", PID: 7, Version: "1.2.3"})
+	defer slutil.ClearServiceInfo()
+
+	_, dbErr := testErrors()
+	line := logLine(t, dbErr)
+
+	assert.Equal(t, "users", line[ServiceNameKey])
+	assert.Equal(t, "1.2.3", line[ServiceVersionKey])
+	assert.Equal(t, "prod", line[ServiceEnvironmentKey])
+	assert.Equal(t, "web-1", line[HostHostnameKey])
+	assert.Equal(t, "abc123", line[LabelsCommitKey])
+	assert.Equal(t, float64(7), line[ProcessPIDKey])
+	assert.NotContains(t, line, slutil.ZLObjectKey)
+}
+
+func TestFormatter_Redaction(t *testing.T) {
+	restore := Enable()
+	defer restore()
+
+	slutil.Redaction = maskRedactor{}
+	defer func() { slutil.Redaction = nil }()
+
+	line := logLine(t, &sldb.DatabaseError{Message: "no user secret", InnerError: errors.New("secret")})
+
+	assert.Equal(t, "no user [MASKED]", line[ErrorMessageKey])
+	assert.NotContains(t, line[ErrorStackTraceKey], "secret")
+}
+
+func TestEnable(t *testing.T) {
+	restore := Enable()
+	assert.Equal(t, TimestampKey, zerolog.TimestampFieldName)
+	assert.Equal(t, ErrorMessageKey, zerolog.ErrorFieldName)
+	restore()
+
+	assert.Nil(t, slutil.OutputFormat)
+	assert.Equal(t, "time", zerolog.TimestampFieldName)
+	assert.Equal(t, "level", zerolog.LevelFieldName)
+	assert.Equal(t, "error", zerolog.ErrorFieldName)
+
+	// the sl layout is the default
+	line := logLine(t, &sldb.DatabaseError{Message: "no user"})
+	assert.NotContains(t, line, VersionKey)
+	assert.Equal(t, "no user", line[slutil.ZLObjectKey].(map[string]any)[sldb.MessageKey])
+}
+
+// maskRedactor masks the word secret
+type maskRedactor struct{}
+
+func (maskRedactor) RedactParam(_, value string) (string, bool) {
+	return value, true
+}
+
+func (maskRedactor) RedactText(text string) string {
+	return strings.ReplaceAll(text, "secret", "[MASKED]")
+}
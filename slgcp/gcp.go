@@ -0,0 +1,224 @@
+// Package slgcp writes logged errors with the special fields of Google Cloud Logging so the request, source location
+// and trace of an error show up in the Logs Explorer and the error is picked up by Error Reporting.
+//
+// Enable the layout once at start-up, before anything is logged:
+//
+//	restore := slgcp.Enable("my-project")
+//	defer restore()
+//
+// The level becomes the severity of the entry and every error is written with httpRequest,
+// logging.googleapis.com/sourceLocation and logging.googleapis.com/trace. Errors that know the function they were
+// created in also get a stack_trace in the format of a Go panic and the @type of an Error Reporting event. The sl
+// object is kept with the declared keys.
+package slgcp
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slapi"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slhttp"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EnvProject is the environment variable Enable reads the project ID from when none is given.
+const EnvProject = "GOOGLE_CLOUD_PROJECT"
+
+// ReportedErrorEventType is the @type that makes Error Reporting process an entry whatever its severity.
+const ReportedErrorEventType = "type.googleapis.com/google.devtools.clouderrorreporting.v1beta1.ReportedErrorEvent"
+
+const HTTPRequestKey = "httpRequest"
+const SeverityKey = "severity"
+const ServiceContextKey = "serviceContext"
+const SourceLocationKey = "logging.googleapis.com/sourceLocation"
+const SpanIDKey = "logging.googleapis.com/spanId"
+const StackTraceKey = "stack_trace"
+const TraceKey = "logging.googleapis.com/trace"
+const TypeKey = "@type"
+
+// Formatter is a slutil.Formatter writing errors with the special fields of Cloud Logging.
+type Formatter struct {
+	ProjectID string // qualifies trace IDs as projects/ProjectID/traces/TraceID, written as they are if empty
+}
+
+// Enable writes every logged error with a Formatter for projectID, or the project of EnvProject if it is empty, and
+// writes the level of every line as its Cloud Logging severity. It returns a function restoring the previous
+// configuration.
+func Enable(projectID string) func() {
+	if projectID == "" {
+		projectID = os.Getenv(EnvProject)
+	}
+
+	format := slutil.OutputFormat
+	levelKey, levelFunc := zerolog.LevelFieldName, zerolog.LevelFieldMarshalFunc
+
+	slutil.OutputFormat = Formatter{ProjectID: projectID}
+	zerolog.LevelFieldName = SeverityKey
+	zerolog.LevelFieldMarshalFunc = Severity
+
+	return func() {
+		slutil.OutputFormat = format
+		zerolog.LevelFieldName = levelKey
+		zerolog.LevelFieldMarshalFunc = levelFunc
+	}
+}
+
+// Severity returns the Cloud Logging severity of level.
+func Severity(level zerolog.Level) string {
+	switch level {
+	case zerolog.TraceLevel, zerolog.DebugLevel:
+		return "DEBUG"
+	case zerolog.InfoLevel:
+		return "INFO"
+	case zerolog.WarnLevel:
+		return "WARNING"
+	case zerolog.ErrorLevel:
+		return "ERROR"
+	case zerolog.FatalLevel:
+		return "CRITICAL"
+	case zerolog.PanicLevel:
+		return "ALERT"
+	default:
+		return "DEFAULT"
+	}
+}
+
+// FormatObject implements slutil.Formatter. The values are taken from the sl rendering of obj so they are redacted,
+// encrypted and truncated the same way.
+func (f Formatter) FormatObject(zle *zerolog.Event, obj zerolog.LogObjectMarshaler) {
+	var logged slutil.JSONObject
+	raw, err := slutil.MarshalObjectJSON(obj)
+	if err == nil {
+		err = json.Unmarshal(raw, &logged)
+	}
+	if err != nil {
+		zle.Object(slutil.ZLObjectKey, obj)
+		return
+	}
+
+	var links []slutil.JSONObject
+	if err, ok := obj.(error); ok {
+		links = slutil.ChainObjects(err)
+	}
+	// Error Reporting rejects a ReportedErrorEvent without a stack trace or a context.reportLocation, so the
+	// @type is only written together with the stack trace
+	if trace := stackTrace(fmt.Sprintf("%T", obj), slutil.ErrorText(logged, obj), links); trace != "" {
+		zle.Str(TypeKey, ReportedErrorEventType)
+		zle.Str(StackTraceKey, trace)
+	}
+
+	if request := httpRequest(logged); request != nil {
+		zle.Dict(HTTPRequestKey, request)
+	}
+
+	if function := qualified(logged); function != "" {
+		var line int
+		_ = logged.Decode(slapi.LineKey, &line)
+		zle.Dict(SourceLocationKey, zerolog.Dict().
+			Str("file", logged.Str(slapi.FileKey)).
+			Str("line", strconv.Itoa(line)).
+			Str("function", function))
+	}
+
+	if traceID := logged.Str(slapi.TraceIDKey); traceID != "" {
+		if f.ProjectID != "" {
+			traceID = "projects/" + f.ProjectID + "/traces/" + traceID
+		}
+		zle.Str(TraceKey, traceID)
+	}
+	if spanID := logged.Str(slapi.SpanIDKey); spanID != "" {
+		zle.Str(SpanIDKey, spanID)
+	}
+
+	var service slutil.ServiceInfo
+	if logged.Decode(slutil.ServiceKey, &service) == nil && service.Name != "" {
+		zle.Dict(ServiceContextKey, zerolog.Dict().Str("service", service.Name).Str("version", service.Version))
+	}
+
+	zle.RawJSON(slutil.ZLObjectKey, raw)
+}
+
+// httpRequest returns the HttpRequest of Cloud Logging for the method, path or URL, status and latency of the logged
+// error, or nil if it has none of them
+func httpRequest(logged slutil.JSONObject) *zerolog.Event {
+	method, url := logged.Str(slapi.MethodKey), logged.Str(slapi.PathKey)
+	if url == "" {
+		url = logged.Str(slhttp.URLKey)
+	}
+
+	var latency float64
+	var status int
+	_ = logged.Decode(slapi.StatusCodeKey, &status)
+	_ = logged.Decode(slhttp.LatencyKey, &latency)
+
+	if method == "" && url == "" && status == 0 {
+		return nil
+	}
+
+	request := zerolog.Dict()
+	if method != "" {
+		request.Str("requestMethod", method)
+	}
+	if url != "" {
+		request.Str("requestUrl", url)
+	}
+	if status != 0 {
+		request.Int("status", status)
+	}
+	if latency > 0 {
+		seconds := (time.Duration(latency * float64(zerolog.DurationFieldUnit))).Seconds()
+		request.Str("latency", strconv.FormatFloat(seconds, 'f', -1, 64)+"s")
+	}
+
+	return request
+}
+
+// stackTrace formats the functions that created the errors of the chain like the stack of a Go panic, innermost
+// first, which is the format Error Reporting groups Go errors by. It is empty when no error knows its function.
+func stackTrace(typeName, message string, links []slutil.JSONObject) string {
+	var frames []string
+	for i := len(links) - 1; i >= 0; i-- {
+		function := qualified(links[i])
+		if function == "" {
+			continue
+		}
+
+		var line int
+		_ = links[i].Decode(slapi.LineKey, &line)
+		frames = append(frames, function+"()\n\t"+links[i].Str(slapi.FileKey)+":"+strconv.Itoa(line))
+	}
+
+	if len(frames) == 0 {
+		return ""
+	}
+
+	header := typeName
+	if message != "" {
+		header += ": " + message
+	}
+
+	return header + "\n\ngoroutine 1 [running]:\n" + strings.Join(frames, "\n")
+}
+
+// qualified returns the function that created the error of fields with its import path, e.g.
+// github.com/org/repo/users.GetUser
+func qualified(fields slutil.JSONObject) string {
+	function := fields.Str(slapi.FunctionKey)
+	if function == "" {
+		return ""
+	}
+
+	pkg := fields.Str(slapi.PackageKey)
+	if pkg == "" {
+		return function
+	}
+	if module := fields.Str(slapi.ModuleKey); module != "" {
+		pkg = module + "/" + pkg
+	}
+
+	return pkg + "." + function
+}
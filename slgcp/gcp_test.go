@@ -0,0 +1,138 @@
+package slgcp
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slapi"
+	"github.com/seantcanavan/zerolog-json-structured-logs/sldb"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slhttp"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func logLine(t *testing.T, obj zerolog.LogObjectMarshaler) map[string]any {
+	t.Helper()
+
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	slutil.AddObject(logger.Error(), obj).Msg("failed")
+
+	var line map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &line))
+
+	return line
+}
+
+func TestFormatter_APIError(t *testing.T) {
+	restore := Enable("my-project")
+	defer restore()
+
+	dbErr := &sldb.DatabaseError{
+		InnerError:  errors.New("duplicate key"),
+		Message:     "could not insert user",
+		ExecContext: slutil.ExecContext{File: "/src/repo/users.go", Function: "InsertUser", Line: 17, Module: "example.com/app", Package: "repo"},
+	}
+	apiErr := &slapi.APIError{
+		InnerError:  fmt.Errorf("wrapping error %w", dbErr),
+		Message:     "could not sign up",
+		Method:      "POST",
+		Path:        "/users",
+		SpanID:      "00f067aa0ba902b7",
+		StatusCode:  409,
+		TraceID:     "4bf92f3577b34da6a3ce929d0e0e4736",
+		ExecContext: slutil.ExecContext{File: "/src/api/users.go", Function: "SignUp", Line: 42, Module: "example.com/app", Package: "api"},
+	}
+
+	line := logLine(t, apiErr)
+
+	assert.Equal(t, "ERROR", line[SeverityKey])
+	assert.NotContains(t, line, "level")
+	assert.Equal(t, ReportedErrorEventType, line[TypeKey])
+	assert.Equal(t, map[string]any{"requestMethod": "POST", "requestUrl": "/users", "status": float64(409)}, line[HTTPRequestKey])
+	assert.Equal(t, map[string]any{"file": "/src/api/users.go", "line": "42", "function": "example.com/app/api.SignUp"}, line[SourceLocationKey])
+	assert.Equal(t, "projects/my-project/traces/4bf92f3577b34da6a3ce929d0e0e4736", line[TraceKey])
+	assert.Equal(t, "00f067aa0ba902b7", line[SpanIDKey])
+	assert.Equal(t, "*slapi.APIError: could not sign up\n\n"+
+		"goroutine 1 [running]:\n"+
+		"example.com/app/repo.InsertUser()\n\t/src/repo/users.go:17\n"+
+		"example.com/app/api.SignUp()\n\t/src/api/users.go:42", line[StackTraceKey])
+
+	// the sl object is kept so the line can still be read back
+	sl, ok := line[slutil.ZLObjectKey].(map[string]any)
+	require.True(t, ok)
+	assert.Equal(t, "could not sign up", sl[slapi.MessageKey])
+	assert.NotContains(t, line, ServiceContextKey)
+}
+
+func TestFormatter_DependencyError(t *testing.T) {
+	restore := Enable("")
+	defer restore()
+
+	line := logLine(t, &slhttp.DependencyError{
+		Latency:    1500 * time.Millisecond,
+		Method:     "GET",
+		StatusCode: 503,
+		TraceID:    "4bf92f3577b34da6a3ce929d0e0e4736",
+		URL:        "https://billing.internal/invoices",
+	})
+
+	assert.Equal(t, map[string]any{
+		"latency":       "1.5s",
+		"requestMethod": "GET",
+		"requestUrl":    "https://billing.internal/invoices",
+		"status":        float64(503),
+	}, line[HTTPRequestKey])
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", line[TraceKey])
+	assert.NotContains(t, line, SourceLocationKey)
+	assert.NotContains(t, line, StackTraceKey)
+	assert.NotContains(t, line, TypeKey)
+}
+
+func TestFormatter_ServiceContext(t *testing.T) {
+	restore := Enable("")
+	defer restore()
+
+	slutil.SetServiceInfo(slutil.ServiceInfo{Name: "users", Version: "1.2.3"})
+	defer slutil.ClearServiceInfo()
+
+	line := logLine(t, &sldb.DatabaseError{Message: "no user"})
+	assert.Equal(t, map[string]any{"service": "users", "version": "1.2.3"}, line[ServiceContextKey])
+	assert.NotContains(t, line, HTTPRequestKey)
+}
+
+func TestEnable(t *testing.T) {
+	t.Setenv(EnvProject, "env-project")
+
+	restore := Enable("")
+	assert.Equal(t, Formatter{ProjectID: "env-project"}, slutil.OutputFormat)
+	restore()
+
+	assert.Nil(t, slutil.OutputFormat)
+	assert.Equal(t, "level", zerolog.LevelFieldName)
+
+	// the sl layout is the default
+	line := logLine(t, &sldb.DatabaseError{Message: "no user"})
+	assert.Equal(t, "error", line[zerolog.LevelFieldName])
+	assert.NotContains(t, line, TypeKey)
+}
+
+func TestSeverity(t *testing.T) {
+	for level, severity := range map[zerolog.Level]string{
+		zerolog.TraceLevel: "DEBUG",
+		zerolog.DebugLevel: "DEBUG",
+		zerolog.InfoLevel:  "INFO",
+		zerolog.WarnLevel:  "WARNING",
+		zerolog.ErrorLevel: "ERROR",
+		zerolog.FatalLevel: "CRITICAL",
+		zerolog.PanicLevel: "ALERT",
+		zerolog.NoLevel:    "DEFAULT",
+	} {
+		assert.Equal(t, severity, Severity(level), level.String())
+	}
+}
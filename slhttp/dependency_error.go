@@ -0,0 +1,176 @@
+package slhttp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+)
+
+const BodyKey = "body"
+const InnerErrorKey = "innerError"
+const LatencyKey = "latency"
+const MethodKey = "method"
+const RequestIDKey = "requestId"
+const RetryAfterKey = "retryAfter"
+const SpanIDKey = "spanId"
+const StatusCodeKey = "statusCode"
+const StatusTextKey = "statusText"
+const TraceIDKey = "traceId"
+const URLKey = "url"
+
+// DependencyError represents a failed call to another service made through Transport.
+// StatusCode is zero when no response was received, in which case InnerError holds the transport failure.
+type DependencyError struct {
+	Body       string        // the start of the response body, cut off after Transport.MaxBodyBytes
+	InnerError error         // the transport failure such as a *net.OpError, nil when a response was received
+	Latency    time.Duration // the time from sending the request until the response headers or the failure
+	Method     string
+	RequestID  string
+	RetryAfter time.Duration // the delay asked for by the Retry-After response header
+	SpanID     string        // the W3C trace context span ID sent to the dependency
+	StatusCode int
+	TraceID    string
+	URL        string // the request URL with sensitive query values redacted
+
+	logged bool // whether this error has already been written to the log
+}
+
+// Error returns the string representation of the DependencyError.
+func (e *DependencyError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("[DependencyError] %s %s failed after %s: %v", e.Method, e.URL, e.Latency, e.InnerError)
+	}
+
+	return fmt.Sprintf("[DependencyError] %s %s returned %d %s after %s", e.Method, e.URL, e.StatusCode, http.StatusText(e.StatusCode), e.Latency)
+}
+
+// Unwrap provides the underlying error for use with errors.Is and errors.As functions.
+func (e *DependencyError) Unwrap() error {
+	return e.InnerError
+}
+
+// HTTPStatus translates the DependencyError to the status code to answer the caller of our own API with:
+// 504 when the dependency timed out and 502 otherwise.
+func (e *DependencyError) HTTPStatus() int {
+	var timeoutErr interface{ Timeout() bool }
+	if e.StatusCode == http.StatusGatewayTimeout || (errors.As(e.InnerError, &timeoutErr) && timeoutErr.Timeout()) {
+		return http.StatusGatewayTimeout
+	}
+
+	return http.StatusBadGateway
+}
+
+// Logged reports whether the DependencyError has already been written to the log.
+func (e *DependencyError) Logged() bool {
+	return e.logged
+}
+
+// MarkLogged records that the DependencyError has been written to the log so it is not logged again.
+func (e *DependencyError) MarkLogged() {
+	e.logged = true
+}
+
+// MarshalZerologObject allows DependencyError to be logged by zerolog.
+func (e *DependencyError) MarshalZerologObject(zle *zerolog.Event) {
+	e.MarshalZerologFields(zle)
+	zle.Str(slutil.FingerprintKey, slutil.Fingerprint(e))
+	slutil.AddService(zle)
+	slutil.AddChain(zle, e.InnerError)
+}
+
+// FingerprintParts returns the fields that identify the kind of failure the DependencyError describes.
+// The URL is reduced to its host and normalized path so calls for different resources are grouped together.
+func (e *DependencyError) FingerprintParts() []string {
+	endpoint := e.URL
+	if parsed, err := url.Parse(e.URL); err == nil {
+		endpoint = parsed.Host + slutil.NormalizeMessage(parsed.Path)
+	}
+
+	return []string{
+		"http",
+		strconv.Itoa(e.StatusCode),
+		e.Method,
+		endpoint,
+		slutil.RootCauseType(e.InnerError),
+	}
+}
+
+// MarshalZerologFields logs the fields of DependencyError without the chain of errors it wraps.
+func (e *DependencyError) MarshalZerologFields(zle *zerolog.Event) {
+	var truncated slutil.Truncations
+	zle.
+		Int(StatusCodeKey, e.StatusCode).
+		Dur(LatencyKey, e.Latency).
+		Dur(RetryAfterKey, e.RetryAfter).
+		Str(BodyKey, slutil.RedactText(e.Body)).
+		Str(MethodKey, e.Method).
+		Str(RequestIDKey, e.RequestID).
+		Str(SpanIDKey, e.SpanID).
+		Str(StatusTextKey, http.StatusText(e.StatusCode)).
+		Str(TraceIDKey, e.TraceID).
+		Str(URLKey, e.URL)
+
+	slutil.AddInnerError(zle, InnerErrorKey, e.InnerError, &truncated)
+	slutil.AddTruncated(zle, truncated)
+}
+
+func init() {
+	slutil.RegisterErrorType(func() error { return &DependencyError{} })
+}
+
+// MarshalJSON encodes DependencyError with the same field names MarshalZerologObject logs. Fields are encoded as
+// they are, without redaction or truncation.
+func (e *DependencyError) MarshalJSON() ([]byte, error) {
+	return slutil.MarshalFieldsJSON(map[string]any{
+		BodyKey:               e.Body,
+		LatencyKey:            float64(e.Latency) / float64(zerolog.DurationFieldUnit),
+		MethodKey:             e.Method,
+		RequestIDKey:          e.RequestID,
+		RetryAfterKey:         float64(e.RetryAfter) / float64(zerolog.DurationFieldUnit),
+		SpanIDKey:             e.SpanID,
+		StatusCodeKey:         e.StatusCode,
+		StatusTextKey:         http.StatusText(e.StatusCode),
+		TraceIDKey:            e.TraceID,
+		URLKey:                e.URL,
+		slutil.FingerprintKey: slutil.Fingerprint(e),
+	}, InnerErrorKey, e.InnerError)
+}
+
+// UnmarshalJSON decodes a DependencyError produced by MarshalJSON or read back from a log line.
+// Durations are expected in zerolog.DurationFieldUnit.
+func (e *DependencyError) UnmarshalJSON(data []byte) error {
+	var obj slutil.JSONObject
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+
+	var latency, retryAfter float64
+	err := errors.Join(
+		obj.Decode(BodyKey, &e.Body),
+		obj.DecodeError(InnerErrorKey, &e.InnerError),
+		obj.Decode(LatencyKey, &latency),
+		obj.Decode(MethodKey, &e.Method),
+		obj.Decode(RequestIDKey, &e.RequestID),
+		obj.Decode(RetryAfterKey, &retryAfter),
+		obj.Decode(SpanIDKey, &e.SpanID),
+		obj.Decode(StatusCodeKey, &e.StatusCode),
+		obj.Decode(TraceIDKey, &e.TraceID),
+		obj.Decode(URLKey, &e.URL),
+	)
+
+	e.Latency = time.Duration(latency * float64(zerolog.DurationFieldUnit))
+	e.RetryAfter = time.Duration(retryAfter * float64(zerolog.DurationFieldUnit))
+
+	return err
+}
+
+// FindDependencyErrors returns a slice of all DependencyError found in the error tree in depth-first order.
+func FindDependencyErrors(err error) []*DependencyError {
+	return slutil.FindAll[*DependencyError](err)
+}
@@ -0,0 +1,85 @@
+package slhttp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDependencyError_JSON(t *testing.T) {
+	depErr := &DependencyError{
+		Body:       `{"error":"unavailable"}`,
+		Latency:    1500 * time.Millisecond,
+		Method:     http.MethodGet,
+		RequestID:  "req-123",
+		RetryAfter: 30 * time.Second,
+		SpanID:     "00f067aa0ba902b7",
+		StatusCode: http.StatusServiceUnavailable,
+		TraceID:    "4bf92f3577b34da6a3ce929d0e0e4736",
+		URL:        "https://example.com/users/42",
+	}
+
+	marshalled, err := json.Marshal(depErr)
+	require.NoError(t, err)
+
+	var decoded DependencyError
+	require.NoError(t, json.Unmarshal(marshalled, &decoded))
+	assert.Equal(t, *depErr, decoded)
+}
+
+func TestDependencyError_JSONRoundTrip(t *testing.T) {
+	slutil.Redaction = redactAll{}
+	slutil.FieldLimits = slutil.Limits{InnerError: 4}
+	defer func() {
+		slutil.Redaction = nil
+		slutil.FieldLimits = slutil.Limits{}
+	}()
+
+	depErr := &DependencyError{
+		Body:       `{"token":"secret"}`,
+		InnerError: errors.New("connection reset by peer"),
+		StatusCode: http.StatusBadGateway,
+	}
+
+	marshalled, err := json.Marshal(depErr)
+	require.NoError(t, err)
+
+	var decoded DependencyError
+	require.NoError(t, json.Unmarshal(marshalled, &decoded))
+	assert.Equal(t, depErr.Body, decoded.Body)
+	assert.EqualError(t, decoded.InnerError, depErr.InnerError.Error())
+}
+
+// redactAll replaces every text and parameter
+type redactAll struct{}
+
+func (redactAll) RedactParam(string, string) (string, bool) {
+	return "[REDACTED]", true
+}
+
+func (redactAll) RedactText(string) string {
+	return "[REDACTED]"
+}
+
+func TestDependencyError_HTTPStatus(t *testing.T) {
+	assert.Equal(t, http.StatusBadGateway, (&DependencyError{StatusCode: http.StatusInternalServerError}).HTTPStatus())
+	assert.Equal(t, http.StatusGatewayTimeout, (&DependencyError{StatusCode: http.StatusGatewayTimeout}).HTTPStatus())
+	assert.Equal(t, http.StatusGatewayTimeout, (&DependencyError{InnerError: fmt.Errorf("dial: %w", context.DeadlineExceeded)}).HTTPStatus())
+	assert.Equal(t, http.StatusBadGateway, (&DependencyError{InnerError: errors.New("connection refused")}).HTTPStatus())
+}
+
+func TestDependencyError_Fingerprint(t *testing.T) {
+	first := &DependencyError{Method: http.MethodGet, StatusCode: 503, URL: "https://example.com/users/42?page=1"}
+	second := &DependencyError{Method: http.MethodGet, StatusCode: 503, URL: "https://example.com/users/7"}
+	other := &DependencyError{Method: http.MethodGet, StatusCode: 503, URL: "https://other.example.com/users/7"}
+
+	assert.Equal(t, slutil.Fingerprint(first), slutil.Fingerprint(second))
+	assert.NotEqual(t, slutil.Fingerprint(first), slutil.Fingerprint(other))
+}
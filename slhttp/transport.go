@@ -0,0 +1,185 @@
+// Package slhttp instruments outbound HTTP calls so failures of other services are returned as structured
+// DependencyError values carrying the request ID and trace context of the request that made the call.
+package slhttp
+
+import (
+	"github.com/rs/zerolog/log"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slapi"
+	"github.com/seantcanavan/zerolog-json-structured-logs/sltrace"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// DefaultMaxBodyBytes is the number of bytes of an error response body kept in DependencyError.Body
+const DefaultMaxBodyBytes = 1024
+
+// RedactedValue replaces the values of sensitive query parameters in DependencyError.URL
+const RedactedValue = "REDACTED"
+
+// SensitiveQueryParams are the query parameters, compared case-insensitively, whose values are redacted
+// from DependencyError.URL unless Transport.SensitiveQueryParams is set.
+var SensitiveQueryParams = []string{
+	"access_token",
+	"api_key",
+	"apikey",
+	"client_secret",
+	"code",
+	"key",
+	"password",
+	"secret",
+	"sig",
+	"signature",
+	"token",
+}
+
+// Transport is an http.RoundTripper that forwards the request ID and W3C trace context of the request context
+// to the dependency and returns a *DependencyError when the call fails or the response has an error status.
+// Error responses are closed and not returned.
+type Transport struct {
+	Base                 http.RoundTripper     // the RoundTripper making the call, http.DefaultTransport if nil
+	IsError              func(status int) bool // reports whether a status is a failure, status >= 500 if nil
+	MaxBodyBytes         int                   // DefaultMaxBodyBytes if zero, no body is read if negative
+	SensitiveQueryParams []string              // SensitiveQueryParams if nil
+}
+
+// NewClient returns an http.Client using a Transport with the default settings.
+func NewClient() *http.Client {
+	return &http.Client{Transport: &Transport{}}
+}
+
+// RoundTrip implements http.RoundTripper.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx := req.Context()
+
+	// a RoundTripper must not modify the request it was given
+	outbound := req.Clone(ctx)
+	requestID := slutil.FromCtxSafe[string](ctx, slapi.RequestIDKey)
+	if requestID != "" && outbound.Header.Get(slapi.RequestIDHeader) == "" {
+		outbound.Header.Set(slapi.RequestIDHeader, requestID)
+	}
+
+	var span sltrace.TraceContext
+	if parent, ok := sltrace.FromContext(ctx); ok {
+		span = parent.Child()
+		sltrace.Inject(outbound.Header, span)
+	}
+
+	start := time.Now()
+	res, err := t.base().RoundTrip(outbound)
+	latency := time.Since(start)
+
+	if err == nil && !t.isError(res.StatusCode) {
+		return res, nil
+	}
+
+	depErr := &DependencyError{
+		InnerError: err,
+		Latency:    latency,
+		Method:     req.Method,
+		RequestID:  requestID,
+		SpanID:     span.SpanID,
+		TraceID:    span.TraceID,
+		URL:        t.redact(req.URL),
+	}
+
+	if res != nil {
+		depErr.Body = t.readBody(res.Body)
+		depErr.RetryAfter = parseRetryAfter(res.Header.Get("Retry-After"), time.Now())
+		depErr.StatusCode = res.StatusCode
+		res.Body.Close()
+	}
+
+	// in boundary mode the error is only logged once by the outermost handler together with its chain
+	if slutil.ShouldLogEagerly() {
+		slutil.AddObject(log.Error(), depErr).Send()
+		slutil.MarkLogged(depErr)
+	}
+
+	return nil, depErr
+}
+
+func (t *Transport) base() http.RoundTripper {
+	if t.Base != nil {
+		return t.Base
+	}
+
+	return http.DefaultTransport
+}
+
+func (t *Transport) isError(status int) bool {
+	if t.IsError != nil {
+		return t.IsError(status)
+	}
+
+	return status >= http.StatusInternalServerError
+}
+
+// readBody reads up to MaxBodyBytes of body without splitting a UTF-8 character
+func (t *Transport) readBody(body io.Reader) string {
+	limit := t.MaxBodyBytes
+	if limit == 0 {
+		limit = DefaultMaxBodyBytes
+	}
+
+	if limit < 0 || body == nil {
+		return ""
+	}
+
+	b, _ := io.ReadAll(io.LimitReader(body, int64(limit)+1))
+	if len(b) <= limit {
+		return string(b)
+	}
+
+	b = b[:limit]
+	for len(b) > 0 && !utf8.Valid(b) {
+		b = b[:len(b)-1]
+	}
+
+	return string(b) + "..."
+}
+
+// redact returns u with its password and the values of sensitive query parameters replaced
+func (t *Transport) redact(u *url.URL) string {
+	sensitive := t.SensitiveQueryParams
+	if sensitive == nil {
+		sensitive = SensitiveQueryParams
+	}
+
+	redacted := *u
+	query := redacted.Query()
+	for key, values := range query {
+		for _, param := range sensitive {
+			if strings.EqualFold(key, param) {
+				for i := range values {
+					values[i] = RedactedValue
+				}
+			}
+		}
+	}
+	redacted.RawQuery = query.Encode()
+
+	return redacted.Redacted()
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if value == "" {
+		return 0
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+
+	return 0
+}
@@ -0,0 +1,114 @@
+package slotlp
+
+import (
+	"sort"
+	"strconv"
+)
+
+// The types below are the OTLP/JSON encoding of an ExportLogsServiceRequest. 64-bit integers are strings and trace
+// and span IDs are hex strings as the encoding requires.
+
+type exportRequest struct {
+	ResourceLogs []resourceLogs `json:"resourceLogs"`
+}
+
+type resourceLogs struct {
+	Resource  resource    `json:"resource"`
+	ScopeLogs []scopeLogs `json:"scopeLogs"`
+}
+
+type resource struct {
+	Attributes []keyValue `json:"attributes,omitempty"`
+}
+
+type scopeLogs struct {
+	LogRecords []logRecord `json:"logRecords"`
+	Scope      scope       `json:"scope"`
+}
+
+type scope struct {
+	Name string `json:"name"`
+}
+
+type logRecord struct {
+	Attributes           []keyValue `json:"attributes,omitempty"`
+	Body                 *anyValue  `json:"body,omitempty"`
+	ObservedTimeUnixNano string     `json:"observedTimeUnixNano"`
+	SeverityNumber       int        `json:"severityNumber,omitempty"`
+	SeverityText         string     `json:"severityText,omitempty"`
+	SpanID               string     `json:"spanId,omitempty"`
+	TimeUnixNano         string     `json:"timeUnixNano,omitempty"`
+	TraceID              string     `json:"traceId,omitempty"`
+}
+
+type keyValue struct {
+	Key   string   `json:"key"`
+	Value anyValue `json:"value"`
+}
+
+type anyValue struct {
+	ArrayValue  *arrayValue  `json:"arrayValue,omitempty"`
+	BoolValue   *bool        `json:"boolValue,omitempty"`
+	DoubleValue *float64     `json:"doubleValue,omitempty"`
+	IntValue    *string      `json:"intValue,omitempty"`
+	KvlistValue *kvlistValue `json:"kvlistValue,omitempty"`
+	StringValue *string      `json:"stringValue,omitempty"`
+}
+
+type arrayValue struct {
+	Values []anyValue `json:"values"`
+}
+
+type kvlistValue struct {
+	Values []keyValue `json:"values"`
+}
+
+func stringValue(s string) anyValue {
+	return anyValue{StringValue: &s}
+}
+
+func intValue(i int64) anyValue {
+	s := strconv.FormatInt(i, 10)
+	return anyValue{IntValue: &s}
+}
+
+// valueOf converts a value decoded from JSON. Whole numbers become integers.
+func valueOf(value any) anyValue {
+	switch x := value.(type) {
+	case string:
+		return stringValue(x)
+	case bool:
+		return anyValue{BoolValue: &x}
+	case float64:
+		if x == float64(int64(x)) {
+			return intValue(int64(x))
+		}
+		return anyValue{DoubleValue: &x}
+	case []any:
+		values := make([]anyValue, len(x))
+		for i, element := range x {
+			values[i] = valueOf(element)
+		}
+		return anyValue{ArrayValue: &arrayValue{Values: values}}
+	case map[string]any:
+		return anyValue{KvlistValue: &kvlistValue{Values: keyValues(x)}}
+	default:
+		return anyValue{}
+	}
+}
+
+// keyValues converts the members of obj sorted by key
+func keyValues(obj map[string]any) []keyValue {
+	keys := make([]string, 0, len(obj))
+	for key := range obj {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	res := make([]keyValue, len(keys))
+	for i, key := range keys {
+		res[i] = keyValue{Key: key, Value: valueOf(obj[key])}
+	}
+
+	return res
+}
@@ -0,0 +1,218 @@
+package slotlp
+
+import (
+	"encoding/hex"
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slapi"
+	"github.com/seantcanavan/zerolog-json-structured-logs/sldb"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slhttp"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slread"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
+	"strconv"
+	"time"
+)
+
+const CodeFilepathKey = "code.filepath"
+const CodeFunctionKey = "code.function"
+const CodeLinenoKey = "code.lineno"
+const CodeNamespaceKey = "code.namespace"
+const DBNameKey = "db.name"
+const DBOperationKey = "db.operation"
+const DBSQLTableKey = "db.sql.table"
+const DBStatementKey = "db.statement"
+const DBSystemKey = "db.system"
+const DeploymentEnvironmentKey = "deployment.environment"
+const EnduserIDKey = "enduser.id"
+const ExceptionMessageKey = "exception.message"
+const ExceptionTypeKey = "exception.type"
+const HostNameKey = "host.name"
+const HTTPRequestMethodKey = "http.request.method"
+const HTTPResponseStatusCodeKey = "http.response.status_code"
+const ProcessPIDKey = "process.pid"
+const ServiceNameKey = "service.name"
+const ServiceVersionKey = "service.version"
+const URLFullKey = "url.full"
+const URLPathKey = "url.path"
+const VCSRevisionKey = "vcs.repository.ref.revision"
+
+// AttributePrefix is prepended to the declared key of the fields without a semantic convention, e.g. sl.requestId.
+const AttributePrefix = slutil.ZLObjectKey + "."
+
+// attributeKeys are the semantic convention names of the declared keys that have one
+var attributeKeys = map[string]string{
+	slapi.CallerIDKey:   EnduserIDKey,
+	slapi.FileKey:       CodeFilepathKey,
+	slapi.FunctionKey:   CodeFunctionKey,
+	slapi.LineKey:       CodeLinenoKey,
+	slapi.MessageKey:    ExceptionMessageKey,
+	slapi.MethodKey:     HTTPRequestMethodKey,
+	slapi.PathKey:       URLPathKey,
+	slapi.StatusCodeKey: HTTPResponseStatusCodeKey,
+	slhttp.URLKey:       URLFullKey,
+	sldb.DBNameKey:      DBNameKey,
+	sldb.OperationKey:   DBOperationKey,
+	sldb.QueryKey:       DBStatementKey,
+	sldb.TableNameKey:   DBSQLTableKey,
+}
+
+// skippedKeys are declared keys that are not attributes because code.namespace or the resource holds them
+var skippedKeys = map[string]bool{
+	slapi.ModuleKey:   true,
+	slapi.PackageKey:  true,
+	slutil.ServiceKey: true,
+}
+
+// severityNumbers are the OTLP severity numbers of the zerolog levels
+var severityNumbers = map[string]int{
+	zerolog.LevelTraceValue: 1,
+	zerolog.LevelDebugValue: 5,
+	zerolog.LevelInfoValue:  9,
+	zerolog.LevelWarnValue:  13,
+	zerolog.LevelErrorValue: 17,
+	zerolog.LevelFatalValue: 21,
+	zerolog.LevelPanicValue: 24,
+}
+
+// convert returns the log record of a decoded line and the service it was logged by, nil if it has none
+func convert(record *slread.Record, dbSystem string, observed time.Time) (logRecord, *slutil.ServiceInfo) {
+	res := logRecord{
+		ObservedTimeUnixNano: strconv.FormatInt(observed.UnixNano(), 10),
+		SeverityNumber:       severityNumbers[record.Level],
+		SeverityText:         record.Level,
+	}
+
+	if !record.Time.IsZero() {
+		res.TimeUnixNano = strconv.FormatInt(record.Time.UnixNano(), 10)
+	}
+
+	fields := record.Fields
+
+	body := record.Message
+	if body == "" {
+		body, _ = fields[slapi.MessageKey].(string)
+	}
+	if body != "" {
+		value := stringValue(body)
+		res.Body = &value
+	}
+
+	if traceID, _ := fields[slapi.TraceIDKey].(string); isHexID(traceID, 16) {
+		res.TraceID = traceID
+	}
+	if spanID, _ := fields[slapi.SpanIDKey].(string); isHexID(spanID, 8) {
+		res.SpanID = spanID
+	}
+
+	attributes := make(map[string]any, len(fields))
+	for key, value := range fields {
+		if skippedKeys[key] || isEmpty(value) {
+			continue
+		}
+
+		// valid IDs belong to the record itself
+		if key == slapi.TraceIDKey && res.TraceID != "" || key == slapi.SpanIDKey && res.SpanID != "" {
+			continue
+		}
+
+		if name, ok := attributeKeys[key]; ok {
+			attributes[name] = value
+		} else {
+			attributes[AttributePrefix+key] = value
+		}
+	}
+
+	if namespace := namespaceOf(fields); namespace != "" {
+		attributes[CodeNamespaceKey] = namespace
+	}
+	if err := record.Err(); err != nil {
+		attributes[ExceptionTypeKey] = fmt.Sprintf("%T", err)
+	}
+	if dbSystem != "" && hasDBFields(fields) {
+		attributes[DBSystemKey] = dbSystem
+	}
+	res.Attributes = keyValues(attributes)
+
+	return res, record.Service()
+}
+
+// resourceOf returns the resource attributes of service
+func resourceOf(service *slutil.ServiceInfo) resource {
+	if service == nil {
+		return resource{}
+	}
+
+	attributes := make(map[string]any)
+	for key, value := range map[string]string{
+		DeploymentEnvironmentKey: service.Environment,
+		HostNameKey:              service.Host,
+		ServiceNameKey:           service.Name,
+		ServiceVersionKey:        service.Version,
+		VCSRevisionKey:           service.Commit,
+	} {
+		if value != "" {
+			attributes[key] = value
+		}
+	}
+	if service.PID != 0 {
+		attributes[ProcessPIDKey] = float64(service.PID)
+	}
+
+	return resource{Attributes: keyValues(attributes)}
+}
+
+// namespaceOf returns the import path of the package that created the logged error, e.g. github.com/org/repo/users
+func namespaceOf(fields map[string]any) string {
+	pkg, _ := fields[slapi.PackageKey].(string)
+	module, _ := fields[slapi.ModuleKey].(string)
+	if pkg == "" || module == "" {
+		return pkg
+	}
+
+	return module + "/" + pkg
+}
+
+func hasDBFields(fields map[string]any) bool {
+	for _, key := range []string{sldb.DBNameKey, sldb.OperationKey, sldb.QueryKey, sldb.TableNameKey} {
+		if !isEmpty(fields[key]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isHexID reports whether id is the hex encoding of size bytes that are not all zero
+func isHexID(id string, size int) bool {
+	decoded, err := hex.DecodeString(id)
+	if err != nil || len(decoded) != size {
+		return false
+	}
+
+	for _, b := range decoded {
+		if b != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isEmpty(value any) bool {
+	switch x := value.(type) {
+	case nil:
+		return true
+	case string:
+		return x == ""
+	case float64:
+		return x == 0
+	case bool:
+		return !x
+	case []any:
+		return len(x) == 0
+	case map[string]any:
+		return len(x) == 0
+	default:
+		return false
+	}
+}
@@ -0,0 +1,172 @@
+package slotlp
+
+import (
+	"bytes"
+	"errors"
+	"github.com/rs/zerolog"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slapi"
+	"github.com/seantcanavan/zerolog-json-structured-logs/sldb"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slread"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strconv"
+	"testing"
+	"time"
+)
+
+const testTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+const testSpanID = "00f067aa0ba902b7"
+
+var observed = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// decodeLine logs obj the way slapi does and decodes the line
+func decodeLine(t *testing.T, obj zerolog.LogObjectMarshaler, message string) *slread.Record {
+	t.Helper()
+
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf).With().Timestamp().Logger()
+	slutil.AddObject(logger.Error(), obj).Msg(message)
+
+	record, err := slread.Decode(bytes.TrimSpace(buf.Bytes()))
+	require.NoError(t, err)
+
+	return record
+}
+
+// plain converts an OTLP value back to the value it was made of
+func plain(value anyValue) any {
+	switch {
+	case value.StringValue != nil:
+		return *value.StringValue
+	case value.BoolValue != nil:
+		return *value.BoolValue
+	case value.IntValue != nil:
+		i, _ := strconv.ParseInt(*value.IntValue, 10, 64)
+		return i
+	case value.DoubleValue != nil:
+		return *value.DoubleValue
+	case value.ArrayValue != nil:
+		res := make([]any, len(value.ArrayValue.Values))
+		for i, element := range value.ArrayValue.Values {
+			res[i] = plain(element)
+		}
+		return res
+	case value.KvlistValue != nil:
+		return attributeMap(value.KvlistValue.Values)
+	default:
+		return nil
+	}
+}
+
+func attributeMap(kvs []keyValue) map[string]any {
+	res := make(map[string]any, len(kvs))
+	for _, kv := range kvs {
+		res[kv.Key] = plain(kv.Value)
+	}
+
+	return res
+}
+
+func TestConvert_APIError(t *testing.T) {
+	apiErr := &slapi.APIError{
+		CallerID:    "caller-1",
+		InnerError:  errors.New("no rows"),
+		Message:     "could not find user",
+		Method:      "GET",
+		Path:        "/users/1",
+		PathParams:  map[string]string{"id": "1"},
+		RequestID:   "req-1",
+		SpanID:      testSpanID,
+		StatusCode:  404,
+		TraceID:     testTraceID,
+		ExecContext: slutil.ExecContext{File: "/src/api/users.go", Function: "GetUser", Line: 42, Module: "example.com/app", Package: "api"},
+	}
+	record := decodeLine(t, apiErr, "request failed")
+
+	converted, service := convert(record, "postgresql", observed)
+	assert.Nil(t, service)
+
+	assert.Equal(t, 17, converted.SeverityNumber)
+	assert.Equal(t, "error", converted.SeverityText)
+	assert.Equal(t, "request failed", plain(*converted.Body))
+	assert.Equal(t, strconv.FormatInt(observed.UnixNano(), 10), converted.ObservedTimeUnixNano)
+	assert.Equal(t, strconv.FormatInt(record.Time.UnixNano(), 10), converted.TimeUnixNano)
+	assert.Equal(t, testTraceID, converted.TraceID)
+	assert.Equal(t, testSpanID, converted.SpanID)
+
+	attributes := attributeMap(converted.Attributes)
+	assert.Equal(t, "GET", attributes[HTTPRequestMethodKey])
+	assert.Equal(t, "/users/1", attributes[URLPathKey])
+	assert.Equal(t, int64(404), attributes[HTTPResponseStatusCodeKey])
+	assert.Equal(t, "caller-1", attributes[EnduserIDKey])
+	assert.Equal(t, "could not find user", attributes[ExceptionMessageKey])
+	assert.Equal(t, "*slapi.APIError", attributes[ExceptionTypeKey])
+	assert.Equal(t, "/src/api/users.go", attributes[CodeFilepathKey])
+	assert.Equal(t, int64(42), attributes[CodeLinenoKey])
+	assert.Equal(t, "GetUser", attributes[CodeFunctionKey])
+	assert.Equal(t, "example.com/app/api", attributes[CodeNamespaceKey])
+	assert.Equal(t, "req-1", attributes[AttributePrefix+slapi.RequestIDKey])
+	assert.Equal(t, map[string]any{"id": "1"}, attributes[AttributePrefix+slapi.PathParamsKey])
+
+	// the record carries the IDs, database errors the db.system and empty fields are left out
+	assert.NotContains(t, attributes, AttributePrefix+slapi.TraceIDKey)
+	assert.NotContains(t, attributes, DBSystemKey)
+	assert.NotContains(t, attributes, AttributePrefix+slapi.OwnerIDKey)
+}
+
+func TestConvert_DatabaseError(t *testing.T) {
+	slutil.SetServiceInfo(slutil.ServiceInfo{Name: "users", Version: "1.2.3"})
+	defer slutil.ClearServiceInfo()
+
+	dbErr := &sldb.DatabaseError{
+		DBName:    "accounts",
+		Message:   "could not insert user",
+		Operation: "INSERT",
+		Query:     "INSERT INTO users (email) VALUES ($1)",
+		TableName: "users",
+		TraceID:   "not-a-trace-id",
+		Type:      sldb.ErrDBDuplicateEntry,
+	}
+	record := decodeLine(t, dbErr, "")
+
+	converted, service := convert(record, "postgresql", observed)
+	require.NotNil(t, service)
+	assert.Equal(t, "users", service.Name)
+
+	// the message of the error is the body of lines without one
+	assert.Equal(t, "could not insert user", plain(*converted.Body))
+	assert.Empty(t, converted.TraceID)
+
+	attributes := attributeMap(converted.Attributes)
+	assert.Equal(t, "postgresql", attributes[DBSystemKey])
+	assert.Equal(t, "INSERT INTO users (email) VALUES ($1)", attributes[DBStatementKey])
+	assert.Equal(t, "accounts", attributes[DBNameKey])
+	assert.Equal(t, "INSERT", attributes[DBOperationKey])
+	assert.Equal(t, "users", attributes[DBSQLTableKey])
+	assert.Equal(t, "*sldb.DatabaseError", attributes[ExceptionTypeKey])
+	assert.Equal(t, "not-a-trace-id", attributes[AttributePrefix+slapi.TraceIDKey])
+	assert.NotContains(t, attributes, AttributePrefix+slutil.ServiceKey)
+}
+
+func TestResourceOf(t *testing.T) {
+	assert.Equal(t, resource{}, resourceOf(nil))
+
+	res := resourceOf(&slutil.ServiceInfo{Commit: "abc123", Environment: "prod", Host: "web-1", Name: "users", PID: 7})
+	assert.Equal(t, map[string]any{
+		DeploymentEnvironmentKey: "prod",
+		HostNameKey:              "web-1",
+		ProcessPIDKey:            int64(7),
+		ServiceNameKey:           "users",
+		VCSRevisionKey:           "abc123",
+	}, attributeMap(res.Attributes))
+}
+
+func TestIsHexID(t *testing.T) {
+	assert.True(t, isHexID(testTraceID, 16))
+	assert.True(t, isHexID(testSpanID, 8))
+	assert.False(t, isHexID(testSpanID, 16))
+	assert.False(t, isHexID("00000000000000000000000000000000", 16))
+	assert.False(t, isHexID("zz", 1))
+	assert.False(t, isHexID("", 8))
+}
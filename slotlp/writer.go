@@ -0,0 +1,386 @@
+// Package slotlp exports zerolog output to OpenTelemetry as OTLP/JSON log records, so logs can be sent to any
+// OpenTelemetry collector without a vendor agent.
+//
+// Writer turns every event carrying an sl object into a LogRecord with the level as severity, the message as body,
+// the trace and span IDs of the logged error and its fields as attributes named after the semantic conventions, such
+// as http.request.method, db.statement and code.function. Fields without a convention are kept as sl.<key>. The
+// service of the logged error becomes the resource of its record. Events without an sl object are left out.
+//
+// Records are batched into the resourceLogs of an ExportLogsServiceRequest, which is either posted to the OTLP/HTTP
+// endpoint of a collector or appended as one JSON line to a file, the format of the otlpjsonfile receiver:
+//
+//	w := slotlp.NewHTTPWriter("http://collector:4318/v1/logs", slotlp.WithDBSystem("postgresql"))
+//	defer w.Close()
+//	logger := zerolog.New(zerolog.MultiLevelWriter(os.Stdout, w))
+package slotlp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slread"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
+	"io"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// DefaultBatchSize is the number of records sent at once unless WithBatchSize is given.
+const DefaultBatchSize = 100
+
+// DefaultFlushInterval is how often pending records are sent unless WithFlushInterval is given.
+const DefaultFlushInterval = 5 * time.Second
+
+// DefaultHTTPTimeout limits every request of the default HTTP client.
+const DefaultHTTPTimeout = 10 * time.Second
+
+// DefaultQueueSize is the number of batches waiting to be exported unless WithQueueSize is given.
+const DefaultQueueSize = 8
+
+// ScopeName is the instrumentation scope of the exported records.
+const ScopeName = "github.com/seantcanavan/zerolog-json-structured-logs/slotlp"
+
+// Writer converts the zerolog events written to it into OTLP log records and exports them in batches. A batch is
+// queued when it is full and every flush interval, and exported in the background so Write never waits for the
+// collector. Batches that do not fit into the queue or cannot be exported are dropped and reported the way zerolog
+// reports failed writes. Flush and Close wait until every queued batch has been exported. It is safe for concurrent
+// use.
+type Writer struct {
+	batchSize int
+	client    *http.Client
+	closed    bool
+	dbSystem  string
+	done      chan struct{}
+	exporting sync.WaitGroup
+	headers   http.Header
+	interval  time.Duration
+	mu        sync.Mutex
+	now       func() time.Time
+	pending   []pendingRecord
+	queue     chan exportJob
+	queueSize int
+	senders   sync.WaitGroup
+	service   *slutil.ServiceInfo
+	stop      sync.Once
+	wg        sync.WaitGroup
+
+	export func(payload []byte) error
+}
+
+// exportJob is a batch waiting in the queue. done receives the result of the export if someone waits for it.
+type exportJob struct {
+	batch []pendingRecord
+	done  chan error
+}
+
+type pendingRecord struct {
+	record  logRecord
+	service *slutil.ServiceInfo
+}
+
+// NewHTTPWriter returns a Writer posting every batch to the OTLP/HTTP logs endpoint of a collector, usually ending
+// in /v1/logs.
+func NewHTTPWriter(endpoint string, options ...func(*Writer)) *Writer {
+	w := &Writer{client: &http.Client{Timeout: DefaultHTTPTimeout}, headers: make(http.Header)}
+	w.export = func(payload []byte) error {
+		return w.post(endpoint, payload)
+	}
+
+	return w.start(options)
+}
+
+// NewFileWriter returns a Writer appending every batch to out as a single line.
+func NewFileWriter(out io.Writer, options ...func(*Writer)) *Writer {
+	w := &Writer{}
+	w.export = func(payload []byte) error {
+		_, err := out.Write(append(payload, '\n'))
+		return err
+	}
+
+	return w.start(options)
+}
+
+// WithBatchSize exports records once size of them are pending.
+func WithBatchSize(size int) func(*Writer) {
+	return func(w *Writer) {
+		w.batchSize = size
+	}
+}
+
+// WithDBSystem adds the db.system attribute, e.g. postgresql, to the records of database errors.
+func WithDBSystem(system string) func(*Writer) {
+	return func(w *Writer) {
+		w.dbSystem = system
+	}
+}
+
+// WithFlushInterval exports the pending records every interval. Zero only exports full batches and on Flush and
+// Close.
+func WithFlushInterval(interval time.Duration) func(*Writer) {
+	return func(w *Writer) {
+		w.interval = interval
+	}
+}
+
+// WithHeader sends the header with every request of an HTTP Writer, e.g. for authentication.
+func WithHeader(key, value string) func(*Writer) {
+	return func(w *Writer) {
+		if w.headers != nil {
+			w.headers.Add(key, value)
+		}
+	}
+}
+
+// WithHTTPClient sends the requests of an HTTP Writer with client.
+func WithHTTPClient(client *http.Client) func(*Writer) {
+	return func(w *Writer) {
+		w.client = client
+	}
+}
+
+// WithQueueSize allows size batches to wait for their export before further batches are dropped.
+func WithQueueSize(size int) func(*Writer) {
+	return func(w *Writer) {
+		w.queueSize = size
+	}
+}
+
+// WithService is the resource of the records whose line has no service, such as lines logged before
+// slutil.SetServiceInfo was called.
+func WithService(service slutil.ServiceInfo) func(*Writer) {
+	return func(w *Writer) {
+		w.service = &service
+	}
+}
+
+func (w *Writer) start(options []func(*Writer)) *Writer {
+	w.batchSize = DefaultBatchSize
+	w.interval = DefaultFlushInterval
+	w.now = time.Now
+	w.done = make(chan struct{})
+	w.queueSize = DefaultQueueSize
+
+	for _, option := range options {
+		option(w)
+	}
+
+	w.queue = make(chan exportJob, max(w.queueSize, 0))
+	w.exporting.Add(1)
+	go w.exportQueued()
+
+	if w.interval > 0 {
+		w.wg.Add(1)
+		go w.flushEvery(w.interval)
+	}
+
+	return w
+}
+
+// Write converts a single zerolog event. Events without an sl object and lines that are not JSON are skipped, as
+// are events written after Close. It never returns an error.
+func (w *Writer) Write(p []byte) (int, error) {
+	record, err := slread.Decode(bytes.TrimRight(p, "\r\n"))
+	if err != nil || record.Kind == slread.KindNone {
+		return len(p), nil
+	}
+
+	converted, service := convert(record, w.dbSystem, w.now())
+	if service == nil {
+		service = w.service
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return len(p), nil
+	}
+
+	w.pending = append(w.pending, pendingRecord{record: converted, service: service})
+	if len(w.pending) >= w.batchSize {
+		w.enqueue()
+	}
+
+	return len(p), nil
+}
+
+// Flush exports the pending records and waits until they and every batch queued before them have been exported. It
+// returns the error of exporting the pending records.
+func (w *Writer) Flush() error {
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+
+	job := w.takePending()
+	w.senders.Add(1)
+	w.mu.Unlock()
+	defer w.senders.Done()
+
+	w.queue <- job
+	return <-job.done
+}
+
+// Close stops the periodic export, exports the pending records and waits until every queued batch has been
+// exported.
+func (w *Writer) Close() error {
+	w.stop.Do(func() {
+		close(w.done)
+	})
+	w.wg.Wait()
+
+	w.mu.Lock()
+	if w.closed {
+		w.mu.Unlock()
+		return nil
+	}
+
+	w.closed = true
+	job := w.takePending()
+	w.mu.Unlock()
+
+	// no Flush may send to the queue once it is closed
+	w.senders.Wait()
+	w.queue <- job
+	err := <-job.done
+
+	close(w.queue)
+	w.exporting.Wait()
+
+	return err
+}
+
+// takePending returns a job for the pending records that reports its result. w.mu must be held.
+func (w *Writer) takePending() exportJob {
+	job := exportJob{batch: w.pending, done: make(chan error, 1)}
+	w.pending = nil
+
+	return job
+}
+
+// enqueue queues the pending records without waiting and drops them if the queue is full. w.mu must be held.
+func (w *Writer) enqueue() {
+	if len(w.pending) == 0 {
+		return
+	}
+
+	select {
+	case w.queue <- exportJob{batch: w.pending}:
+	default:
+		reportError(fmt.Errorf("could not export %d log records: the export queue is full", len(w.pending)))
+	}
+
+	w.pending = nil
+}
+
+// exportQueued exports the queued batches in order until the queue is closed
+func (w *Writer) exportQueued() {
+	defer w.exporting.Done()
+
+	for job := range w.queue {
+		err := w.exportBatch(job.batch)
+		if job.done != nil {
+			job.done <- err
+		} else if err != nil {
+			reportError(err)
+		}
+	}
+}
+
+func (w *Writer) exportBatch(batch []pendingRecord) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(exportRequestOf(batch))
+	if err != nil {
+		return fmt.Errorf("could not encode %d log records: %w", len(batch), err)
+	}
+
+	return w.export(payload)
+}
+
+func (w *Writer) flushEvery(interval time.Duration) {
+	defer w.wg.Done()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-ticker.C:
+			w.mu.Lock()
+			w.enqueue()
+			w.mu.Unlock()
+		}
+	}
+}
+
+func (w *Writer) post(endpoint string, payload []byte) error {
+	req, err := http.NewRequest(http.MethodPost, endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return fmt.Errorf("could not create OTLP request: %w", err)
+	}
+
+	for key, values := range w.headers {
+		req.Header[key] = values
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("could not export log records: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("could not export log records: %s returned %s", endpoint, resp.Status)
+	}
+
+	return nil
+}
+
+// exportRequestOf groups the records of batch by their service, keeping the order of both
+func exportRequestOf(batch []pendingRecord) exportRequest {
+	var req exportRequest
+	index := make(map[slutil.ServiceInfo]int)
+
+	for _, pending := range batch {
+		var key slutil.ServiceInfo
+		if pending.service != nil {
+			key = *pending.service
+		}
+
+		i, ok := index[key]
+		if !ok {
+			i = len(req.ResourceLogs)
+			index[key] = i
+			req.ResourceLogs = append(req.ResourceLogs, resourceLogs{
+				Resource:  resourceOf(pending.service),
+				ScopeLogs: []scopeLogs{{Scope: scope{Name: ScopeName}}},
+			})
+		}
+
+		logs := &req.ResourceLogs[i].ScopeLogs[0]
+		logs.LogRecords = append(logs.LogRecords, pending.record)
+	}
+
+	return req
+}
+
+// reportError reports a failed export nobody waits for the way zerolog reports failed writes
+func reportError(err error) {
+	if zerolog.ErrorHandler != nil {
+		zerolog.ErrorHandler(err)
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "slotlp: %v\n", err)
+}
@@ -0,0 +1,224 @@
+package slotlp
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/rs/zerolog"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slapi"
+	"github.com/seantcanavan/zerolog-json-structured-logs/sldb"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collector is an OTLP/HTTP endpoint remembering the requests it received
+type collector struct {
+	mu       sync.Mutex
+	headers  []http.Header
+	requests []exportRequest
+	status   int
+}
+
+func (c *collector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	var req exportRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.headers = append(c.headers, r.Header.Clone())
+	c.requests = append(c.requests, req)
+
+	if c.status != 0 {
+		w.WriteHeader(c.status)
+	}
+}
+
+func (c *collector) received() []exportRequest {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]exportRequest{}, c.requests...)
+}
+
+func logErrors(w io.Writer) {
+	logger := zerolog.New(w)
+	logger.Info().Msg("no error")
+	slutil.AddObject(logger.Error(), &slapi.APIError{Message: "not found", StatusCode: 404}).Msg("first")
+	slutil.AddObject(logger.Error(), &sldb.DatabaseError{Message: "no rows", Query: "SELECT 1"}).Msg("second")
+}
+
+func bodies(req exportRequest) []any {
+	var res []any
+	for _, logs := range req.ResourceLogs {
+		for _, scopeLogs := range logs.ScopeLogs {
+			for _, record := range scopeLogs.LogRecords {
+				res = append(res, plain(*record.Body))
+			}
+		}
+	}
+
+	return res
+}
+
+func TestHTTPWriter(t *testing.T) {
+	c := &collector{}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	w := NewHTTPWriter(server.URL+"/v1/logs", WithBatchSize(2), WithFlushInterval(0), WithHeader("Authorization", "Bearer token"))
+	logErrors(w)
+
+	// the batch was full after the second error
+	require.Eventually(t, func() bool {
+		return len(c.received()) == 1
+	}, time.Second, 5*time.Millisecond)
+	requests := c.received()
+	assert.Equal(t, []any{"first", "second"}, bodies(requests[0]))
+	assert.Equal(t, "application/json", c.headers[0].Get("Content-Type"))
+	assert.Equal(t, "Bearer token", c.headers[0].Get("Authorization"))
+
+	scopeLogs := requests[0].ResourceLogs[0].ScopeLogs
+	require.Len(t, scopeLogs, 1)
+	assert.Equal(t, ScopeName, scopeLogs[0].Scope.Name)
+
+	logger := zerolog.New(w)
+	slutil.AddObject(logger.Error(), &slapi.APIError{Message: "conflict", StatusCode: 409}).Msg("third")
+	assert.Len(t, c.received(), 1)
+
+	require.NoError(t, w.Close())
+	requests = c.received()
+	require.Len(t, requests, 2)
+	assert.Equal(t, []any{"third"}, bodies(requests[1]))
+
+	// nothing is pending
+	require.NoError(t, w.Flush())
+	assert.Len(t, c.received(), 2)
+}
+
+func TestHTTPWriter_Failure(t *testing.T) {
+	c := &collector{status: http.StatusServiceUnavailable}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	w := NewHTTPWriter(server.URL, WithFlushInterval(0))
+	logErrors(w)
+
+	err := w.Flush()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "503 Service Unavailable")
+
+	// the failed batch is dropped
+	require.NoError(t, w.Close())
+	assert.Len(t, c.received(), 1)
+}
+
+func TestHTTPWriter_Background(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	var reported []error
+	var mu sync.Mutex
+	zerolog.ErrorHandler = func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		reported = append(reported, err)
+	}
+	defer func() { zerolog.ErrorHandler = nil }()
+
+	w := NewHTTPWriter(server.URL, WithBatchSize(1), WithFlushInterval(0), WithQueueSize(1))
+
+	// Write neither waits for the collector nor returns its errors, batches beyond the queue are dropped
+	for i := 0; i < 4; i++ {
+		n, err := w.Write(logLine(t, i))
+		require.NoError(t, err)
+		assert.NotZero(t, n)
+	}
+
+	close(release)
+	require.NoError(t, w.Close())
+
+	mu.Lock()
+	defer mu.Unlock()
+	var full, failed int
+	for _, err := range reported {
+		switch {
+		case strings.Contains(err.Error(), "the export queue is full"):
+			full++
+		case strings.Contains(err.Error(), "503 Service Unavailable"):
+			failed++
+		}
+	}
+	assert.Equal(t, len(reported), full+failed, reported)
+	assert.Equal(t, 4, full+failed)
+	assert.GreaterOrEqual(t, full, 2, "one batch is exported and one queued while the collector does not answer")
+}
+
+// logLine returns the line logged for an APIError
+func logLine(t *testing.T, i int) []byte {
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	slutil.AddObject(logger.Error(), &slapi.APIError{Message: "not found", StatusCode: 404}).Int("i", i).Send()
+	require.NotZero(t, buf.Len())
+
+	return buf.Bytes()
+}
+
+func TestHTTPWriter_FlushInterval(t *testing.T) {
+	c := &collector{}
+	server := httptest.NewServer(c)
+	defer server.Close()
+
+	w := NewHTTPWriter(server.URL, WithFlushInterval(10*time.Millisecond))
+	defer w.Close()
+	logErrors(w)
+
+	require.Eventually(t, func() bool {
+		return len(c.received()) == 1
+	}, time.Second, 5*time.Millisecond)
+	assert.Equal(t, []any{"first", "second"}, bodies(c.received()[0]))
+}
+
+func TestFileWriter(t *testing.T) {
+	var buf bytes.Buffer
+	w := NewFileWriter(&buf, WithFlushInterval(0), WithService(slutil.ServiceInfo{Name: "fallback"}))
+	logErrors(w)
+
+	slutil.SetServiceInfo(slutil.ServiceInfo{Name: "users"})
+	logger := zerolog.New(w)
+	slutil.AddObject(logger.Error(), &slapi.APIError{Message: "conflict", StatusCode: 409}).Msg("third")
+	slutil.ClearServiceInfo()
+
+	_, err := w.Write([]byte("not json\n"))
+	require.NoError(t, err)
+	assert.Zero(t, buf.Len())
+
+	require.NoError(t, w.Close())
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 1)
+
+	var req exportRequest
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &req))
+
+	// records are grouped by the service that logged them
+	require.Len(t, req.ResourceLogs, 2)
+	assert.Equal(t, map[string]any{ServiceNameKey: "fallback"}, attributeMap(req.ResourceLogs[0].Resource.Attributes))
+	assert.Equal(t, "users", attributeMap(req.ResourceLogs[1].Resource.Attributes)[ServiceNameKey])
+	assert.Equal(t, []any{"first", "second", "third"}, bodies(req))
+}
@@ -0,0 +1,367 @@
+package slread
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slapi"
+	"github.com/seantcanavan/zerolog-json-structured-logs/sldb"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
+	"io"
+	"time"
+)
+
+var dbErrorType = fmt.Sprintf("%T", &sldb.DatabaseError{})
+
+// Kind describes which error type a log line holds under slutil.ZLObjectKey.
+type Kind int
+
+const (
+	KindNone    Kind = iota // the line has no sl object
+	KindUnknown             // the line has an sl object that is neither an APIError nor a DatabaseError
+	KindAPI                 // the sl object is an slapi.APIError
+	KindDB                  // the sl object is an sldb.DatabaseError
+)
+
+// String returns the string representation of the Kind.
+func (k Kind) String() string {
+	switch k {
+	case KindAPI:
+		return "api"
+	case KindDB:
+		return "db"
+	case KindUnknown:
+		return "unknown"
+	default:
+		return "none"
+	}
+}
+
+// Record is a single decoded log line.
+type Record struct {
+	API     *slapi.APIError     // set when Kind is KindAPI
+	DB      *sldb.DatabaseError // set when Kind is KindDB
+	Fields  map[string]any      // the raw sl object, nil when Kind is KindNone
+	Kind    Kind
+	Level   string
+	Line    int // the 1-based line number in the input
+	Message string
+	Raw     []byte // the raw line without its trailing newline
+	Time    time.Time
+}
+
+// Err returns the decoded APIError or DatabaseError of the record or nil if it has neither.
+func (r *Record) Err() error {
+	switch r.Kind {
+	case KindAPI:
+		return r.API
+	case KindDB:
+		return r.DB
+	default:
+		return nil
+	}
+}
+
+// ExecContext returns the ExecContext of the decoded error of the record.
+func (r *Record) ExecContext() slutil.ExecContext {
+	switch r.Kind {
+	case KindAPI:
+		return r.API.ExecContext
+	case KindDB:
+		return r.DB.ExecContext
+	default:
+		return slutil.ExecContext{}
+	}
+}
+
+// Chain returns the wrapped error chain of the record if it was logged with one.
+func (r *Record) Chain() []map[string]any {
+	links, _ := r.Fields[slutil.ChainKey].([]any)
+
+	var res []map[string]any
+	for _, link := range links {
+		if obj, ok := link.(map[string]any); ok {
+			res = append(res, obj)
+		}
+	}
+
+	return res
+}
+
+// StatusCode returns the status code of the APIError of the record or 0 if it has none.
+func (r *Record) StatusCode() int {
+	if r.Kind != KindAPI {
+		return 0
+	}
+
+	return r.API.StatusCode
+}
+
+// RequestID returns the request ID of the APIError or DatabaseError of the record.
+func (r *Record) RequestID() string {
+	switch r.Kind {
+	case KindAPI:
+		return r.API.RequestID
+	case KindDB:
+		return r.DB.RequestID
+	default:
+		return ""
+	}
+}
+
+// TraceID returns the W3C trace ID of the APIError or DatabaseError of the record.
+func (r *Record) TraceID() string {
+	switch r.Kind {
+	case KindAPI:
+		return r.API.TraceID
+	case KindDB:
+		return r.DB.TraceID
+	default:
+		return ""
+	}
+}
+
+// OwnerID returns the owner ID of the APIError of the record.
+func (r *Record) OwnerID() string {
+	if r.Kind != KindAPI {
+		return ""
+	}
+
+	return r.API.OwnerID
+}
+
+// Service returns the ServiceInfo logged with the error of the record or nil if it was logged without one.
+func (r *Record) Service() *slutil.ServiceInfo {
+	fields, ok := r.Fields[slutil.ServiceKey].(map[string]any)
+	if !ok {
+		return nil
+	}
+
+	raw, err := json.Marshal(fields)
+	if err != nil {
+		return nil
+	}
+
+	var info slutil.ServiceInfo
+	if err = json.Unmarshal(raw, &info); err != nil {
+		return nil
+	}
+
+	return &info
+}
+
+// Fingerprint returns the fingerprint logged with the record. It is computed from the decoded error for lines
+// logged before fingerprints were added, which only matches the original if the inner error was a plain error.
+func (r *Record) Fingerprint() string {
+	if fingerprint, ok := r.Fields[slutil.FingerprintKey].(string); ok {
+		return fingerprint
+	}
+
+	return slutil.Fingerprint(r.Err())
+}
+
+// DatabaseErrors returns the DatabaseError of the record followed by every DatabaseError found in its logged chain.
+func (r *Record) DatabaseErrors() []*sldb.DatabaseError {
+	var res []*sldb.DatabaseError
+	if r.Kind == KindDB {
+		res = append(res, r.DB)
+	}
+
+	for _, link := range r.Chain() {
+		if link[slutil.ChainErrorTypeKey] != dbErrorType {
+			continue
+		}
+
+		marshalled, err := json.Marshal(link)
+		if err != nil {
+			continue
+		}
+
+		var dbErr sldb.DatabaseError
+		if err = json.Unmarshal(marshalled, &dbErr); err == nil {
+			res = append(res, &dbErr)
+		}
+	}
+
+	return res
+}
+
+// LineError is returned by Decoder.Next for a line that could not be decoded.
+// Decoding can continue with the next line after a LineError.
+type LineError struct {
+	Line int
+	Err  error
+}
+
+// Error returns the string representation of the LineError.
+func (e *LineError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Err)
+}
+
+// Unwrap provides the underlying error for use with errors.Is and errors.As functions.
+func (e *LineError) Unwrap() error {
+	return e.Err
+}
+
+// Decoder reads sl log lines one at a time from a stream of JSON lines.
+type Decoder struct {
+	line   int
+	reader *bufio.Reader
+}
+
+// NewDecoder returns a Decoder reading JSON lines from r. Lines of any length are supported.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{reader: bufio.NewReader(r)}
+}
+
+// Next decodes the next non-empty line. It returns io.EOF when the input is exhausted and a *LineError for
+// lines that are not valid sl log lines, in which case Next can be called again to continue with the next line.
+func (d *Decoder) Next() (*Record, error) {
+	for {
+		raw, err := d.reader.ReadBytes('\n')
+		if len(raw) == 0 && err != nil {
+			return nil, err
+		}
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, err
+		}
+
+		d.line++
+		raw = bytes.TrimSpace(raw)
+		if len(raw) == 0 {
+			continue
+		}
+
+		record, decodeErr := Decode(raw)
+		if decodeErr != nil {
+			return nil, &LineError{Line: d.line, Err: decodeErr}
+		}
+
+		record.Line = d.line
+		return record, nil
+	}
+}
+
+// ReadAll decodes every line of r. Lines that cannot be decoded are skipped and reported in the returned error
+// together with any read error, the successfully decoded records are returned either way.
+func ReadAll(r io.Reader) ([]*Record, error) {
+	var records []*Record
+	var errs []error
+
+	decoder := NewDecoder(r)
+	for {
+		record, err := decoder.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		var lineErr *LineError
+		if errors.As(err, &lineErr) {
+			errs = append(errs, err)
+			continue
+		} else if err != nil {
+			errs = append(errs, err)
+			break
+		}
+
+		records = append(records, record)
+	}
+
+	return records, errors.Join(errs...)
+}
+
+// Decode decodes a single JSON log line. The logged error is read in any slutil.LogEncoding layout and Fields
+// always holds its declared keys.
+func Decode(raw []byte) (*Record, error) {
+	var obj slutil.JSONObject
+	if err := json.Unmarshal(raw, &obj); err != nil {
+		return nil, err
+	}
+
+	record := &Record{Raw: raw}
+
+	var timestamp any
+	err := errors.Join(
+		obj.Decode(zerolog.LevelFieldName, &record.Level),
+		obj.Decode(zerolog.MessageFieldName, &record.Message),
+		obj.Decode(zerolog.TimestampFieldName, &timestamp),
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	if record.Time, err = parseTime(timestamp); err != nil {
+		return nil, fmt.Errorf("could not decode %s: %w", zerolog.TimestampFieldName, err)
+	}
+
+	var line map[string]any
+	if err = json.Unmarshal(raw, &line); err != nil {
+		return nil, err
+	}
+
+	fields, ok := slutil.LogObject(line)
+	if !ok {
+		if _, nested := line[slutil.ZLObjectKey]; nested {
+			return nil, fmt.Errorf("could not decode %s: not a JSON object", slutil.ZLObjectKey)
+		}
+
+		record.Kind = KindNone
+		return record, nil
+	}
+
+	record.Fields = fields
+	slObject, err := json.Marshal(fields)
+	if err != nil {
+		return nil, fmt.Errorf("could not decode %s: %w", slutil.ZLObjectKey, err)
+	}
+
+	switch detectKind(record.Fields) {
+	case KindAPI:
+		record.Kind = KindAPI
+		record.API = &slapi.APIError{}
+		err = json.Unmarshal(slObject, record.API)
+	case KindDB:
+		record.Kind = KindDB
+		record.DB = &sldb.DatabaseError{}
+		err = json.Unmarshal(slObject, record.DB)
+	default:
+		record.Kind = KindUnknown
+	}
+	if err != nil {
+		return nil, fmt.Errorf("could not decode %s as %s error: %w", slutil.ZLObjectKey, record.Kind, err)
+	}
+
+	return record, nil
+}
+
+func detectKind(fields map[string]any) Kind {
+	if _, ok := fields[slapi.StatusCodeKey]; ok {
+		return KindAPI
+	}
+
+	for _, key := range []string{sldb.DBNameKey, sldb.OperationKey, sldb.QueryKey, sldb.TableNameKey, sldb.TypeKey} {
+		if _, ok := fields[key]; ok {
+			return KindDB
+		}
+	}
+
+	return KindUnknown
+}
+
+// parseTime parses zerolog timestamps written as RFC3339 strings or as unix seconds.
+func parseTime(timestamp any) (time.Time, error) {
+	switch x := timestamp.(type) {
+	case nil:
+		return time.Time{}, nil
+	case string:
+		return time.Parse(time.RFC3339Nano, x)
+	case float64:
+		seconds := int64(x)
+		return time.Unix(seconds, int64((x-float64(seconds))*float64(time.Second))).UTC(), nil
+	default:
+		return time.Time{}, fmt.Errorf("unsupported timestamp %v", timestamp)
+	}
+}
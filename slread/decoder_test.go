@@ -0,0 +1,225 @@
+package slread
+
+import (
+	"bytes"
+	"errors"
+	"github.com/rs/zerolog"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slapi"
+	"github.com/seantcanavan/zerolog-json-structured-logs/sldb"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeTestLogs(t *testing.T) (*bytes.Buffer, *slapi.APIError, *sldb.DatabaseError) {
+	var buf bytes.Buffer
+	zerolog.TimeFieldFormat = time.RFC3339Nano
+	zerolog.TimestampFunc = slutil.StaticNowFunc
+	logger := zerolog.New(&buf).With().Timestamp().Logger()
+
+	dbErr := &sldb.DatabaseError{
+		Constraint:  "pk_users",
+		DBName:      "testdb",
+		ExecContext: slutil.GetExecContext(1),
+		InnerError:  errors.New("sql: no rows in result set"),
+		Message:     "no users found",
+		Operation:   "SELECT",
+		Query:       "SELECT * FROM users",
+		TableName:   "users",
+		Type:        sldb.ErrDBRecordNotFound,
+	}
+	slutil.AddObject(logger.Error(), dbErr).Msg(dbErr.Message)
+
+	apiErr := slapi.GenerateNonRandomAPIError()
+	apiErr.ExecContext = slutil.GetExecContext(1)
+	slutil.AddObject(logger.Error(), &apiErr).Send()
+
+	logger.Info().Msg("plain line")
+
+	return &buf, &apiErr, dbErr
+}
+
+func TestDecoder_Next(t *testing.T) {
+	buf, apiErr, dbErr := writeTestLogs(t)
+	decoder := NewDecoder(buf)
+
+	t.Run("database errors are decoded", func(t *testing.T) {
+		record, err := decoder.Next()
+		require.NoError(t, err)
+
+		assert.Equal(t, KindDB, record.Kind)
+		assert.Equal(t, 1, record.Line)
+		assert.Equal(t, zerolog.ErrorLevel.String(), record.Level)
+		assert.Equal(t, dbErr.Message, record.Message)
+		assert.Equal(t, slutil.StaticNowFunc(), record.Time)
+		require.NotNil(t, record.DB)
+		assert.Nil(t, record.API)
+
+		assert.Equal(t, dbErr.ExecContext, record.ExecContext())
+		assert.Equal(t, dbErr.Error(), record.Err().Error())
+		assert.Equal(t, dbErr.Type, record.DB.Type)
+		assert.Equal(t, dbErr.TableName, record.Fields[sldb.TableNameKey])
+	})
+
+	t.Run("api errors are decoded", func(t *testing.T) {
+		record, err := decoder.Next()
+		require.NoError(t, err)
+
+		assert.Equal(t, KindAPI, record.Kind)
+		assert.Equal(t, 2, record.Line)
+		require.NotNil(t, record.API)
+		assert.Nil(t, record.DB)
+
+		assert.Equal(t, apiErr.ExecContext, record.ExecContext())
+		assert.Equal(t, apiErr.Error(), record.Err().Error())
+		assert.Equal(t, apiErr.QueryParams, record.API.QueryParams)
+		assert.Equal(t, apiErr.MultiParams, record.API.MultiParams)
+		assert.Equal(t, apiErr.RequestID, record.API.RequestID)
+	})
+
+	t.Run("lines without an sl object are returned as KindNone", func(t *testing.T) {
+		record, err := decoder.Next()
+		require.NoError(t, err)
+
+		assert.Equal(t, KindNone, record.Kind)
+		assert.Equal(t, "plain line", record.Message)
+		assert.Equal(t, zerolog.InfoLevel.String(), record.Level)
+		assert.Nil(t, record.Err())
+		assert.Equal(t, slutil.ExecContext{}, record.ExecContext())
+	})
+
+	t.Run("io.EOF at the end of the input", func(t *testing.T) {
+		_, err := decoder.Next()
+		assert.ErrorIs(t, err, io.EOF)
+	})
+}
+
+func TestDecoder_Malformed(t *testing.T) {
+	input := strings.Join([]string{
+		`not json at all`,
+		``,
+		`{"level":"error","sl":{"statusCode":"five hundred"}}`,
+		`{"level":"error","time":"yesterday"}`,
+		`{"level":"error","sl":"a string"}`,
+		`{"level":"error","time":1700000000.5,"sl":{"widget":"sprocket"}}`,
+	}, "\n")
+
+	decoder := NewDecoder(strings.NewReader(input))
+
+	for _, expectedLine := range []int{1, 3, 4, 5} {
+		_, err := decoder.Next()
+
+		var lineErr *LineError
+		require.ErrorAs(t, err, &lineErr)
+		assert.Equal(t, expectedLine, lineErr.Line)
+	}
+
+	record, err := decoder.Next()
+	require.NoError(t, err)
+	assert.Equal(t, KindUnknown, record.Kind)
+	assert.Equal(t, 6, record.Line)
+	assert.Equal(t, time.Unix(1700000000, int64(500*time.Millisecond)).UTC(), record.Time)
+	assert.Equal(t, "sprocket", record.Fields["widget"])
+
+	_, err = decoder.Next()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestReadAll(t *testing.T) {
+	buf, _, _ := writeTestLogs(t)
+	buf.WriteString("{broken\n")
+
+	// lines longer than the default bufio buffer are supported
+	longQuery := strings.Repeat("x", 256*1024)
+	logger := zerolog.New(buf)
+	logger.Error().Object(slutil.ZLObjectKey, &sldb.DatabaseError{Query: longQuery}).Send()
+
+	records, err := ReadAll(buf)
+	require.Len(t, records, 4)
+
+	var lineErr *LineError
+	require.ErrorAs(t, err, &lineErr)
+	assert.Equal(t, 4, lineErr.Line)
+
+	assert.Equal(t, KindDB, records[3].Kind)
+	assert.Equal(t, longQuery, records[3].DB.Query)
+}
+
+func TestRecord_Chain(t *testing.T) {
+	slutil.LogErrorChain = true
+	defer func() { slutil.LogErrorChain = false }()
+
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	dbErr := &sldb.DatabaseError{TableName: "users", Type: sldb.ErrDBTimeout, InnerError: errors.New("timeout")}
+	logger.Error().Object(slutil.ZLObjectKey, &slapi.APIError{StatusCode: 504, InnerError: dbErr}).Send()
+
+	record, err := Decode(bytes.TrimSpace(buf.Bytes()))
+	require.NoError(t, err)
+
+	chain := record.Chain()
+	require.Len(t, chain, 2)
+	assert.Equal(t, "*sldb.DatabaseError", chain[0][slutil.ChainErrorTypeKey])
+	assert.Equal(t, sldb.ErrDBTimeout.String(), chain[0][sldb.TypeKey])
+}
+
+func TestRecord_Fingerprint(t *testing.T) {
+	buf, apiErr, _ := writeTestLogs(t)
+
+	records, err := ReadAll(buf)
+	require.NoError(t, err)
+	assert.Equal(t, slutil.Fingerprint(apiErr), records[1].Fingerprint())
+
+	// lines logged without a fingerprint fall back to computing it from the decoded error
+	record, err := Decode([]byte(`{"sl":{"statusCode":404,"message":"not found","innerError":"no rows"}}`))
+	require.NoError(t, err)
+	assert.Equal(t, slutil.Fingerprint(record.API), record.Fingerprint())
+	assert.NotEmpty(t, record.Fingerprint())
+}
+
+func TestDecode_Encodings(t *testing.T) {
+	buf, _, _ := writeTestLogs(t)
+	defaultLayout := buf.String()
+	expected, err := ReadAll(buf)
+	require.NoError(t, err)
+
+	encodings := map[string]slutil.Encoding{
+		"snake case":         {Keys: slutil.KeysSnakeCase},
+		"flattened":          {Flatten: true},
+		"flattened snake":    {Flatten: true, Keys: slutil.KeysSnakeCase, OmitEmpty: true},
+		"custom object key":  {ObjectKey: "error", OmitEmpty: true},
+		"custom flat prefix": {Flatten: true, Prefix: "error."},
+	}
+
+	for name, encoding := range encodings {
+		t.Run(name, func(t *testing.T) {
+			slutil.LogEncoding = encoding
+			defer func() { slutil.LogEncoding = slutil.Encoding{} }()
+
+			buf, apiErr, dbErr := writeTestLogs(t)
+			assert.NotEqual(t, defaultLayout, buf.String())
+
+			records, err := ReadAll(buf)
+			require.NoError(t, err)
+			require.Len(t, records, 3)
+
+			assert.Equal(t, KindDB, records[0].Kind)
+			assert.Equal(t, dbErr.Query, records[0].DB.Query)
+			assert.Equal(t, dbErr.Type, records[0].DB.Type)
+			assert.Equal(t, expected[0].Fingerprint(), records[0].Fingerprint())
+
+			assert.Equal(t, KindAPI, records[1].Kind)
+			assert.Equal(t, apiErr.StatusCode, records[1].API.StatusCode)
+			assert.Equal(t, apiErr.OwnerID, records[1].OwnerID())
+			assert.Equal(t, apiErr.PathParams, records[1].API.PathParams, "parameter names are never renamed")
+			assert.Equal(t, apiErr.ExecContext, records[1].API.ExecContext)
+			assert.Equal(t, expected[1].Fingerprint(), records[1].Fingerprint())
+
+			assert.Equal(t, KindNone, records[2].Kind)
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package slread
+
+import (
+	"github.com/seantcanavan/zerolog-json-structured-logs/sldb"
+	"strings"
+	"time"
+)
+
+// Filter selects records. Every non-empty criterion has to match for a record to be selected and
+// criteria holding several values match if any one of the values matches.
+type Filter struct {
+	DBTypes     []sldb.EnumDBErrorType // matched against DatabaseErrors and DatabaseErrors in the logged chain
+	Functions   []string
+	Levels      []string
+	OwnerIDs    []string
+	Packages    []string
+	RequestIDs  []string
+	Services    []string  // matched against the name of the logged ServiceInfo
+	Since       time.Time // inclusive
+	StatusCodes []int
+	Tables      []string // matched against DatabaseErrors and DatabaseErrors in the logged chain
+	TraceIDs    []string
+	Until       time.Time // exclusive
+}
+
+// Match reports whether record satisfies every criterion of the Filter.
+func (f Filter) Match(record *Record) bool {
+	if len(f.Levels) > 0 && !containsFold(f.Levels, record.Level) {
+		return false
+	}
+
+	if !f.Since.IsZero() && record.Time.Before(f.Since) {
+		return false
+	}
+
+	if !f.Until.IsZero() && !record.Time.Before(f.Until) {
+		return false
+	}
+
+	if len(f.StatusCodes) > 0 && !contains(f.StatusCodes, record.StatusCode()) {
+		return false
+	}
+
+	execCtx := record.ExecContext()
+	if len(f.Packages) > 0 && !contains(f.Packages, execCtx.Package) {
+		return false
+	}
+
+	if len(f.Functions) > 0 && !contains(f.Functions, execCtx.Function) {
+		return false
+	}
+
+	if len(f.RequestIDs) > 0 && !contains(f.RequestIDs, record.RequestID()) {
+		return false
+	}
+
+	if len(f.TraceIDs) > 0 && !contains(f.TraceIDs, record.TraceID()) {
+		return false
+	}
+
+	if len(f.OwnerIDs) > 0 && !contains(f.OwnerIDs, record.OwnerID()) {
+		return false
+	}
+
+	if len(f.Services) > 0 && !f.matchService(record) {
+		return false
+	}
+
+	if len(f.DBTypes) == 0 && len(f.Tables) == 0 {
+		return true
+	}
+
+	for _, dbErr := range record.DatabaseErrors() {
+		if (len(f.DBTypes) == 0 || contains(f.DBTypes, dbErr.Type)) && (len(f.Tables) == 0 || contains(f.Tables, dbErr.TableName)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (f Filter) matchService(record *Record) bool {
+	service := record.Service()
+	return service != nil && contains(f.Services, service.Name)
+}
+
+func contains[T comparable](values []T, value T) bool {
+	for _, current := range values {
+		if current == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsFold(values []string, value string) bool {
+	for _, current := range values {
+		if strings.EqualFold(current, value) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,81 @@
+package slread
+
+import (
+	"bytes"
+	"errors"
+	"github.com/rs/zerolog"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slapi"
+	"github.com/seantcanavan/zerolog-json-structured-logs/sldb"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestFilter_Match(t *testing.T) {
+	slutil.LogErrorChain = true
+	defer func() { slutil.LogErrorChain = false }()
+
+	at := time.Date(2023, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+
+	dbErr := &sldb.DatabaseError{
+		ExecContext: slutil.ExecContext{Function: "InsertUser", Package: "repo"},
+		InnerError:  errors.New("duplicate key"),
+		TableName:   "users",
+		TraceID:     "4bf92f3577b34da6a3ce929d0e0e4736",
+		Type:        sldb.ErrDBDuplicateEntry,
+	}
+	slutil.SetServiceInfo(slutil.ServiceInfo{Name: "billing"})
+	logger.Error().Time(zerolog.TimestampFieldName, at).Object(slutil.ZLObjectKey, dbErr).Send()
+	slutil.ClearServiceInfo()
+
+	apiErr := &slapi.APIError{
+		ExecContext: slutil.ExecContext{Function: "CreateUser", Package: "api"},
+		InnerError:  dbErr,
+		OwnerID:     "owner-1",
+		RequestID:   "req-1",
+		StatusCode:  409,
+	}
+	logger.Warn().Time(zerolog.TimestampFieldName, at.Add(time.Minute)).Object(slutil.ZLObjectKey, apiErr).Send()
+
+	records, err := ReadAll(&buf)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	dbRecord, apiRecord := records[0], records[1]
+	require.NotNil(t, dbRecord.Service())
+	assert.Equal(t, "billing", dbRecord.Service().Name)
+	assert.Nil(t, apiRecord.Service())
+
+	testCases := []struct {
+		name     string
+		filter   Filter
+		matchDB  bool
+		matchAPI bool
+	}{
+		{"empty filter matches everything", Filter{}, true, true},
+		{"level", Filter{Levels: []string{"WARN"}}, false, true},
+		{"since is inclusive", Filter{Since: at.Add(time.Minute)}, false, true},
+		{"until is exclusive", Filter{Until: at.Add(time.Minute)}, true, false},
+		{"status code", Filter{StatusCodes: []int{500, 409}}, false, true},
+		{"package", Filter{Packages: []string{"repo"}}, true, false},
+		{"function", Filter{Functions: []string{"CreateUser"}}, false, true},
+		{"request id", Filter{RequestIDs: []string{"req-1"}}, false, true},
+		{"trace id", Filter{TraceIDs: []string{"4bf92f3577b34da6a3ce929d0e0e4736"}}, true, false},
+		{"owner id", Filter{OwnerIDs: []string{"owner-2"}}, false, false},
+		{"service", Filter{Services: []string{"billing"}}, true, false},
+		{"db type matches the chain", Filter{DBTypes: []sldb.EnumDBErrorType{sldb.ErrDBDuplicateEntry}}, true, true},
+		{"db type and table must match the same error", Filter{DBTypes: []sldb.EnumDBErrorType{sldb.ErrDBDuplicateEntry}, Tables: []string{"orders"}}, false, false},
+		{"table", Filter{Tables: []string{"users"}}, true, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.matchDB, tc.filter.Match(dbRecord))
+			assert.Equal(t, tc.matchAPI, tc.filter.Match(apiRecord))
+		})
+	}
+}
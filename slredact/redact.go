@@ -0,0 +1,194 @@
+// Package slredact implements slutil.Redactor with rules matching sensitive parameter names and sensitive values
+// such as email addresses, JWTs, bearer tokens and card numbers.
+//
+// Install an Engine to redact every logged error:
+//
+//	slutil.Redaction = slredact.New(slredact.WithHMACKey(key))
+package slredact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// Mode is what happens to a sensitive value.
+type Mode int
+
+const (
+	// ModeMask replaces the value with Engine.Mask.
+	ModeMask Mode = iota
+	// ModeDrop leaves a parameter out entirely and removes a value from text.
+	ModeDrop
+	// ModeHMAC replaces the value with a keyed hash so equal values can still be correlated without being revealed.
+	// It behaves like ModeMask when the Engine has no HMAC key.
+	ModeHMAC
+)
+
+// DefaultMask replaces masked values.
+const DefaultMask = "[REDACTED]"
+
+// hmacPrefix marks pseudonymized values
+const hmacPrefix = "hmac:"
+
+// KeyRule redacts the whole value of every parameter whose name matches Pattern. Patterns are matched
+// case-insensitively with path.Match so "*_secret" matches "client_secret".
+type KeyRule struct {
+	Mode    Mode
+	Pattern string
+}
+
+// ValueRule redacts every match of Regexp in parameter values and text. Valid, if set, rejects matches that are
+// not sensitive after all, such as digit sequences failing the Luhn check.
+type ValueRule struct {
+	Mode   Mode
+	Name   string
+	Regexp *regexp.Regexp
+	Valid  func(match string) bool
+}
+
+// DefaultKeyRules mask parameters that commonly hold credentials.
+var DefaultKeyRules = []KeyRule{
+	{Pattern: "*_key"},
+	{Pattern: "*_secret"},
+	{Pattern: "*_token"},
+	{Pattern: "apikey"},
+	{Pattern: "authorization"},
+	{Pattern: "cookie"},
+	{Pattern: "passwd"},
+	{Pattern: "password"},
+	{Pattern: "secret"},
+	{Pattern: "session"},
+	{Pattern: "token"},
+}
+
+// DefaultValueRules mask bearer tokens, JWTs, email addresses and card numbers. Bearer tokens are matched first so
+// a JWT used as a bearer token is redacted together with its scheme.
+var DefaultValueRules = []ValueRule{
+	{Name: "bearer", Regexp: regexp.MustCompile(`(?i)\bbearer\s+[A-Za-z0-9\-._~+/]+=*`)},
+	{Name: "jwt", Regexp: regexp.MustCompile(`\beyJ[A-Za-z0-9_-]*\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)},
+	{Name: "email", Regexp: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)},
+	{Name: "card", Regexp: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), Valid: Luhn},
+}
+
+// Engine is a slutil.Redactor applying KeyRules to parameter names and ValueRules to parameter values and text.
+type Engine struct {
+	HMACKey    []byte
+	KeyRules   []KeyRule
+	Mask       string
+	ValueRules []ValueRule
+}
+
+// New returns an Engine with DefaultKeyRules, DefaultValueRules and DefaultMask. The options are applied last so
+// any setting can be overridden.
+func New(options ...func(e *Engine)) *Engine {
+	e := &Engine{
+		KeyRules:   append([]KeyRule{}, DefaultKeyRules...),
+		Mask:       DefaultMask,
+		ValueRules: append([]ValueRule{}, DefaultValueRules...),
+	}
+
+	for _, option := range options {
+		option(e)
+	}
+
+	return e
+}
+
+// WithHMACKey sets the key ModeHMAC pseudonymizes values with.
+func WithHMACKey(key []byte) func(e *Engine) {
+	return func(e *Engine) {
+		e.HMACKey = key
+	}
+}
+
+// WithMode sets the mode of every rule of the Engine.
+func WithMode(mode Mode) func(e *Engine) {
+	return func(e *Engine) {
+		for i := range e.KeyRules {
+			e.KeyRules[i].Mode = mode
+		}
+		for i := range e.ValueRules {
+			e.ValueRules[i].Mode = mode
+		}
+	}
+}
+
+// RedactParam implements slutil.Redactor.
+func (e *Engine) RedactParam(key, value string) (string, bool) {
+	lower := strings.ToLower(key)
+	for _, rule := range e.KeyRules {
+		if matched, _ := path.Match(strings.ToLower(rule.Pattern), lower); matched {
+			if rule.Mode == ModeDrop {
+				return "", false
+			}
+			return e.replace(value, rule.Mode), true
+		}
+	}
+
+	return e.RedactText(value), true
+}
+
+// RedactText implements slutil.Redactor.
+func (e *Engine) RedactText(text string) string {
+	for _, rule := range e.ValueRules {
+		text = rule.Regexp.ReplaceAllStringFunc(text, func(match string) string {
+			if rule.Valid != nil && !rule.Valid(match) {
+				return match
+			}
+			return e.replace(match, rule.Mode)
+		})
+	}
+
+	return text
+}
+
+func (e *Engine) replace(value string, mode Mode) string {
+	switch {
+	case mode == ModeDrop:
+		return ""
+	case mode == ModeHMAC && len(e.HMACKey) > 0:
+		return Pseudonym(e.HMACKey, value)
+	default:
+		return e.Mask
+	}
+}
+
+// Pseudonym returns the stable replacement ModeHMAC logs for value: the first 16 hex characters of its
+// HMAC-SHA256 under key, prefixed with "hmac:".
+func Pseudonym(key []byte, value string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(value))
+
+	return hmacPrefix + hex.EncodeToString(mac.Sum(nil))[:16]
+}
+
+// Luhn reports whether the digits of number pass the Luhn checksum used by card numbers.
+// Spaces and dashes are ignored.
+func Luhn(number string) bool {
+	sum, digits := 0, 0
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c == ' ' || c == '-' {
+			continue
+		}
+		if c < '0' || c > '9' {
+			return false
+		}
+
+		d := int(c - '0')
+		if digits%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		digits++
+	}
+
+	return digits >= 13 && sum%10 == 0
+}
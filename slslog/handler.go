@@ -0,0 +1,287 @@
+// Package slslog provides a log/slog handler that writes through zerolog so slog records have the same layout
+// as the lines written by slapi and sldb, including the sl object of logged errors.
+package slslog
+
+import (
+	"context"
+	"errors"
+	"github.com/rs/zerolog"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slapi"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
+	"log/slog"
+	"runtime"
+	"strconv"
+)
+
+// HandlerOptions configures a Handler. The zero value is usable.
+type HandlerOptions struct {
+	// AddSource adds the file and line of the slog call under zerolog.CallerFieldName.
+	AddSource bool
+
+	// Level is the minimum level of records that are written, slog.LevelInfo if nil.
+	// Records are also dropped when they are below the level of the zerolog logger.
+	Level slog.Leveler
+
+	// KeepPlainErrors stops plain errors of records at slog.LevelError and above from being wrapped in an
+	// APIError built from the request details of the context. By default they are wrapped the way
+	// slapi.LogFinalCtx does so they are logged under the sl object like every other error.
+	KeepPlainErrors bool
+}
+
+// Handler is a slog.Handler writing records as zerolog events.
+//
+// The first attribute holding an error that logs itself, such as *slapi.APIError or *sldb.DatabaseError, is
+// written with slutil.AddObject and the fields of its MarshalZerologObject. Other errors are written like
+// zerolog's AnErr and groups become nested objects.
+type Handler struct {
+	goas   []groupOrAttrs
+	logger zerolog.Logger
+	opts   HandlerOptions
+}
+
+// groupOrAttrs is either a group opened with WithGroup or the attributes added with WithAttrs
+type groupOrAttrs struct {
+	attrs []slog.Attr
+	group string
+}
+
+// NewHandler returns a Handler writing to logger.
+func NewHandler(logger zerolog.Logger, opts *HandlerOptions) *Handler {
+	h := &Handler{logger: logger}
+	if opts != nil {
+		h.opts = *opts
+	}
+
+	return h
+}
+
+// New returns a slog.Logger using a Handler writing to logger.
+func New(logger zerolog.Logger, opts *HandlerOptions) *slog.Logger {
+	return slog.New(NewHandler(logger, opts))
+}
+
+// Enabled implements slog.Handler.
+func (h *Handler) Enabled(_ context.Context, level slog.Level) bool {
+	minLevel := slog.LevelInfo
+	if h.opts.Level != nil {
+		minLevel = h.opts.Level.Level()
+	}
+
+	zlLevel := ZerologLevel(level)
+	return level >= minLevel && zlLevel >= h.logger.GetLevel() && zlLevel >= zerolog.GlobalLevel()
+}
+
+// WithAttrs implements slog.Handler.
+func (h *Handler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+
+	return h.with(groupOrAttrs{attrs: attrs})
+}
+
+// WithGroup implements slog.Handler.
+func (h *Handler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+
+	return h.with(groupOrAttrs{group: name})
+}
+
+func (h *Handler) with(goa groupOrAttrs) *Handler {
+	clone := *h
+	clone.goas = append(append([]groupOrAttrs{}, h.goas...), goa)
+
+	return &clone
+}
+
+// Handle implements slog.Handler.
+func (h *Handler) Handle(ctx context.Context, record slog.Record) error {
+	zle := h.logger.WithLevel(ZerologLevel(record.Level))
+	if zle == nil {
+		return nil
+	}
+
+	if !record.Time.IsZero() {
+		zle.Time(zerolog.TimestampFieldName, record.Time)
+	}
+
+	source := sourceOf(record)
+	if h.opts.AddSource && source.File != "" {
+		zle.Str(zerolog.CallerFieldName, source.File+":"+strconv.Itoa(source.Line))
+	}
+
+	var recordAttrs []slog.Attr
+	record.Attrs(func(attr slog.Attr) bool {
+		recordAttrs = append(recordAttrs, attr)
+		return true
+	})
+
+	w := &eventWriter{}
+	goas := append(append([]groupOrAttrs{}, h.goas...), groupOrAttrs{attrs: recordAttrs})
+	w.write(zle, goas)
+
+	loggable := w.loggable
+	if loggable == nil && w.plainErr != nil && !h.opts.KeepPlainErrors && record.Level >= slog.LevelError {
+		loggable = wrap(ctx, w.plainErr, record.Message, source)
+	}
+
+	if loggable != nil {
+		slutil.AddObject(zle, loggable)
+		slutil.MarkLogged(loggable)
+	}
+
+	zle.Msg(slutil.LimitMessage(record.Message))
+
+	return nil
+}
+
+// eventWriter writes attributes to zerolog events and remembers the errors it came across
+type eventWriter struct {
+	loggable slutil.Loggable
+	plainErr error
+}
+
+// write adds goas to zle, nesting everything after a group in a dictionary named after it
+func (w *eventWriter) write(zle *zerolog.Event, goas []groupOrAttrs) {
+	for i, goa := range goas {
+		if goa.group == "" {
+			w.attrs(zle, goa.attrs)
+			continue
+		}
+
+		// groups without attributes are omitted like slog's own handlers do
+		if !hasAttrs(goas[i+1:]) {
+			return
+		}
+
+		dict := zerolog.Dict()
+		w.write(dict, goas[i+1:])
+		zle.Dict(goa.group, dict)
+		return
+	}
+}
+
+func (w *eventWriter) attrs(zle *zerolog.Event, attrs []slog.Attr) {
+	for _, attr := range attrs {
+		w.attr(zle, attr)
+	}
+}
+
+func (w *eventWriter) attr(zle *zerolog.Event, attr slog.Attr) {
+	value := attr.Value.Resolve()
+	if attr.Equal(slog.Attr{}) {
+		return
+	}
+
+	switch value.Kind() {
+	case slog.KindBool:
+		zle.Bool(attr.Key, value.Bool())
+	case slog.KindDuration:
+		zle.Dur(attr.Key, value.Duration())
+	case slog.KindFloat64:
+		zle.Float64(attr.Key, value.Float64())
+	case slog.KindInt64:
+		zle.Int64(attr.Key, value.Int64())
+	case slog.KindString:
+		zle.Str(attr.Key, value.String())
+	case slog.KindTime:
+		zle.Time(attr.Key, value.Time())
+	case slog.KindUint64:
+		zle.Uint64(attr.Key, value.Uint64())
+	case slog.KindGroup:
+		group := value.Group()
+		if len(group) == 0 {
+			return
+		}
+
+		if attr.Key == "" {
+			// an inline group's attributes belong to the enclosing object
+			w.attrs(zle, group)
+			return
+		}
+
+		dict := zerolog.Dict()
+		w.attrs(dict, group)
+		zle.Dict(attr.Key, dict)
+	default:
+		w.anyValue(zle, attr.Key, value.Any())
+	}
+}
+
+func (w *eventWriter) anyValue(zle *zerolog.Event, key string, value any) {
+	err, ok := value.(error)
+	if !ok {
+		zle.Interface(key, value)
+		return
+	}
+
+	if loggable, ok := slutil.FindFirst[slutil.Loggable](err); ok && w.loggable == nil {
+		w.loggable = loggable
+		return
+	}
+
+	if w.plainErr == nil {
+		w.plainErr = err
+	}
+	zle.AnErr(key, err)
+}
+
+func hasAttrs(goas []groupOrAttrs) bool {
+	for _, goa := range goas {
+		if len(goa.attrs) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// wrap builds the APIError slapi.LogFinalCtx would log for err, attributed to the slog call
+func wrap(ctx context.Context, err error, message string, source slutil.ExecContext) slutil.Loggable {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	if message == "" {
+		message = slutil.PrettyErrMsgInternal()
+	}
+
+	wrapped := slapi.NewCtxMsg(ctx, err, message, slapi.DefaultAPIErrorStatusCode)
+
+	var apiErr *slapi.APIError
+	if errors.As(wrapped, &apiErr) {
+		apiErr.ExecContext = source
+	}
+
+	return apiErr
+}
+
+// sourceOf returns the location of the slog call that created record
+func sourceOf(record slog.Record) slutil.ExecContext {
+	if record.PC == 0 {
+		return slutil.ExecContext{}
+	}
+
+	frame, _ := runtime.CallersFrames([]uintptr{record.PC}).Next()
+
+	return slutil.FrameExecContext(frame)
+}
+
+// ZerologLevel converts a slog level to the zerolog level of the same severity. Levels between the named slog
+// levels are rounded down so slog.LevelWarn+2 is still a warning.
+func ZerologLevel(level slog.Level) zerolog.Level {
+	switch {
+	case level < slog.LevelDebug:
+		return zerolog.TraceLevel
+	case level < slog.LevelInfo:
+		return zerolog.DebugLevel
+	case level < slog.LevelWarn:
+		return zerolog.InfoLevel
+	case level < slog.LevelError:
+		return zerolog.WarnLevel
+	default:
+		return zerolog.ErrorLevel
+	}
+}
@@ -0,0 +1,158 @@
+package slslog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/rs/zerolog"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slapi"
+	"github.com/seantcanavan/zerolog-json-structured-logs/sldb"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slredact"
+	"github.com/seantcanavan/zerolog-json-structured-logs/sltrace"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log/slog"
+	"net/http"
+	"testing"
+	"testing/slogtest"
+	"time"
+)
+
+func decodeLine(t *testing.T, line []byte) map[string]any {
+	var fields map[string]any
+	require.NoError(t, json.Unmarshal(line, &fields))
+	return fields
+}
+
+func TestHandler_MatchesZerolog(t *testing.T) {
+	apiErr := slapi.GenerateNonRandomAPIError()
+
+	var zlBuf, slogBuf bytes.Buffer
+	zlLogger := zerolog.New(&zlBuf)
+	zlLogger.Error().Object(slutil.ZLObjectKey, &apiErr).Msg("request failed")
+
+	logger := New(zerolog.New(&slogBuf), nil)
+	logger.Error("request failed", "err", &apiErr)
+
+	// slog records carry a time, the zerolog logger was not configured to add one
+	slogFields := decodeLine(t, slogBuf.Bytes())
+	delete(slogFields, zerolog.TimestampFieldName)
+	assert.Equal(t, decodeLine(t, zlBuf.Bytes()), slogFields)
+	assert.True(t, apiErr.Logged())
+}
+
+func TestHandler(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(zerolog.New(&buf), &HandlerOptions{AddSource: true, Level: slog.LevelDebug})
+
+	dbErr := &sldb.DatabaseError{TableName: "users", Type: sldb.ErrDBTimeout, InnerError: errors.New("timeout")}
+	logger.With("service", "users").WithGroup("request").Warn("slow query",
+		"attempt", 2,
+		"elapsed", 1500*time.Millisecond,
+		slog.Group("db", "table", "users"),
+		"err", dbErr,
+		"cause", errors.New("plain"),
+	)
+
+	fields := decodeLine(t, buf.Bytes())
+	assert.Equal(t, zerolog.LevelWarnValue, fields[zerolog.LevelFieldName])
+	assert.Equal(t, "slow query", fields[zerolog.MessageFieldName])
+	assert.Equal(t, "users", fields["service"])
+	assert.Contains(t, fields[zerolog.CallerFieldName], "handler_test.go:")
+	assert.Equal(t, map[string]any{
+		"attempt": float64(2),
+		"elapsed": float64(1500),
+		"db":      map[string]any{"table": "users"},
+		"cause":   "plain",
+	}, fields["request"])
+
+	sl := fields[slutil.ZLObjectKey].(map[string]any)
+	assert.Equal(t, "users", sl[sldb.TableNameKey])
+	assert.Equal(t, sldb.ErrDBTimeout.String(), sl[sldb.TypeKey])
+}
+
+func TestHandler_WrapsPlainErrors(t *testing.T) {
+	var buf bytes.Buffer
+	logger := New(zerolog.New(&buf), nil)
+
+	trace := sltrace.New()
+	ctx := context.WithValue(context.Background(), slapi.RequestIDKey, "req-123")
+	ctx = context.WithValue(ctx, slapi.PathKey, "/orders")
+	ctx = sltrace.NewContext(ctx, trace)
+
+	logger.ErrorContext(ctx, "could not place order", "err", errors.New("out of stock"))
+
+	fields := decodeLine(t, buf.Bytes())
+	sl := fields[slutil.ZLObjectKey].(map[string]any)
+	assert.Equal(t, "req-123", sl[slapi.RequestIDKey])
+	assert.Equal(t, "/orders", sl[slapi.PathKey])
+	assert.Equal(t, trace.TraceID, sl[slapi.TraceIDKey])
+	assert.Equal(t, "could not place order", sl[slapi.MessageKey])
+	assert.Equal(t, "out of stock", sl[slapi.InnerErrorKey])
+	assert.Equal(t, float64(http.StatusInternalServerError), sl[slapi.StatusCodeKey])
+	assert.Equal(t, "TestHandler_WrapsPlainErrors", sl[slapi.FunctionKey])
+	assert.Equal(t, "slslog", sl[slapi.PackageKey])
+
+	t.Run("plain errors are kept when configured", func(t *testing.T) {
+		buf.Reset()
+		logger := New(zerolog.New(&buf), &HandlerOptions{KeepPlainErrors: true})
+		logger.ErrorContext(ctx, "could not place order", "err", errors.New("out of stock"))
+
+		fields := decodeLine(t, buf.Bytes())
+		assert.NotContains(t, fields, slutil.ZLObjectKey)
+		assert.Equal(t, "out of stock", fields["err"])
+	})
+
+	t.Run("warnings are not wrapped", func(t *testing.T) {
+		buf.Reset()
+		logger.WarnContext(ctx, "retrying", "err", errors.New("out of stock"))
+		assert.NotContains(t, decodeLine(t, buf.Bytes()), slutil.ZLObjectKey)
+	})
+}
+
+func TestHandler_Enabled(t *testing.T) {
+	handler := NewHandler(zerolog.New(nil).Level(zerolog.WarnLevel), &HandlerOptions{Level: slog.LevelDebug})
+	assert.False(t, handler.Enabled(context.Background(), slog.LevelInfo))
+	assert.True(t, handler.Enabled(context.Background(), slog.LevelWarn))
+
+	handler = NewHandler(zerolog.New(nil), nil)
+	assert.False(t, handler.Enabled(context.Background(), slog.LevelDebug))
+	assert.True(t, handler.Enabled(context.Background(), slog.LevelInfo))
+
+	assert.Equal(t, zerolog.TraceLevel, ZerologLevel(slog.LevelDebug-1))
+	assert.Equal(t, zerolog.WarnLevel, ZerologLevel(slog.LevelWarn+2))
+	assert.Equal(t, zerolog.ErrorLevel, ZerologLevel(slog.LevelError+4))
+}
+
+func TestHandler_SlogTest(t *testing.T) {
+	var buf bytes.Buffer
+	handler := NewHandler(zerolog.New(&buf), nil)
+
+	err := slogtest.TestHandler(handler, func() []map[string]any {
+		var res []map[string]any
+		for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+			fields := decodeLine(t, line)
+			// slogtest expects the key names of slog's built-in handlers
+			if message, ok := fields[zerolog.MessageFieldName]; ok {
+				fields[slog.MessageKey] = message
+				delete(fields, zerolog.MessageFieldName)
+			}
+			res = append(res, fields)
+		}
+		return res
+	})
+	require.NoError(t, err)
+}
+
+func TestHandler_RedactsMessage(t *testing.T) {
+	slutil.Redaction = slredact.New()
+	defer func() { slutil.Redaction = nil }()
+
+	var buf bytes.Buffer
+	New(zerolog.New(&buf), nil).Info("signed in jane@example.com")
+
+	fields := decodeLine(t, buf.Bytes())
+	assert.Equal(t, "signed in "+slredact.DefaultMask, fields[zerolog.MessageFieldName])
+}
@@ -0,0 +1,68 @@
+package slstdlog
+
+import (
+	"github.com/rs/zerolog"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
+)
+
+const FileKey = "file"
+const FunctionKey = "function"
+const LineKey = "line"
+const MessageKey = "message"
+const ModuleKey = "module"
+const PackageKey = "package"
+const SourceKey = "source"
+
+// StdLogError is the generic error a line written through the standard library log package at error level is
+// logged as, so it is grouped, filtered and reported like every other error.
+type StdLogError struct {
+	Message string
+	Source  string // what wrote the line, such as "http.Server" or "log"
+
+	slutil.ExecContext // the caller of the log package
+
+	logged bool // whether this error has already been written to the log
+}
+
+// Error returns the logged line.
+func (e *StdLogError) Error() string {
+	return e.Message
+}
+
+// Logged reports whether the StdLogError has already been written to the log.
+func (e *StdLogError) Logged() bool {
+	return e.logged
+}
+
+// MarkLogged records that the StdLogError has been written to the log so it is not logged again.
+func (e *StdLogError) MarkLogged() {
+	e.logged = true
+}
+
+// MarshalZerologObject allows StdLogError to be logged by zerolog.
+func (e *StdLogError) MarshalZerologObject(zle *zerolog.Event) {
+	var truncated slutil.Truncations
+	zle.
+		Int(LineKey, e.Line).
+		Str(FileKey, e.File).
+		Str(FunctionKey, e.Function).
+		Str(MessageKey, truncated.Text(MessageKey, e.Message, slutil.FieldLimits.Message)).
+		Str(ModuleKey, e.Module).
+		Str(PackageKey, e.Package).
+		Str(SourceKey, e.Source).
+		Str(slutil.FingerprintKey, slutil.Fingerprint(e))
+
+	slutil.AddTruncated(zle, truncated)
+	slutil.AddService(zle)
+}
+
+// FingerprintParts returns the fields that identify the kind of failure the StdLogError describes.
+func (e *StdLogError) FingerprintParts() []string {
+	return []string{
+		"stdlog",
+		e.Source,
+		e.Package,
+		e.Function,
+		slutil.NormalizeMessage(e.Message),
+	}
+}
@@ -0,0 +1,142 @@
+// Package slstdlog bridges the standard library log package to zerolog so lines written by legacy dependencies,
+// log.Printf calls and http.Server internals become structured events with the standard fields.
+package slstdlog
+
+import (
+	"github.com/rs/zerolog"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
+	"log"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+)
+
+// SourceHTTPServer is the source of lines written to the ErrorLog of an http.Server.
+const SourceHTTPServer = "http.Server"
+
+// SourceLog is the source of lines written through the standard logger of the log package.
+const SourceLog = "log"
+
+// stdPrefix matches the date, time and file written by the standard log flags
+var stdPrefix = regexp.MustCompile(`^(\d{4}/\d{2}/\d{2} )?(\d{2}:\d{2}:\d{2}(\.\d+)? )?([^\s:]+\.go:\d+: )?`)
+
+// levelTags are the level markers legacy code commonly starts its lines with, matched case-insensitively
+var levelTags = []struct {
+	level zerolog.Level
+	tags  []string
+}{
+	{zerolog.DebugLevel, []string{"[debug]", "debug:"}},
+	{zerolog.InfoLevel, []string{"[info]", "info:"}},
+	{zerolog.WarnLevel, []string{"[warn]", "[warning]", "warn:", "warning:"}},
+	{zerolog.ErrorLevel, []string{"[error]", "error:", "panic:", "http: panic"}},
+}
+
+// Writer is an io.Writer turning every write of the log package into a zerolog event.
+//
+// Each write is one log entry. The date, time and file the log flags may have added are removed, a level tag such
+// as "[WARN]" or "error:" at the start of the line sets the level and the caller of the log package is added under
+// zerolog.CallerFieldName. Entries at error level and above are logged with a StdLogError added by slutil.AddObject,
+// which holds the service info, and every other entry with the service info under slutil.ServiceKey.
+type Writer struct {
+	level  zerolog.Level
+	logger zerolog.Logger
+	source string
+}
+
+// NewWriter returns a Writer logging entries without a level tag at level. source names what writes the entries.
+func NewWriter(logger zerolog.Logger, level zerolog.Level, source string) *Writer {
+	return &Writer{level: level, logger: logger, source: source}
+}
+
+// NewLogger returns a *log.Logger writing through a Writer.
+func NewLogger(logger zerolog.Logger, level zerolog.Level, source string) *log.Logger {
+	return log.New(NewWriter(logger, level, source), "", 0)
+}
+
+// NewServerErrorLog returns a *log.Logger for http.Server.ErrorLog. The server only writes failures to it, such as
+// TLS handshake errors and recovered panics, so every entry is logged at error level.
+func NewServerErrorLog(logger zerolog.Logger) *log.Logger {
+	return NewLogger(logger, zerolog.ErrorLevel, SourceHTTPServer)
+}
+
+// RedirectStdLog sends the output of the standard logger of the log package through a Writer at level and
+// returns a function restoring the previous output and flags.
+func RedirectStdLog(logger zerolog.Logger, level zerolog.Level) func() {
+	flags, prefix, output := log.Flags(), log.Prefix(), log.Writer()
+
+	log.SetFlags(0)
+	log.SetPrefix("")
+	log.SetOutput(NewWriter(logger, level, SourceLog))
+
+	return func() {
+		log.SetFlags(flags)
+		log.SetPrefix(prefix)
+		log.SetOutput(output)
+	}
+}
+
+// Write logs p as one entry. It always reports p as written so the log package does not fail.
+func (w *Writer) Write(p []byte) (int, error) {
+	message := stdPrefix.ReplaceAllString(strings.TrimRight(string(p), "\r\n"), "")
+	caller := callerOf()
+
+	level := levelOf(message, w.level)
+	zle := w.logger.WithLevel(level)
+	if zle == nil {
+		return len(p), nil
+	}
+
+	if caller.File != "" {
+		zle.Str(zerolog.CallerFieldName, caller.File+":"+strconv.Itoa(caller.Line))
+	}
+
+	if level >= zerolog.ErrorLevel && level != zerolog.NoLevel {
+		stdErr := &StdLogError{ExecContext: caller, Message: message, Source: w.source}
+		slutil.AddObject(zle, stdErr)
+		stdErr.MarkLogged()
+	} else {
+		slutil.AddService(zle)
+	}
+
+	zle.Msg(slutil.LimitMessage(message))
+
+	return len(p), nil
+}
+
+// levelOf returns the level of the tag message starts with or level if it has none
+func levelOf(message string, level zerolog.Level) zerolog.Level {
+	lower := strings.ToLower(message)
+	for _, levelTag := range levelTags {
+		for _, tag := range levelTag.tags {
+			if strings.HasPrefix(lower, tag) {
+				return levelTag.level
+			}
+		}
+	}
+
+	return level
+}
+
+// callerOf returns the first frame outside the log package and this package
+func callerOf() slutil.ExecContext {
+	pcs := make([]uintptr, 32)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !isLogFrame(frame.Function) {
+			return slutil.FrameExecContext(frame)
+		}
+
+		if !more {
+			return slutil.ExecContext{}
+		}
+	}
+}
+
+func isLogFrame(function string) bool {
+	return strings.HasPrefix(function, "log.") ||
+		strings.HasPrefix(function, "log/internal.") ||
+		strings.Contains(function, "/slstdlog.(*Writer).") ||
+		strings.HasSuffix(function, "/slstdlog.callerOf")
+}
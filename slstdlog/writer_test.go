@@ -0,0 +1,150 @@
+package slstdlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/rs/zerolog"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slredact"
+	"github.com/seantcanavan/zerolog-json-structured-logs/slutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func logLines(t *testing.T, buf *bytes.Buffer) []map[string]any {
+	var lines []map[string]any
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		if len(line) == 0 {
+			continue
+		}
+
+		var fields map[string]any
+		require.NoError(t, json.Unmarshal(line, &fields))
+		lines = append(lines, fields)
+	}
+
+	return lines
+}
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New(NewWriter(zerolog.New(&buf), zerolog.InfoLevel, "legacy"), "", log.LstdFlags|log.Lshortfile)
+
+	logger.Println("cache warmed")
+	logger.Printf("[WARN] cache is %d%% full", 90)
+	logger.Print("error: could not reach cache\n")
+
+	lines := logLines(t, &buf)
+	require.Len(t, lines, 3)
+
+	assert.Equal(t, zerolog.LevelInfoValue, lines[0][zerolog.LevelFieldName])
+	assert.Equal(t, "cache warmed", lines[0][zerolog.MessageFieldName])
+	assert.Contains(t, lines[0][zerolog.CallerFieldName], "writer_test.go:")
+	assert.NotContains(t, lines[0], slutil.ZLObjectKey)
+
+	assert.Equal(t, zerolog.LevelWarnValue, lines[1][zerolog.LevelFieldName])
+	assert.Equal(t, "[WARN] cache is 90% full", lines[1][zerolog.MessageFieldName])
+
+	assert.Equal(t, zerolog.LevelErrorValue, lines[2][zerolog.LevelFieldName])
+	sl := lines[2][slutil.ZLObjectKey].(map[string]any)
+	assert.Equal(t, "error: could not reach cache", sl[MessageKey])
+	assert.Equal(t, "legacy", sl[SourceKey])
+	assert.Equal(t, "TestWriter", sl[FunctionKey])
+	assert.Equal(t, "slstdlog", sl[PackageKey])
+	assert.NotEmpty(t, sl[slutil.FingerprintKey])
+}
+
+func TestNewServerErrorLog(t *testing.T) {
+	var buf bytes.Buffer
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("handler exploded")
+	}))
+	server.Config.ErrorLog = NewServerErrorLog(zerolog.New(&buf))
+	server.Start()
+
+	_, err := http.Get(server.URL)
+	require.Error(t, err)
+	server.Close()
+
+	lines := logLines(t, &buf)
+	require.NotEmpty(t, lines)
+	assert.Equal(t, zerolog.LevelErrorValue, lines[0][zerolog.LevelFieldName])
+	assert.True(t, strings.HasPrefix(lines[0][zerolog.MessageFieldName].(string), "http: panic serving"))
+
+	sl := lines[0][slutil.ZLObjectKey].(map[string]any)
+	assert.Equal(t, SourceHTTPServer, sl[SourceKey])
+	assert.Equal(t, "http", sl[PackageKey])
+	assert.Contains(t, sl[MessageKey], "handler exploded")
+}
+
+func TestRedirectStdLog(t *testing.T) {
+	var buf bytes.Buffer
+	restore := RedirectStdLog(zerolog.New(&buf), zerolog.InfoLevel)
+	log.Printf("started on port %d", 8080)
+	restore()
+
+	lines := logLines(t, &buf)
+	require.Len(t, lines, 1)
+	assert.Equal(t, "started on port 8080", lines[0][zerolog.MessageFieldName])
+	assert.Equal(t, log.LstdFlags, log.Flags())
+}
+
+func TestLevelOf(t *testing.T) {
+	assert.Equal(t, zerolog.DebugLevel, levelOf("DEBUG: state", zerolog.InfoLevel))
+	assert.Equal(t, zerolog.WarnLevel, levelOf("Warning: disk almost full", zerolog.InfoLevel))
+	assert.Equal(t, zerolog.ErrorLevel, levelOf("panic: nil map", zerolog.InfoLevel))
+	assert.Equal(t, zerolog.InfoLevel, levelOf("errors are counted", zerolog.InfoLevel))
+}
+
+func TestWriter_RedactsMessage(t *testing.T) {
+	slutil.Redaction = slredact.New()
+	defer func() { slutil.Redaction = nil }()
+
+	var buf bytes.Buffer
+	logger := NewLogger(zerolog.New(&buf), zerolog.InfoLevel, "legacy")
+	logger.Print("signed in jane@example.com")
+	logger.Print("error: could not mail jane@example.com")
+
+	assert.NotContains(t, buf.String(), "jane@example.com")
+
+	lines := logLines(t, &buf)
+	require.Len(t, lines, 2)
+	assert.Equal(t, "signed in "+slredact.DefaultMask, lines[0][zerolog.MessageFieldName])
+	assert.Equal(t, "error: could not mail "+slredact.DefaultMask, lines[1][zerolog.MessageFieldName])
+}
+
+func TestWriter_LimitsMessage(t *testing.T) {
+	slutil.FieldLimits = slutil.Limits{Message: 9}
+	defer func() { slutil.FieldLimits = slutil.Limits{} }()
+
+	var buf bytes.Buffer
+	logger := NewLogger(zerolog.New(&buf), zerolog.InfoLevel, "legacy")
+	logger.Print("error: could not connect")
+
+	lines := logLines(t, &buf)
+	require.Len(t, lines, 1)
+	assert.Equal(t, "error: co", lines[0][zerolog.MessageFieldName])
+
+	sl := lines[0][slutil.ZLObjectKey].(map[string]any)
+	assert.Equal(t, "error: co", sl[MessageKey])
+	assert.Equal(t, map[string]any{MessageKey: float64(24)}, sl[slutil.TruncatedKey])
+}
+
+func TestWriter_Service(t *testing.T) {
+	slutil.SetServiceInfo(slutil.ServiceInfo{Name: "legacy-app", Version: "1.0.0"})
+	defer slutil.ClearServiceInfo()
+
+	var buf bytes.Buffer
+	logger := NewLogger(zerolog.New(&buf), zerolog.InfoLevel, "legacy")
+	logger.Print("listening on :8080")
+	logger.Print("error: could not connect")
+
+	lines := logLines(t, &buf)
+	require.Len(t, lines, 2)
+	assert.Equal(t, "legacy-app", lines[0][slutil.ServiceKey].(map[string]any)["name"])
+	assert.Equal(t, "legacy-app", lines[1][slutil.ZLObjectKey].(map[string]any)[slutil.ServiceKey].(map[string]any)["name"])
+}
@@ -0,0 +1,16 @@
+module github.com/seantcanavan/zerolog-json-structured-logs/sltrace/slotel
+
+go 1.21
+
+require (
+	github.com/seantcanavan/zerolog-json-structured-logs v0.0.0-20261018181919-6140c3aebe53
+	github.com/stretchr/testify v1.8.4
+	go.opentelemetry.io/otel/trace v1.21.0
+)
+
+require (
+	github.com/davecgh/go-spew v1.1.1 // indirect
+	github.com/pmezard/go-difflib v1.0.0 // indirect
+	go.opentelemetry.io/otel v1.21.0 // indirect
+	gopkg.in/yaml.v3 v3.0.1 // indirect
+)
@@ -0,0 +1,37 @@
+// Package slotel lets sltrace use the OpenTelemetry span of a context so the trace and span IDs logged with
+// APIError and DatabaseError match the spans exported by OpenTelemetry.
+//
+// It lives in its own module so that only applications that already use OpenTelemetry depend on it:
+//
+//	func main() {
+//		slotel.Register()
+//		...
+//	}
+package slotel
+
+import (
+	"context"
+	"github.com/seantcanavan/zerolog-json-structured-logs/sltrace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Register makes sltrace.FromContext prefer the OpenTelemetry span of a context over the trace context stored
+// by the slapi middleware.
+func Register() {
+	sltrace.RegisterExtractor(FromContext)
+}
+
+// FromContext converts the span context of the OpenTelemetry span in ctx to an sltrace.TraceContext.
+func FromContext(ctx context.Context) (sltrace.TraceContext, bool) {
+	spanCtx := trace.SpanContextFromContext(ctx)
+	if !spanCtx.IsValid() {
+		return sltrace.TraceContext{}, false
+	}
+
+	return sltrace.TraceContext{
+		Flags:      byte(spanCtx.TraceFlags()),
+		SpanID:     spanCtx.SpanID().String(),
+		TraceID:    spanCtx.TraceID().String(),
+		TraceState: spanCtx.TraceState().String(),
+	}, true
+}
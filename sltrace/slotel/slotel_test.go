@@ -0,0 +1,53 @@
+package slotel
+
+import (
+	"context"
+	"github.com/seantcanavan/zerolog-json-structured-logs/sltrace"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+	"testing"
+)
+
+func otelContext(t *testing.T) context.Context {
+	traceID, err := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	require.NoError(t, err)
+	spanID, err := trace.SpanIDFromHex("00f067aa0ba902b7")
+	require.NoError(t, err)
+	state, err := trace.ParseTraceState("vendor=value")
+	require.NoError(t, err)
+
+	spanCtx := trace.NewSpanContext(trace.SpanContextConfig{
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+		TraceID:    traceID,
+		TraceState: state,
+	})
+
+	return trace.ContextWithSpanContext(context.Background(), spanCtx)
+}
+
+func TestFromContext(t *testing.T) {
+	tc, ok := FromContext(otelContext(t))
+	require.True(t, ok)
+	assert.Equal(t, sltrace.TraceContext{
+		Flags:      sltrace.FlagSampled,
+		SpanID:     "00f067aa0ba902b7",
+		TraceID:    "4bf92f3577b34da6a3ce929d0e0e4736",
+		TraceState: "vendor=value",
+	}, tc)
+	assert.True(t, tc.IsValid())
+
+	_, ok = FromContext(context.Background())
+	assert.False(t, ok)
+}
+
+func TestRegister(t *testing.T) {
+	Register()
+
+	// the OpenTelemetry span wins over the trace context stored by the middleware
+	ctx := sltrace.NewContext(otelContext(t), sltrace.New())
+	traceID, spanID := sltrace.IDs(ctx)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", traceID)
+	assert.Equal(t, "00f067aa0ba902b7", spanID)
+}
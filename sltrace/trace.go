@@ -0,0 +1,204 @@
+// Package sltrace parses, generates and propagates W3C Trace Context headers so APIError and DatabaseError can be
+// correlated with distributed traces without depending on OpenTelemetry.
+package sltrace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// TraceparentHeader and TracestateHeader are the W3C Trace Context headers, see https://www.w3.org/TR/trace-context/
+const TraceparentHeader = "traceparent"
+const TracestateHeader = "tracestate"
+
+// ContextKey is the context key the TraceContext of the current request is stored under.
+const ContextKey = "traceContext"
+
+// FlagSampled is the trace flag set when the caller records the trace.
+const FlagSampled byte = 0x01
+
+const version = "00"
+
+var ErrInvalidTraceparent = errors.New("invalid traceparent")
+
+// TraceContext identifies the span of the current operation within a distributed trace.
+type TraceContext struct {
+	Flags        byte
+	ParentSpanID string // the span ID received in the traceparent header, empty for a new trace
+	SpanID       string // 16 lowercase hex characters
+	TraceID      string // 32 lowercase hex characters
+	TraceState   string // the tracestate header passed on unchanged
+}
+
+// IsValid reports whether the TraceContext has a well formed, non-zero trace ID and span ID.
+func (tc TraceContext) IsValid() bool {
+	return isID(tc.TraceID, 32) && isID(tc.SpanID, 16)
+}
+
+// Sampled reports whether the sampled flag is set.
+func (tc TraceContext) Sampled() bool {
+	return tc.Flags&FlagSampled != 0
+}
+
+// Traceparent formats the TraceContext as a version 00 traceparent header value.
+func (tc TraceContext) Traceparent() string {
+	return fmt.Sprintf("%s-%s-%s-%02x", version, tc.TraceID, tc.SpanID, tc.Flags)
+}
+
+// Child returns a TraceContext for a new span within the same trace whose parent is tc.
+func (tc TraceContext) Child() TraceContext {
+	return TraceContext{
+		Flags:        tc.Flags,
+		ParentSpanID: tc.SpanID,
+		SpanID:       newID(8),
+		TraceID:      tc.TraceID,
+		TraceState:   tc.TraceState,
+	}
+}
+
+// New returns a TraceContext starting a new sampled trace.
+func New() TraceContext {
+	return TraceContext{
+		Flags:   FlagSampled,
+		SpanID:  newID(8),
+		TraceID: newID(16),
+	}
+}
+
+// Parse parses a traceparent header value. Versions other than 00 are accepted as long as the first four
+// fields have the version 00 layout, as the specification asks of parsers.
+func Parse(traceparent string) (TraceContext, error) {
+	parts := strings.Split(strings.TrimSpace(traceparent), "-")
+	if len(parts) < 4 || (parts[0] == version && len(parts) != 4) {
+		return TraceContext{}, fmt.Errorf("%w: %q", ErrInvalidTraceparent, traceparent)
+	}
+
+	if !isHex(parts[0], 2) || parts[0] == "ff" || !isHex(parts[3], 2) {
+		return TraceContext{}, fmt.Errorf("%w: %q", ErrInvalidTraceparent, traceparent)
+	}
+
+	flags, _ := hex.DecodeString(parts[3])
+	tc := TraceContext{Flags: flags[0], SpanID: parts[2], TraceID: parts[1]}
+	if !tc.IsValid() {
+		return TraceContext{}, fmt.Errorf("%w: %q", ErrInvalidTraceparent, traceparent)
+	}
+
+	return tc, nil
+}
+
+// FromHeaders returns a child of the trace context carried by the traceparent and tracestate headers of h,
+// or a new trace when h has no valid traceparent header.
+func FromHeaders(h http.Header) TraceContext {
+	parent, err := Parse(h.Get(TraceparentHeader))
+	if err != nil {
+		return New()
+	}
+
+	parent.TraceState = strings.Join(h.Values(TracestateHeader), ",")
+
+	return parent.Child()
+}
+
+// Inject sets the traceparent and tracestate headers of h so the receiver continues the trace of tc.
+func Inject(h http.Header, tc TraceContext) {
+	if !tc.IsValid() {
+		return
+	}
+
+	h.Set(TraceparentHeader, tc.Traceparent())
+	if tc.TraceState != "" {
+		h.Set(TracestateHeader, tc.TraceState)
+	} else {
+		h.Del(TracestateHeader)
+	}
+}
+
+// NewContext returns a copy of ctx holding tc.
+func NewContext(ctx context.Context, tc TraceContext) context.Context {
+	return context.WithValue(ctx, ContextKey, tc)
+}
+
+// Extractor finds a TraceContext in a context that was stored there by another tracing library.
+type Extractor func(ctx context.Context) (TraceContext, bool)
+
+var (
+	extractors   []Extractor
+	extractorsMu sync.RWMutex
+)
+
+// RegisterExtractor adds an Extractor that FromContext consults before the TraceContext stored with NewContext.
+// Adapters such as the OpenTelemetry adapter in sltrace/slotel register themselves here so the span of the
+// tracing library is used when there is one.
+func RegisterExtractor(extractor Extractor) {
+	extractorsMu.Lock()
+	defer extractorsMu.Unlock()
+
+	extractors = append(extractors, extractor)
+}
+
+// FromContext returns the TraceContext of ctx. A span found by a registered Extractor takes precedence over
+// the TraceContext stored with NewContext.
+func FromContext(ctx context.Context) (TraceContext, bool) {
+	if ctx == nil {
+		return TraceContext{}, false
+	}
+
+	extractorsMu.RLock()
+	defer extractorsMu.RUnlock()
+
+	for _, extractor := range extractors {
+		if tc, ok := extractor(ctx); ok && tc.IsValid() {
+			return tc, true
+		}
+	}
+
+	tc, ok := ctx.Value(ContextKey).(TraceContext)
+	return tc, ok && tc.IsValid()
+}
+
+// IDs returns the trace ID and span ID of ctx, or empty strings when ctx has no TraceContext.
+func IDs(ctx context.Context) (traceID, spanID string) {
+	tc, _ := FromContext(ctx)
+	return tc.TraceID, tc.SpanID
+}
+
+// isID reports whether s is a lowercase hex string of length n that is not all zeros
+func isID(s string, n int) bool {
+	return isHex(s, n) && strings.Trim(s, "0") != ""
+}
+
+func isHex(s string, n int) bool {
+	if len(s) != n {
+		return false
+	}
+
+	for _, c := range s {
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+
+	return true
+}
+
+func newID(n int) string {
+	b := make([]byte, n)
+	for {
+		if _, err := rand.Read(b); err != nil {
+			return ""
+		}
+
+		// an all zero ID is invalid
+		for _, x := range b {
+			if x != 0 {
+				return hex.EncodeToString(b)
+			}
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package sltrace
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+const testTraceparent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestParse(t *testing.T) {
+	t.Run("valid traceparent", func(t *testing.T) {
+		tc, err := Parse(testTraceparent)
+		require.NoError(t, err)
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", tc.TraceID)
+		assert.Equal(t, "00f067aa0ba902b7", tc.SpanID)
+		assert.True(t, tc.Sampled())
+		assert.Equal(t, testTraceparent, tc.Traceparent())
+	})
+
+	t.Run("future version with extra fields", func(t *testing.T) {
+		tc, err := Parse("01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra")
+		require.NoError(t, err)
+		assert.False(t, tc.Sampled())
+	})
+
+	for _, traceparent := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-zz",
+	} {
+		_, err := Parse(traceparent)
+		assert.True(t, errors.Is(err, ErrInvalidTraceparent), traceparent)
+	}
+}
+
+func TestFromHeaders(t *testing.T) {
+	t.Run("continues the incoming trace", func(t *testing.T) {
+		h := http.Header{}
+		h.Set(TraceparentHeader, testTraceparent)
+		h.Add(TracestateHeader, "rojo=00f067aa0ba902b7")
+		h.Add(TracestateHeader, "congo=t61rcWkgMzE")
+
+		tc := FromHeaders(h)
+		assert.True(t, tc.IsValid())
+		assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", tc.TraceID)
+		assert.Equal(t, "00f067aa0ba902b7", tc.ParentSpanID)
+		assert.NotEqual(t, "00f067aa0ba902b7", tc.SpanID)
+		assert.Equal(t, "rojo=00f067aa0ba902b7,congo=t61rcWkgMzE", tc.TraceState)
+	})
+
+	t.Run("starts a new trace", func(t *testing.T) {
+		h := http.Header{}
+		h.Set(TraceparentHeader, "garbage")
+
+		tc := FromHeaders(h)
+		assert.True(t, tc.IsValid())
+		assert.True(t, tc.Sampled())
+		assert.Empty(t, tc.ParentSpanID)
+		assert.NotEqual(t, New().TraceID, tc.TraceID)
+	})
+}
+
+func TestInject(t *testing.T) {
+	tc, err := Parse(testTraceparent)
+	require.NoError(t, err)
+	tc.TraceState = "rojo=00f067aa0ba902b7"
+
+	h := http.Header{}
+	Inject(h, tc)
+	assert.Equal(t, testTraceparent, h.Get(TraceparentHeader))
+	assert.Equal(t, "rojo=00f067aa0ba902b7", h.Get(TracestateHeader))
+
+	empty := http.Header{}
+	Inject(empty, TraceContext{})
+	assert.Empty(t, empty)
+}
+
+func TestFromContext(t *testing.T) {
+	defer func() { extractors = nil }()
+
+	_, ok := FromContext(context.Background())
+	assert.False(t, ok)
+
+	tc := New()
+	ctx := NewContext(context.Background(), tc)
+	traceID, spanID := IDs(ctx)
+	assert.Equal(t, tc.TraceID, traceID)
+	assert.Equal(t, tc.SpanID, spanID)
+
+	// a registered extractor that finds a span takes precedence
+	other := New()
+	RegisterExtractor(func(ctx context.Context) (TraceContext, bool) {
+		return other, ctx.Value("span") != nil
+	})
+
+	found, ok := FromContext(ctx)
+	assert.True(t, ok)
+	assert.Equal(t, tc, found)
+
+	found, ok = FromContext(context.WithValue(ctx, "span", true))
+	assert.True(t, ok)
+	assert.Equal(t, other, found)
+}
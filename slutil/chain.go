@@ -0,0 +1,95 @@
+package slutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/rs/zerolog"
+)
+
+// ChainKey is the key the wrapped error chain is logged under when LogErrorChain is enabled
+const ChainKey = "chain"
+
+const ChainDepthKey = "depth"
+const ChainErrorTypeKey = "errorType"
+const ChainMessageKey = "message"
+
+// LogErrorChain controls whether errors emit a ChainKey array describing every error they wrap.
+// It is disabled by default to keep the existing log format unchanged.
+var LogErrorChain = false
+
+// FieldMarshaler is implemented by errors that can log their own fields without logging the errors they wrap.
+// It is used when rendering an error as a member of a chain so that the chain is not repeated for every link.
+type FieldMarshaler interface {
+	MarshalZerologFields(zle *zerolog.Event)
+}
+
+// AddChain adds the ChainKey array for every error wrapped by inner to zle when ShouldLogChain is true.
+func AddChain(zle *zerolog.Event, inner error) {
+	if !ShouldLogChain() || inner == nil {
+		return
+	}
+
+	zle.Array(ChainKey, Chain(inner))
+}
+
+// Chain renders err and every error it wraps as an array of objects in depth-first order.
+// Errors implementing FieldMarshaler or zerolog.LogObjectMarshaler are logged with their fields,
+// every other error is logged as its type name and message. Only the first FieldLimits.ChainDepth links
+// are rendered, followed by a link holding the original number of links under TruncatedKey.
+func Chain(err error) *zerolog.Array {
+	arr := zerolog.Arr()
+	links := 0
+	Walk(err, func(current error, depth int) bool {
+		if FieldLimits.ChainDepth <= 0 || links < FieldLimits.ChainDepth {
+			arr.Object(chainLink{err: current, depth: depth})
+		}
+		links++
+		return true
+	})
+
+	if FieldLimits.ChainDepth > 0 && links > FieldLimits.ChainDepth {
+		arr.Dict(zerolog.Dict().Int(TruncatedKey, links))
+	}
+
+	return arr
+}
+
+// ChainObjects returns the links Chain renders for err as decoded JSON objects, for formatters writing the chain in
+// a layout of their own.
+func ChainObjects(err error) []JSONObject {
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	logger.Log().Array(ChainKey, Chain(err)).Send()
+
+	var line struct {
+		Chain []JSONObject `json:"chain"`
+	}
+	if json.Unmarshal(buf.Bytes(), &line) != nil {
+		return nil
+	}
+
+	return line.Chain
+}
+
+type chainLink struct {
+	err   error
+	depth int
+}
+
+func (c chainLink) MarshalZerologObject(zle *zerolog.Event) {
+	zle.
+		Int(ChainDepthKey, c.depth).
+		Str(ChainErrorTypeKey, fmt.Sprintf("%T", c.err))
+
+	switch x := c.err.(type) {
+	case FieldMarshaler:
+		x.MarshalZerologFields(zle)
+	case zerolog.LogObjectMarshaler:
+		x.MarshalZerologObject(zle)
+	default:
+		var truncated Truncations
+		zle.Str(ChainMessageKey, truncated.Text(ChainMessageKey, c.err.Error(), FieldLimits.InnerError))
+		AddTruncated(zle, truncated)
+	}
+}
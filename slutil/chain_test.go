@@ -0,0 +1,118 @@
+package slutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type objectError struct {
+	code int
+}
+
+func (e objectError) Error() string {
+	return fmt.Sprintf("object error %d", e.code)
+}
+
+func (e objectError) MarshalZerologObject(zle *zerolog.Event) {
+	zle.Int("code", e.code)
+}
+
+type fieldsError struct {
+	inner error
+}
+
+func (e *fieldsError) Error() string {
+	return "fields error"
+}
+
+func (e *fieldsError) Unwrap() error {
+	return e.inner
+}
+
+func (e *fieldsError) MarshalZerologObject(zle *zerolog.Event) {
+	e.MarshalZerologFields(zle)
+	AddChain(zle, e.inner)
+}
+
+func (e *fieldsError) MarshalZerologFields(zle *zerolog.Event) {
+	zle.Str("kind", "fields")
+}
+
+func logChainItem(t *testing.T, err error) map[string]any {
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	logger.Error().Object(ZLObjectKey, &fieldsError{inner: err}).Send()
+
+	var item ZLJSONItem
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &item))
+
+	return item.ErrorAsJSON
+}
+
+func TestAddChain(t *testing.T) {
+	inner := fmt.Errorf("wrapping %w", errors.Join(objectError{code: 7}, &fieldsError{inner: errors.New("root cause")}))
+
+	t.Run("chain is omitted by default", func(t *testing.T) {
+		logged := logChainItem(t, inner)
+		assert.Equal(t, "fields", logged["kind"])
+		assert.Nil(t, logged[ChainKey])
+	})
+
+	t.Run("chain renders every wrapped error", func(t *testing.T) {
+		LogErrorChain = true
+		defer func() { LogErrorChain = false }()
+
+		logged := logChainItem(t, inner)
+		chain, ok := logged[ChainKey].([]any)
+		require.True(t, ok)
+		require.Len(t, chain, 5)
+
+		links := make([]map[string]any, len(chain))
+		for i, link := range chain {
+			links[i] = link.(map[string]any)
+		}
+
+		assert.Equal(t, "*fmt.wrapError", links[0][ChainErrorTypeKey])
+		assert.Equal(t, inner.Error(), links[0][ChainMessageKey])
+		assert.Equal(t, float64(0), links[0][ChainDepthKey])
+
+		assert.Equal(t, "*errors.joinError", links[1][ChainErrorTypeKey])
+		assert.Equal(t, float64(1), links[1][ChainDepthKey])
+
+		assert.Equal(t, "slutil.objectError", links[2][ChainErrorTypeKey])
+		assert.Equal(t, float64(7), links[2]["code"])
+		assert.Nil(t, links[2][ChainMessageKey])
+
+		// errors implementing FieldMarshaler are rendered without repeating their own chain
+		assert.Equal(t, "*slutil.fieldsError", links[3][ChainErrorTypeKey])
+		assert.Equal(t, "fields", links[3]["kind"])
+		assert.Nil(t, links[3][ChainKey])
+
+		assert.Equal(t, "*errors.errorString", links[4][ChainErrorTypeKey])
+		assert.Equal(t, "root cause", links[4][ChainMessageKey])
+		assert.Equal(t, float64(3), links[4][ChainDepthKey])
+	})
+}
+
+func TestChainObjects(t *testing.T) {
+	links := ChainObjects(&fieldsError{inner: objectError{code: 7}})
+	require.Len(t, links, 2)
+
+	var kind, errorType string
+	var code, depth int
+	require.NoError(t, links[0].Decode("kind", &kind))
+	require.NoError(t, links[1].Decode(ChainErrorTypeKey, &errorType))
+	require.NoError(t, links[1].Decode("code", &code))
+	require.NoError(t, links[1].Decode(ChainDepthKey, &depth))
+
+	assert.Equal(t, "fields", kind)
+	assert.Equal(t, "slutil.objectError", errorType)
+	assert.Equal(t, 7, code)
+	assert.Equal(t, 1, depth)
+}
@@ -0,0 +1,420 @@
+package slutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/rs/zerolog"
+	"strings"
+	"unicode"
+)
+
+// KeyStrategy selects how the declared camelCase keys such as statusCode are written.
+type KeyStrategy int
+
+const (
+	KeysCamelCase KeyStrategy = iota // the keys as declared, e.g. statusCode
+	KeysSnakeCase                    // e.g. status_code
+)
+
+// DefaultFlattenPrefix is prepended to every key of a flattened error unless Encoding.Prefix is set.
+const DefaultFlattenPrefix = ZLObjectKey + "_"
+
+// DataKeys are the keys whose object values hold data, such as the request parameter maps of slapi.APIError. The
+// member names of their values are never renamed or left out.
+var DataKeys = []string{"multiParams", "pathParams", "queryParams"}
+
+// Encoding configures the layout of the errors written with AddObject. The zero value is the default sl layout:
+// camelCase keys nested under ZLObjectKey with every field present.
+type Encoding struct {
+	CustomKeys map[string]string // the names to write declared keys under, e.g. {"ownerId": "user.id"}, before Keys
+	Flatten    bool              // write the fields at the top level of the line instead of nesting them
+	Keys       KeyStrategy
+	ObjectKey  string // the key the fields are nested under, ZLObjectKey if empty
+	OmitEmpty  bool   // leave out empty strings, zero numbers, false, null and empty objects and arrays
+	Prefix     string // prepended to every key when Flatten is set, DefaultFlattenPrefix if empty
+}
+
+// LogEncoding is the Encoding used to write and read every logged error.
+//
+// Readers always recognize snake_case keys and errors flattened with DefaultFlattenPrefix, so only an ObjectKey,
+// Prefix or CustomKeys have to be configured in the reading process as well.
+var LogEncoding Encoding
+
+// Formatter writes logged errors in a layout of its own, such as the Elastic Common Schema of the slecs package.
+type Formatter interface {
+	// FormatObject adds the fields of obj to zle.
+	FormatObject(zle *zerolog.Event, obj zerolog.LogObjectMarshaler)
+}
+
+// OutputFormat writes every error added with AddObject instead of the sl layout configured by LogEncoding. The sl
+// layout is used while it is nil, which is the default.
+var OutputFormat Formatter
+
+func (e Encoding) isDefault() bool {
+	return !e.Flatten && !e.OmitEmpty && e.Keys == KeysCamelCase && len(e.CustomKeys) == 0 &&
+		(e.ObjectKey == "" || e.ObjectKey == ZLObjectKey)
+}
+
+func (e Encoding) objectKey() string {
+	if e.ObjectKey == "" {
+		return ZLObjectKey
+	}
+
+	return e.ObjectKey
+}
+
+func (e Encoding) prefix() string {
+	if e.Prefix == "" {
+		return DefaultFlattenPrefix
+	}
+
+	return e.Prefix
+}
+
+// EncodeKey returns the name the declared key is written under with LogEncoding, without the flatten prefix.
+func EncodeKey(key string) string {
+	return LogEncoding.encodeKey(key)
+}
+
+func (e Encoding) encodeKey(key string) string {
+	if custom, ok := e.CustomKeys[key]; ok {
+		return custom
+	}
+
+	if e.Keys == KeysSnakeCase {
+		return snakeCase(key)
+	}
+
+	return key
+}
+
+// CanonicalKey returns the declared key for a key read from a log line written with LogEncoding or in snake_case.
+// The flatten prefix is removed.
+func CanonicalKey(key string) string {
+	if LogEncoding.Flatten {
+		key = strings.TrimPrefix(key, LogEncoding.prefix())
+	} else {
+		key = strings.TrimPrefix(key, DefaultFlattenPrefix)
+	}
+
+	for declared, custom := range LogEncoding.CustomKeys {
+		if custom == key {
+			return declared
+		}
+	}
+
+	return camelCase(key)
+}
+
+// AddObject adds obj, usually an error, to zle with OutputFormat or in the layout configured by LogEncoding. It
+// returns zle so it can be used within a chain of zerolog calls.
+func AddObject(zle *zerolog.Event, obj zerolog.LogObjectMarshaler) *zerolog.Event {
+	if format := OutputFormat; format != nil {
+		format.FormatObject(zle, obj)
+		return zle
+	}
+
+	encoding := LogEncoding
+	if encoding.isDefault() {
+		return zle.Object(ZLObjectKey, obj)
+	}
+
+	raw, err := MarshalObjectJSON(obj)
+	if err == nil {
+		raw, err = encodeObject(raw, encoding)
+	}
+	if err != nil {
+		return zle.Object(encoding.objectKey(), obj)
+	}
+
+	if !encoding.Flatten {
+		return zle.RawJSON(encoding.objectKey(), raw)
+	}
+
+	err = eachMember(raw, func(key string, value json.RawMessage) error {
+		zle.RawJSON(encoding.prefix()+key, value)
+		return nil
+	})
+	if err != nil {
+		return zle.Object(encoding.objectKey(), obj)
+	}
+
+	return zle
+}
+
+// LogObject returns the logged error of a decoded log line with its declared keys, whichever layout it was written
+// in, and false if the line holds none.
+func LogObject(line map[string]any) (map[string]any, bool) {
+	encoding := LogEncoding
+
+	for _, key := range []string{encoding.objectKey(), ZLObjectKey} {
+		if fields, ok := line[key].(map[string]any); ok {
+			return canonicalObject(fields), true
+		}
+	}
+
+	prefixes := []string{DefaultFlattenPrefix}
+	if encoding.Flatten && encoding.prefix() != DefaultFlattenPrefix {
+		prefixes = []string{encoding.prefix()}
+	}
+
+	flattened := make(map[string]any)
+	for key, value := range line {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(key, prefix) && len(key) > len(prefix) {
+				flattened[strings.TrimPrefix(key, prefix)] = value
+			}
+		}
+	}
+
+	if len(flattened) == 0 {
+		return nil, false
+	}
+
+	return canonicalObject(flattened), true
+}
+
+// encodeObject renames the keys of the JSON object raw and leaves out its empty values as configured, keeping the
+// order of its members
+func encodeObject(raw json.RawMessage, encoding Encoding) (json.RawMessage, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+
+	err := eachMember(raw, func(key string, value json.RawMessage) error {
+		var err error
+		switch {
+		case isDataKey(key):
+		case key == TruncatedKey:
+			value = encoding.encodeTruncated(value)
+		default:
+			if value, err = encodeValue(value, encoding); err != nil {
+				return err
+			}
+		}
+
+		if encoding.OmitEmpty && isEmptyJSON(value) {
+			return nil
+		}
+
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+		name, _ := json.Marshal(encoding.encodeKey(key))
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(value)
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+func encodeValue(value json.RawMessage, encoding Encoding) (json.RawMessage, error) {
+	trimmed := bytes.TrimSpace(value)
+	if len(trimmed) == 0 {
+		return value, nil
+	}
+
+	switch trimmed[0] {
+	case '{':
+		return encodeObject(trimmed, encoding)
+	case '[':
+		var elements []json.RawMessage
+		if err := json.Unmarshal(trimmed, &elements); err != nil {
+			return nil, err
+		}
+
+		var buf bytes.Buffer
+		buf.WriteByte('[')
+		for i, element := range elements {
+			encoded, err := encodeValue(element, encoding)
+			if err != nil {
+				return nil, err
+			}
+
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			buf.Write(encoded)
+		}
+		buf.WriteByte(']')
+
+		return buf.Bytes(), nil
+	default:
+		return value, nil
+	}
+}
+
+// encodeTruncated renames the field names of a TruncatedKey object, which are declared keys followed by the
+// parameter they refer to such as pathParams.id
+func (e Encoding) encodeTruncated(value json.RawMessage) json.RawMessage {
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+
+	err := eachMember(value, func(key string, length json.RawMessage) error {
+		if buf.Len() > 1 {
+			buf.WriteByte(',')
+		}
+
+		field, rest, _ := strings.Cut(key, ".")
+		if rest != "" {
+			rest = "." + rest
+		}
+		name, _ := json.Marshal(e.encodeKey(field) + rest)
+		buf.Write(name)
+		buf.WriteByte(':')
+		buf.Write(length)
+
+		return nil
+	})
+	if err != nil {
+		return value
+	}
+
+	buf.WriteByte('}')
+	return buf.Bytes()
+}
+
+// eachMember calls fn for every member of the JSON object raw in order
+func eachMember(raw json.RawMessage, fn func(key string, value json.RawMessage) error) error {
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return fmt.Errorf("not a JSON object: %s", raw)
+	}
+
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			return err
+		}
+
+		var value json.RawMessage
+		if err = decoder.Decode(&value); err != nil {
+			return err
+		}
+
+		if err = fn(token.(string), value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func isEmptyJSON(value json.RawMessage) bool {
+	switch string(bytes.TrimSpace(value)) {
+	case `""`, `0`, `false`, `null`, `{}`, `[]`:
+		return true
+	default:
+		return false
+	}
+}
+
+func isDataKey(key string) bool {
+	for _, dataKey := range DataKeys {
+		if key == dataKey {
+			return true
+		}
+	}
+
+	return false
+}
+
+// canonicalObject returns fields with the declared keys at every depth except within the values of DataKeys
+func canonicalObject(fields map[string]any) map[string]any {
+	res := make(map[string]any, len(fields))
+	for key, value := range fields {
+		key = CanonicalKey(key)
+		switch {
+		case isDataKey(key):
+		case key == TruncatedKey:
+			value = canonicalTruncated(value)
+		default:
+			value = canonicalValue(value)
+		}
+		res[key] = value
+	}
+
+	return res
+}
+
+func canonicalValue(value any) any {
+	switch x := value.(type) {
+	case map[string]any:
+		return canonicalObject(x)
+	case []any:
+		res := make([]any, len(x))
+		for i, element := range x {
+			res[i] = canonicalValue(element)
+		}
+		return res
+	default:
+		return value
+	}
+}
+
+func canonicalTruncated(value any) any {
+	lengths, ok := value.(map[string]any)
+	if !ok {
+		return value
+	}
+
+	res := make(map[string]any, len(lengths))
+	for key, length := range lengths {
+		field, rest, _ := strings.Cut(key, ".")
+		if rest != "" {
+			rest = "." + rest
+		}
+		res[CanonicalKey(field)+rest] = length
+	}
+
+	return res
+}
+
+// snakeCase converts a camelCase key such as statusCode or requestID to status_code or request_id
+func snakeCase(key string) string {
+	runes := []rune(key)
+
+	var b strings.Builder
+	for i, r := range runes {
+		if unicode.IsUpper(r) {
+			previousLower := i > 0 && (unicode.IsLower(runes[i-1]) || unicode.IsDigit(runes[i-1]))
+			acronymEnd := i > 0 && unicode.IsUpper(runes[i-1]) && i+1 < len(runes) && unicode.IsLower(runes[i+1])
+			if previousLower || acronymEnd {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+
+	return b.String()
+}
+
+// camelCase converts a snake_case key such as status_code to statusCode and leaves camelCase keys unchanged
+func camelCase(key string) string {
+	if !strings.Contains(key, "_") {
+		return key
+	}
+
+	parts := strings.Split(key, "_")
+
+	var b strings.Builder
+	b.WriteString(parts[0])
+	for _, part := range parts[1:] {
+		if part == "" {
+			continue
+		}
+		runes := []rune(part)
+		runes[0] = unicode.ToUpper(runes[0])
+		b.WriteString(string(runes))
+	}
+
+	return b.String()
+}
@@ -0,0 +1,134 @@
+package slutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// encodedError logs the kinds of fields the encodings treat differently
+type encodedError struct{}
+
+func (encodedError) Error() string {
+	return "encoded error"
+}
+
+func (encodedError) MarshalZerologObject(zle *zerolog.Event) {
+	zle.
+		Int("statusCode", 404).
+		Bool("remote", false).
+		Str("requestId", "").
+		Str("errorType", "notFound").
+		Interface("pathParams", map[string]string{"userId": "", "orderId": "o-1"}).
+		Object(TruncatedKey, Truncations{"pathParams.userId": 9000}).
+		Array(ChainKey, zerolog.Arr().Dict(zerolog.Dict().Int(ChainDepthKey, 0).Str(ChainMessageKey, "wrapped")))
+}
+
+func logEncoded(t *testing.T, encoding Encoding) string {
+	LogEncoding = encoding
+	defer func() { LogEncoding = Encoding{} }()
+
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	AddObject(logger.Error(), encodedError{}).Msg("failed")
+
+	return buf.String()
+}
+
+func TestAddObject(t *testing.T) {
+	t.Run("the zero value is the sl layout", func(t *testing.T) {
+		var buf bytes.Buffer
+		logger := zerolog.New(&buf)
+		logger.Error().Object(ZLObjectKey, encodedError{}).Msg("failed")
+
+		assert.Equal(t, buf.String(), logEncoded(t, Encoding{}))
+	})
+
+	t.Run("snake case nested under another key without empty fields", func(t *testing.T) {
+		assert.Equal(t, `{"level":"error","error":{"status_code":404,"error_type":"notFound",`+
+			`"path_params":{"orderId":"o-1","userId":""},"truncated":{"path_params.userId":9000},`+
+			`"chain":[{"message":"wrapped"}]},"message":"failed"}`+"\n",
+			logEncoded(t, Encoding{Keys: KeysSnakeCase, ObjectKey: "error", OmitEmpty: true}))
+	})
+
+	t.Run("flattened", func(t *testing.T) {
+		assert.Equal(t, `{"level":"error","sl_statusCode":404,"sl_remote":false,"sl_requestId":"","sl_errorType":"notFound",`+
+			`"sl_pathParams":{"orderId":"o-1","userId":""},"sl_truncated":{"pathParams.userId":9000},`+
+			`"sl_chain":[{"depth":0,"message":"wrapped"}],"message":"failed"}`+"\n",
+			logEncoded(t, Encoding{Flatten: true}))
+
+		assert.Contains(t, logEncoded(t, Encoding{Flatten: true, Keys: KeysSnakeCase, Prefix: "error."}), `"error.status_code":404`)
+	})
+
+	t.Run("custom keys", func(t *testing.T) {
+		line := logEncoded(t, Encoding{CustomKeys: map[string]string{"statusCode": "http.status"}, Keys: KeysSnakeCase})
+		assert.Contains(t, line, `"sl":{"http.status":404,"remote":false,"request_id":""`)
+	})
+}
+
+func TestLogObject(t *testing.T) {
+	canonical, err := MarshalObjectJSON(encodedError{})
+	require.NoError(t, err)
+
+	var expected map[string]any
+	require.NoError(t, json.Unmarshal(canonical, &expected))
+
+	encodings := map[string]Encoding{
+		"sl layout":       {},
+		"snake case":      {Keys: KeysSnakeCase},
+		"flattened":       {Flatten: true, Keys: KeysSnakeCase},
+		"custom prefix":   {Flatten: true, Prefix: "err."},
+		"custom key":      {ObjectKey: "error", CustomKeys: map[string]string{"requestId": "request.id"}},
+		"without empties": {Keys: KeysSnakeCase, OmitEmpty: true},
+	}
+
+	for name, encoding := range encodings {
+		t.Run(name, func(t *testing.T) {
+			var line map[string]any
+			require.NoError(t, json.Unmarshal([]byte(logEncoded(t, encoding)), &line))
+
+			LogEncoding = encoding
+			defer func() { LogEncoding = Encoding{} }()
+
+			fields, ok := LogObject(line)
+			require.True(t, ok)
+
+			if encoding.OmitEmpty {
+				assert.Equal(t, map[string]any{"statusCode": float64(404), "errorType": "notFound",
+					"pathParams": map[string]any{"userId": "", "orderId": "o-1"}, "truncated": map[string]any{"pathParams.userId": float64(9000)},
+					"chain": []any{map[string]any{"message": "wrapped"}}}, fields)
+			} else {
+				assert.Equal(t, expected, fields)
+			}
+		})
+	}
+
+	t.Run("lines without an error", func(t *testing.T) {
+		_, ok := LogObject(map[string]any{"level": "info", "message": "hello"})
+		assert.False(t, ok)
+	})
+}
+
+func TestKeyCase(t *testing.T) {
+	tests := []struct {
+		camel string
+		snake string
+	}{
+		{"statusCode", "status_code"},
+		{"requestId", "request_id"},
+		{"url", "url"},
+		{"innerError", "inner_error"},
+		{"httpURLPath", "http_url_path"},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.snake, snakeCase(tt.camel))
+	}
+
+	assert.Equal(t, "statusCode", camelCase("status_code"))
+	assert.Equal(t, "statusCode", camelCase("statusCode"))
+	assert.Equal(t, "requestId", CanonicalKey("sl_request_id"))
+}
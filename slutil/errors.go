@@ -0,0 +1,58 @@
+package slutil
+
+// Walk visits err and every error it wraps in depth-first order, calling fn exactly once per node.
+// Both single error chains (Unwrap() error) and error trees (Unwrap() []error, as produced by errors.Join
+// or fmt.Errorf with multiple %w verbs) are followed. Walking stops early if fn returns false.
+func Walk(err error, fn func(err error, depth int) bool) {
+	walk(err, 0, fn)
+}
+
+func walk(err error, depth int, fn func(err error, depth int) bool) bool {
+	if err == nil {
+		return true
+	}
+
+	if !fn(err, depth) {
+		return false
+	}
+
+	switch x := err.(type) {
+	case interface{ Unwrap() error }:
+		return walk(x.Unwrap(), depth+1, fn)
+	case interface{ Unwrap() []error }:
+		for _, inner := range x.Unwrap() {
+			if !walk(inner, depth+1, fn) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// FindAll returns every error of type T in the error tree of err in depth-first order.
+// Unlike calling errors.As in a loop each error is only matched against itself, so every
+// matching error is returned exactly once.
+func FindAll[T error](err error) []T {
+	var res []T
+	Walk(err, func(current error, _ int) bool {
+		if match, ok := current.(T); ok {
+			res = append(res, match)
+		}
+		return true
+	})
+
+	return res
+}
+
+// FindFirst returns the outermost error of type T in the error tree of err.
+func FindFirst[T error](err error) (T, bool) {
+	var res T
+	var found bool
+	Walk(err, func(current error, _ int) bool {
+		res, found = current.(T)
+		return !found
+	})
+
+	return res, found
+}
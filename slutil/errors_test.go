@@ -0,0 +1,95 @@
+package slutil
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type testError struct {
+	name  string
+	inner error
+}
+
+func (e *testError) Error() string {
+	return e.name
+}
+
+func (e *testError) Unwrap() error {
+	return e.inner
+}
+
+func TestWalk(t *testing.T) {
+	leafA := errors.New("leafA")
+	leafB := &testError{name: "leafB"}
+	joined := errors.Join(leafA, fmt.Errorf("wrapping %w", leafB))
+	root := &testError{name: "root", inner: joined}
+
+	t.Run("visits every node once in depth first order", func(t *testing.T) {
+		var visited []string
+		var depths []int
+		Walk(root, func(err error, depth int) bool {
+			visited = append(visited, err.Error())
+			depths = append(depths, depth)
+			return true
+		})
+
+		require.Len(t, visited, 5)
+		assert.Equal(t, "root", visited[0])
+		assert.Equal(t, joined.Error(), visited[1])
+		assert.Equal(t, "leafA", visited[2])
+		assert.Equal(t, "wrapping leafB", visited[3])
+		assert.Equal(t, "leafB", visited[4])
+		assert.Equal(t, []int{0, 1, 2, 2, 3}, depths)
+	})
+
+	t.Run("stops when fn returns false", func(t *testing.T) {
+		var visited int
+		Walk(root, func(err error, _ int) bool {
+			visited++
+			return err != leafA
+		})
+
+		assert.Equal(t, 3, visited)
+	})
+
+	t.Run("nil error is never visited", func(t *testing.T) {
+		Walk(nil, func(err error, _ int) bool {
+			t.Fatalf("unexpected visit of %v", err)
+			return true
+		})
+	})
+}
+
+func TestFindAll(t *testing.T) {
+	innermost := &testError{name: "innermost"}
+	middle := &testError{name: "middle", inner: fmt.Errorf("wrapping %w", innermost)}
+	sibling := &testError{name: "sibling"}
+	outermost := &testError{name: "outermost", inner: errors.Join(middle, errors.New("plain"), sibling)}
+
+	t.Run("finds each error exactly once across joined branches", func(t *testing.T) {
+		found := FindAll[*testError](outermost)
+		require.Len(t, found, 4)
+		assert.Same(t, outermost, found[0])
+		assert.Same(t, middle, found[1])
+		assert.Same(t, innermost, found[2])
+		assert.Same(t, sibling, found[3])
+	})
+
+	t.Run("returns nothing when no error matches", func(t *testing.T) {
+		assert.Empty(t, FindAll[*testError](errors.New("plain")))
+		assert.Empty(t, FindAll[*testError](nil))
+	})
+
+	t.Run("FindFirst returns the outermost match", func(t *testing.T) {
+		found, ok := FindFirst[*testError](fmt.Errorf("wrapping %w", outermost))
+		require.True(t, ok)
+		assert.Same(t, outermost, found)
+
+		found, ok = FindFirst[*testError](errors.New("plain"))
+		assert.False(t, ok)
+		assert.Nil(t, found)
+	})
+}
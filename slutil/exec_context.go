@@ -48,3 +48,21 @@ func GetExecContext(caller int) ExecContext {
 		Package:  packageName,
 	}
 }
+
+// FrameExecContext returns the ExecContext of a stack frame such as one returned by runtime.CallersFrames.
+// Methods keep their receiver, so github.com/org/module/pkg.(*Type).Method has the Function (*Type).Method.
+func FrameExecContext(frame runtime.Frame) ExecContext {
+	execCtx := ExecContext{File: frame.File, Line: frame.Line}
+
+	name := frame.Function
+	slash := strings.LastIndex(name, "/")
+	if dot := strings.Index(name[slash+1:], "."); dot >= 0 {
+		execCtx.Package = name[slash+1 : slash+1+dot]
+		execCtx.Function = name[slash+2+dot:]
+		if slash > 0 {
+			execCtx.Module = name[:slash]
+		}
+	}
+
+	return execCtx
+}
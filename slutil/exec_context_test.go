@@ -4,6 +4,7 @@ import (
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"os"
+	"runtime"
 	"testing"
 )
 
@@ -16,6 +17,23 @@ func TestGetExecContext(t *testing.T) {
 	assert.Equal(t, "TestGetExecContext", execCtx.Function)
 	assert.Equal(t, "github.com/seantcanavan/zerolog-json-structured-logs", execCtx.Module)
 	assert.Equal(t, "slutil", execCtx.Package)
-	assert.Equal(t, 15, execCtx.Line)
+	assert.Equal(t, 16, execCtx.Line)
 	assert.Equal(t, cwd+"/exec_context_test.go", execCtx.File)
 }
+
+func TestFrameExecContext(t *testing.T) {
+	execCtx := FrameExecContext(runtime.Frame{
+		File:     "/src/repo/users.go",
+		Function: "github.com/org/module/repo.(*Users).Insert",
+		Line:     42,
+	})
+	assert.Equal(t, ExecContext{
+		File:     "/src/repo/users.go",
+		Function: "(*Users).Insert",
+		Line:     42,
+		Module:   "github.com/org/module",
+		Package:  "repo",
+	}, execCtx)
+
+	assert.Equal(t, ExecContext{Function: "Println", Package: "log"}, FrameExecContext(runtime.Frame{Function: "log.Println"}))
+}
@@ -0,0 +1,84 @@
+package slutil
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// FingerprintKey is the key the fingerprint of an error is logged under
+const FingerprintKey = "fingerprint"
+
+// Fingerprinter is implemented by errors that know which of their fields identify the kind of failure they describe.
+// The parts must not contain values that change between occurrences such as IDs or timestamps.
+type Fingerprinter interface {
+	FingerprintParts() []string
+}
+
+var messageNormalizers = []struct {
+	pattern     *regexp.Regexp
+	replacement string
+}{
+	{regexp.MustCompile(`(?i)\b[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}\b`), "<uuid>"},
+	{regexp.MustCompile(`[\w.+-]+@[\w-]+(\.[\w-]+)+`), "<email>"},
+	{regexp.MustCompile(`'[^']*'|"[^"]*"`), "<str>"},
+	{regexp.MustCompile(`(?i)\b0x[0-9a-f]+\b|\b[0-9a-f]*[0-9][0-9a-f]*[a-f][0-9a-f]*\b|\b[0-9a-f]*[a-f][0-9a-f]*[0-9][0-9a-f]*\b`), "<hex>"},
+	{regexp.MustCompile(`\d+(\.\d+)?`), "<n>"},
+	{regexp.MustCompile(`\s+`), " "},
+}
+
+// Fingerprint returns a stable identifier for the kind of failure err describes. Two occurrences of the same
+// failure share a fingerprint even when their IDs, timestamps or the numbers in their messages differ.
+// The outermost Fingerprinter in the error tree is used, other errors are identified by their type and message.
+func Fingerprint(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	var parts []string
+	if fingerprinter, ok := FindFirst[interface {
+		error
+		Fingerprinter
+	}](err); ok {
+		parts = fingerprinter.FingerprintParts()
+	} else {
+		parts = []string{fmt.Sprintf("%T", err), NormalizeMessage(err.Error()), RootCauseType(err)}
+	}
+
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:8])
+}
+
+// NormalizeMessage replaces the variable parts of a message such as numbers, UUIDs, hex strings, emails and quoted
+// values with placeholders so that messages describing the same failure compare equal.
+func NormalizeMessage(message string) string {
+	for _, normalizer := range messageNormalizers {
+		message = normalizer.pattern.ReplaceAllString(message, normalizer.replacement)
+	}
+
+	return strings.TrimSpace(message)
+}
+
+// RootCauseType returns the type name of the innermost error reached by following the first branch of the
+// error tree of err, or an empty string if err is nil.
+func RootCauseType(err error) string {
+	var root error
+	Walk(err, func(current error, depth int) bool {
+		root = current
+		switch x := current.(type) {
+		case interface{ Unwrap() error }:
+			return x.Unwrap() != nil
+		case interface{ Unwrap() []error }:
+			return len(x.Unwrap()) > 0
+		}
+		return false
+	})
+
+	if root == nil {
+		return ""
+	}
+
+	return fmt.Sprintf("%T", root)
+}
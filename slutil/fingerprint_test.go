@@ -0,0 +1,75 @@
+package slutil
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type fingerprintError struct {
+	id    string
+	kind  string
+	inner error
+}
+
+func (e *fingerprintError) Error() string {
+	return fmt.Sprintf("%s failed for %s", e.kind, e.id)
+}
+
+func (e *fingerprintError) Unwrap() error {
+	return e.inner
+}
+
+func (e *fingerprintError) FingerprintParts() []string {
+	return []string{e.kind, RootCauseType(e.inner)}
+}
+
+func TestNormalizeMessage(t *testing.T) {
+	testCases := []struct {
+		message  string
+		expected string
+	}{
+		{"user 12345 not found", "user <n> not found"},
+		{"order 3f2504e0-4f89-11d3-9a0c-0305e82c3301 expired", "order <uuid> expired"},
+		{"could not email jane.doe+test@example.com", "could not email <email>"},
+		{`duplicate key value "jane" violates 'users_pkey'`, "duplicate key value <str> violates <str>"},
+		{"object a1b2c3d4 at 0xc000123456 took 1.5s", "object <hex> at <hex> took <n>s"},
+		{"  too   much\twhitespace  ", "too much whitespace"},
+		{"deadline exceeded", "deadline exceeded"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.message, func(t *testing.T) {
+			assert.Equal(t, tc.expected, NormalizeMessage(tc.message))
+		})
+	}
+}
+
+func TestRootCauseType(t *testing.T) {
+	assert.Equal(t, "", RootCauseType(nil))
+	assert.Equal(t, "*errors.errorString", RootCauseType(errors.New("plain")))
+	assert.Equal(t, "*slutil.testError", RootCauseType(fmt.Errorf("wrapping %w", &testError{name: "leaf"})))
+	assert.Equal(t, "*slutil.testError", RootCauseType(errors.Join(fmt.Errorf("wrapping %w", &testError{name: "leaf"}), errors.New("second"))))
+}
+
+func TestFingerprint(t *testing.T) {
+	t.Run("ids do not change the fingerprint", func(t *testing.T) {
+		first := &fingerprintError{id: "user-1", kind: "lookup", inner: errors.New("boom")}
+		second := &fingerprintError{id: "user-2", kind: "lookup", inner: errors.New("bang")}
+		assert.Equal(t, Fingerprint(first), Fingerprint(fmt.Errorf("wrapping %w", second)))
+		assert.Len(t, Fingerprint(first), 16)
+	})
+
+	t.Run("the kind and inner error type change the fingerprint", func(t *testing.T) {
+		lookup := &fingerprintError{kind: "lookup", inner: errors.New("boom")}
+		assert.NotEqual(t, Fingerprint(lookup), Fingerprint(&fingerprintError{kind: "insert", inner: errors.New("boom")}))
+		assert.NotEqual(t, Fingerprint(lookup), Fingerprint(&fingerprintError{kind: "lookup", inner: &testError{name: "boom"}}))
+	})
+
+	t.Run("plain errors use their type and normalized message", func(t *testing.T) {
+		assert.Equal(t, Fingerprint(fmt.Errorf("user %d not found", 1)), Fingerprint(fmt.Errorf("user %d not found", 2)))
+		assert.NotEqual(t, Fingerprint(errors.New("user not found")), Fingerprint(errors.New("order not found")))
+		assert.Equal(t, "", Fingerprint(nil))
+	})
+}
@@ -0,0 +1,243 @@
+package slutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	"sync"
+)
+
+// WrappedMessageKey holds the full message of an inner error whose typed sl error is wrapped by another error,
+// such as fmt.Errorf("...: %w", dbErr), so that decoding keeps the message of the wrapper.
+const WrappedMessageKey = "wrappedMessage"
+
+var (
+	errorTypesMu sync.RWMutex
+	errorTypes   = map[string]func() error{}
+)
+
+// RegisterErrorType registers the error type returned by newError, a pointer implementing json.Marshaler and
+// json.Unmarshaler, so that MarshalFieldsJSON encodes it as a typed object and DecodeError restores its concrete type.
+func RegisterErrorType(newError func() error) {
+	errorTypesMu.Lock()
+	defer errorTypesMu.Unlock()
+
+	errorTypes[fmt.Sprintf("%T", newError())] = newError
+}
+
+func registeredErrorType(name string) (func() error, bool) {
+	errorTypesMu.RLock()
+	defer errorTypesMu.RUnlock()
+
+	newError, ok := errorTypes[name]
+	return newError, ok
+}
+
+// firstRegisteredError returns the first error in the tree of err whose type was registered with RegisterErrorType.
+func firstRegisteredError(err error) error {
+	var res error
+	Walk(err, func(current error, _ int) bool {
+		if _, ok := registeredErrorType(fmt.Sprintf("%T", current)); ok {
+			res = current
+			return false
+		}
+		return true
+	})
+
+	return res
+}
+
+// marshalTypedError encodes typed with its own MarshalJSON and tags it with its type under ChainErrorTypeKey.
+// When typed is wrapped by innerError the message of innerError is kept under WrappedMessageKey.
+func marshalTypedError(innerError, typed error) (json.RawMessage, error) {
+	marshalled, err := json.Marshal(typed)
+	if err != nil {
+		return nil, err
+	}
+
+	var obj map[string]json.RawMessage
+	if err = json.Unmarshal(marshalled, &obj); err != nil {
+		return nil, fmt.Errorf("could not marshal %T to a JSON object: %w", typed, err)
+	}
+
+	obj[ChainErrorTypeKey], _ = json.Marshal(fmt.Sprintf("%T", typed))
+	if typed != innerError {
+		obj[WrappedMessageKey], _ = json.Marshal(innerError.Error())
+	}
+
+	return json.Marshal(obj)
+}
+
+// MarshalObjectJSON renders obj exactly the way zerolog logs it under ZLObjectKey so that the JSON
+// representation of an error always has the same field names as its log output.
+func MarshalObjectJSON(obj zerolog.LogObjectMarshaler) ([]byte, error) {
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	logger.Log().Object(ZLObjectKey, obj).Send()
+
+	var wrapper map[string]json.RawMessage
+	if err := json.Unmarshal(buf.Bytes(), &wrapper); err != nil {
+		return nil, fmt.Errorf("could not marshal %T to JSON: %w", obj, err)
+	}
+
+	return wrapper[ZLObjectKey], nil
+}
+
+// MarshalFieldsJSON encodes fields, the raw fields of an error under the names MarshalZerologObject logs them with,
+// and innerError under innerErrorKey. Unlike the log output nothing is redacted, encrypted or truncated, so decoding
+// the JSON restores the error. innerError is encoded with its own MarshalJSON, as the object it logs or as its message
+// and left out when nil. If innerError is or wraps an error registered with RegisterErrorType, the first such error
+// is encoded as an object tagged with its type instead, so that DecodeError restores it.
+func MarshalFieldsJSON(fields map[string]any, innerErrorKey string, innerError error) ([]byte, error) {
+	if typed := firstRegisteredError(innerError); typed != nil {
+		marshalled, err := marshalTypedError(innerError, typed)
+		if err != nil {
+			return nil, err
+		}
+		fields[innerErrorKey] = marshalled
+		return json.Marshal(fields)
+	}
+
+	switch inner := innerError.(type) {
+	case nil:
+	case json.Marshaler:
+		fields[innerErrorKey] = inner
+	case zerolog.LogObjectMarshaler:
+		marshalled, err := MarshalObjectJSON(inner)
+		if err != nil {
+			return nil, err
+		}
+		fields[innerErrorKey] = json.RawMessage(marshalled)
+	default:
+		fields[innerErrorKey] = inner.Error()
+	}
+
+	return json.Marshal(fields)
+}
+
+// JSONObject is a JSON object whose values are decoded on demand by key.
+type JSONObject map[string]json.RawMessage
+
+// Decode unmarshals the value stored under key into dst. Missing keys and null values leave dst untouched.
+func (o JSONObject) Decode(key string, dst any) error {
+	raw, ok := o[key]
+	if !ok || string(raw) == "null" {
+		return nil
+	}
+
+	if err := json.Unmarshal(raw, dst); err != nil {
+		return fmt.Errorf("could not decode %s: %w", key, err)
+	}
+
+	return nil
+}
+
+// Str returns the string stored under key or an empty string if it is missing or not a string.
+func (o JSONObject) Str(key string) string {
+	var s string
+	_ = o.Decode(key, &s)
+	return s
+}
+
+// ErrorText returns the message logged in logged, the sl rendering of obj, or, for errors logged without one, the
+// redacted and truncated error text of obj.
+func ErrorText(logged JSONObject, obj zerolog.LogObjectMarshaler) string {
+	if message := logged.Str(ChainMessageKey); message != "" {
+		return message
+	}
+
+	err, ok := obj.(error)
+	if !ok {
+		return ""
+	}
+
+	message, _ := Truncate(RedactText(err.Error()), FieldLimits.Message)
+	return message
+}
+
+// ObjectError is an error restored from a JSON object, such as an inner error that zerolog logged as an object
+// because it implements zerolog.LogObjectMarshaler.
+type ObjectError struct {
+	Fields map[string]any
+}
+
+// Error returns the logged message of the ObjectError or its JSON representation if it has none.
+func (e *ObjectError) Error() string {
+	if message, ok := e.Fields[ChainMessageKey].(string); ok {
+		return message
+	}
+
+	marshalled, _ := json.Marshal(e.Fields)
+	return string(marshalled)
+}
+
+// MarshalZerologObject allows ObjectError to be logged by zerolog with its original fields.
+func (e *ObjectError) MarshalZerologObject(zle *zerolog.Event) {
+	zle.Fields(e.Fields)
+}
+
+// wrappedError is a typed error restored together with the message of the error that wrapped it.
+type wrappedError struct {
+	message string
+	err     error
+}
+
+func (e *wrappedError) Error() string {
+	return e.message
+}
+
+func (e *wrappedError) Unwrap() error {
+	return e.err
+}
+
+// DecodeError decodes a logged error value. Errors logged as strings are restored with errors.New, objects tagged
+// with a type registered with RegisterErrorType are restored as that type, wrapped again if they were encoded with
+// a WrappedMessageKey, and other objects are restored as an *ObjectError. A missing or null value decodes to a nil error.
+func (o JSONObject) DecodeError(key string, dst *error) error {
+	raw, ok := o[key]
+	if !ok || string(raw) == "null" {
+		return nil
+	}
+
+	var message string
+	if err := json.Unmarshal(raw, &message); err == nil {
+		if message != "" {
+			*dst = errors.New(message)
+		}
+		return nil
+	}
+
+	var fields map[string]any
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return fmt.Errorf("could not decode %s: %w", key, err)
+	}
+
+	if typeName, ok := fields[ChainErrorTypeKey].(string); ok {
+		if newError, registered := registeredErrorType(typeName); registered {
+			decoded, err := decodeTypedError(key, raw, newError(), fields[WrappedMessageKey])
+			if err != nil {
+				return err
+			}
+			*dst = decoded
+			return nil
+		}
+	}
+
+	*dst = &ObjectError{Fields: fields}
+	return nil
+}
+
+// decodeTypedError unmarshals raw into typed and wraps it again when it was encoded with a WrappedMessageKey.
+func decodeTypedError(key string, raw json.RawMessage, typed error, wrappedMessage any) (error, error) {
+	if err := json.Unmarshal(raw, typed); err != nil {
+		return nil, fmt.Errorf("could not decode %s as %T: %w", key, typed, err)
+	}
+
+	if message, ok := wrappedMessage.(string); ok && message != "" {
+		return &wrappedError{message: message, err: typed}, nil
+	}
+
+	return typed, nil
+}
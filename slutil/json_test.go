@@ -0,0 +1,124 @@
+package slutil
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+type jsonObject struct{}
+
+func (jsonObject) MarshalZerologObject(zle *zerolog.Event) {
+	zle.Str("name", "lemon").Int("count", 48).Strs("tags", []string{"sour", "yellow"})
+}
+
+func TestMarshalObjectJSON(t *testing.T) {
+	marshalled, err := MarshalObjectJSON(jsonObject{})
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"name":"lemon","count":48,"tags":["sour","yellow"]}`, string(marshalled))
+}
+
+func TestJSONObject_Decode(t *testing.T) {
+	var obj JSONObject
+	require.NoError(t, json.Unmarshal([]byte(`{"name":"lemon","count":48,"missing":null}`), &obj))
+
+	name, count, missing := "", 0, "untouched"
+	require.NoError(t, obj.Decode("name", &name))
+	require.NoError(t, obj.Decode("count", &count))
+	require.NoError(t, obj.Decode("missing", &missing))
+	require.NoError(t, obj.Decode("absent", &missing))
+
+	assert.Equal(t, "lemon", name)
+	assert.Equal(t, 48, count)
+	assert.Equal(t, "untouched", missing)
+
+	assert.ErrorContains(t, obj.Decode("name", &count), "could not decode name")
+}
+
+func TestJSONObject_Str(t *testing.T) {
+	obj := JSONObject{"name": json.RawMessage(`"lemon"`), "count": json.RawMessage(`48`)}
+
+	assert.Equal(t, "lemon", obj.Str("name"))
+	assert.Empty(t, obj.Str("count"))
+	assert.Empty(t, obj.Str("missing"))
+}
+
+func TestErrorText(t *testing.T) {
+	assert.Equal(t, "logged", ErrorText(JSONObject{ChainMessageKey: json.RawMessage(`"logged"`)}, &ObjectError{}))
+	assert.Equal(t, `{"code":7}`, ErrorText(JSONObject{}, &ObjectError{Fields: map[string]any{"code": 7}}))
+	assert.Empty(t, ErrorText(JSONObject{}, jsonObject{}))
+
+	FieldLimits = Limits{Message: 4}
+	defer func() { FieldLimits = Limits{} }()
+	assert.Equal(t, "{\"co", ErrorText(JSONObject{}, &ObjectError{Fields: map[string]any{"code": 7}}))
+}
+
+func TestJSONObject_DecodeError(t *testing.T) {
+	var obj JSONObject
+	require.NoError(t, json.Unmarshal([]byte(`{"str":"boom","obj":{"message":"nested","code":7},"empty":"","bad":7}`), &obj))
+
+	var strErr, objErr, emptyErr, missingErr, badErr error
+	require.NoError(t, obj.DecodeError("str", &strErr))
+	require.NoError(t, obj.DecodeError("obj", &objErr))
+	require.NoError(t, obj.DecodeError("empty", &emptyErr))
+	require.NoError(t, obj.DecodeError("missing", &missingErr))
+	assert.Error(t, obj.DecodeError("bad", &badErr))
+
+	assert.EqualError(t, strErr, "boom")
+	assert.EqualError(t, objErr, "nested")
+	assert.Equal(t, float64(7), objErr.(*ObjectError).Fields["code"])
+	assert.Nil(t, emptyErr)
+	assert.Nil(t, missingErr)
+}
+
+type typedError struct {
+	Code int `json:"code"`
+}
+
+func (e *typedError) Error() string {
+	return fmt.Sprintf("typed error %d", e.Code)
+}
+
+func TestMarshalFieldsJSON_TypedInnerError(t *testing.T) {
+	RegisterErrorType(func() error { return &typedError{} })
+
+	t.Run("a wrapped typed error is restored as its type behind the wrapper message", func(t *testing.T) {
+		inner := fmt.Errorf("wrapping: %w", &typedError{Code: 7})
+
+		marshalled, err := MarshalFieldsJSON(map[string]any{"name": "lemon"}, "inner", inner)
+		require.NoError(t, err)
+
+		var obj JSONObject
+		require.NoError(t, json.Unmarshal(marshalled, &obj))
+
+		var decoded error
+		require.NoError(t, obj.DecodeError("inner", &decoded))
+		assert.EqualError(t, decoded, inner.Error())
+
+		var typed *typedError
+		require.True(t, errors.As(decoded, &typed))
+		assert.Equal(t, 7, typed.Code)
+	})
+
+	t.Run("a direct typed error is restored as its type", func(t *testing.T) {
+		marshalled, err := MarshalFieldsJSON(map[string]any{}, "inner", &typedError{Code: 9})
+		require.NoError(t, err)
+
+		var obj JSONObject
+		require.NoError(t, json.Unmarshal(marshalled, &obj))
+
+		var decoded error
+		require.NoError(t, obj.DecodeError("inner", &decoded))
+		assert.Equal(t, &typedError{Code: 9}, decoded)
+	})
+
+	t.Run("errors without a registered type are still encoded as their message", func(t *testing.T) {
+		marshalled, err := MarshalFieldsJSON(map[string]any{}, "inner", fmt.Errorf("wrapping: %w", errors.New("boom")))
+		require.NoError(t, err)
+		assert.JSONEq(t, `{"inner":"wrapping: boom"}`, string(marshalled))
+	})
+}
@@ -0,0 +1,140 @@
+package slutil
+
+import (
+	"github.com/rs/zerolog"
+	"sort"
+	"strconv"
+	"unicode/utf8"
+)
+
+// TruncatedKey is the key of the object holding the original length of every field of an error that was truncated.
+// A chain cut at Limits.ChainDepth ends with a link holding the original number of links under it instead.
+const TruncatedKey = "truncated"
+
+// Limits are the maximum sizes of the fields of logged errors. Zero means unlimited.
+type Limits struct {
+	ChainDepth int // the number of links of the ChainKey array
+	InnerError int // the bytes of the message of an inner error or chain link that does not log its own fields
+	Message    int // the bytes of a message
+	Param      int // the bytes of every request parameter value
+	Query      int // the bytes of a database query
+}
+
+// FieldLimits are applied to every logged APIError and DatabaseError, e.g. to stay below the line limit of a log
+// shipper. Nothing is truncated while it is the zero value, which is the default.
+var FieldLimits Limits
+
+// Truncate returns s cut to at most limit bytes without splitting a UTF-8 encoded character and whether it was cut.
+// A limit of zero or less leaves s unchanged.
+func Truncate(s string, limit int) (string, bool) {
+	if limit <= 0 || len(s) <= limit {
+		return s, false
+	}
+
+	cut := limit
+	for cut > 0 && !utf8.RuneStart(s[cut]) {
+		cut--
+	}
+
+	return s[:cut], true
+}
+
+// LimitMessage returns the top-level message of a line passed through Redaction and truncated to
+// FieldLimits.Message, the way the message of a logged error is.
+func LimitMessage(message string) string {
+	limited, _ := Truncate(RedactText(message), FieldLimits.Message)
+	return limited
+}
+
+// Truncations collects the original length of every field truncated while an error logs its fields.
+type Truncations map[string]int
+
+// Str returns value truncated to limit and records its length under key if it was cut.
+func (t *Truncations) Str(key, value string, limit int) string {
+	return t.cut(key, value, len(value), limit)
+}
+
+// Text returns value passed through Redaction and truncated to limit. The length of value before it was redacted
+// is recorded under key if it was cut.
+func (t *Truncations) Text(key, value string, limit int) string {
+	return t.cut(key, RedactText(value), len(value), limit)
+}
+
+// Params returns params with every value passed through Redaction and truncated to limit, recorded as key.name.
+// The map is not modified.
+func (t *Truncations) Params(key string, params map[string]string, limit int) map[string]string {
+	if params == nil || (Redaction == nil && limit <= 0) {
+		return params
+	}
+
+	res := make(map[string]string, len(params))
+	for name, value := range params {
+		if redacted, ok := redactParam(name, value); ok {
+			res[name] = t.cut(key+"."+name, redacted, len(value), limit)
+		}
+	}
+
+	return res
+}
+
+// MultiParams returns params with every value passed through Redaction and truncated to limit, recorded as
+// key.name[index]. A name is left out once none of its values remain. The map is not modified.
+func (t *Truncations) MultiParams(key string, params map[string][]string, limit int) map[string][]string {
+	if params == nil || (Redaction == nil && limit <= 0) {
+		return params
+	}
+
+	res := make(map[string][]string, len(params))
+	for name, values := range params {
+		var kept []string
+		for i, value := range values {
+			if redacted, ok := redactParam(name, value); ok {
+				kept = append(kept, t.cut(key+"."+name+"["+strconv.Itoa(i)+"]", redacted, len(value), limit))
+			}
+		}
+
+		if len(kept) > 0 {
+			res[name] = kept
+		}
+	}
+
+	return res
+}
+
+// cut truncates value to limit and records length, the length of the value before it was redacted, if it was cut
+func (t *Truncations) cut(key, value string, length, limit int) string {
+	truncated, cut := Truncate(value, limit)
+	if cut {
+		t.record(key, length)
+	}
+
+	return truncated
+}
+
+func (t *Truncations) record(key string, length int) {
+	if *t == nil {
+		*t = make(Truncations)
+	}
+
+	(*t)[key] = length
+}
+
+// MarshalZerologObject logs the original lengths ordered by field name.
+func (t Truncations) MarshalZerologObject(zle *zerolog.Event) {
+	keys := make([]string, 0, len(t))
+	for key := range t {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		zle.Int(key, t[key])
+	}
+}
+
+// AddTruncated adds the TruncatedKey object to zle if any field was truncated.
+func AddTruncated(zle *zerolog.Event, truncated Truncations) {
+	if len(truncated) > 0 {
+		zle.Object(TruncatedKey, truncated)
+	}
+}
@@ -0,0 +1,119 @@
+package slutil
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name      string
+		value     string
+		limit     int
+		expected  string
+		truncated bool
+	}{
+		{name: "unlimited", value: "abcdef", limit: 0, expected: "abcdef"},
+		{name: "within the limit", value: "abc", limit: 3, expected: "abc"},
+		{name: "ascii", value: "abcdef", limit: 4, expected: "abcd", truncated: true},
+		{name: "multi byte character on the limit", value: "aé€b", limit: 4, expected: "aé", truncated: true},
+		{name: "multi byte character after the limit", value: "aé€b", limit: 6, expected: "aé€", truncated: true},
+		{name: "nothing fits", value: "€", limit: 2, expected: "", truncated: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			actual, truncated := Truncate(tt.value, tt.limit)
+			assert.Equal(t, tt.expected, actual)
+			assert.Equal(t, tt.truncated, truncated)
+			assert.True(t, utf8.ValidString(actual))
+		})
+	}
+}
+
+func TestTruncations(t *testing.T) {
+	var truncated Truncations
+
+	assert.Equal(t, "abc", truncated.Str("message", "abc", 5))
+	assert.Nil(t, truncated)
+
+	params := map[string]string{"id": "1", "body": "0123456789"}
+	assert.Equal(t, map[string]string{"id": "1", "body": "0123"}, truncated.Params("pathParams", params, 4))
+	assert.Equal(t, "0123456789", params["body"], "the params are not modified")
+
+	multiParams := map[string][]string{"tag": {"a", "abcdef"}}
+	assert.Equal(t, map[string][]string{"tag": {"a", "abcd"}}, truncated.MultiParams("multiParams", multiParams, 4))
+	assert.Equal(t, multiParams, truncated.MultiParams("multiParams", multiParams, 0))
+
+	assert.Equal(t, "abcd", truncated.Str("message", "abcdef", 4))
+
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	zle := logger.Log()
+	AddTruncated(zle, truncated)
+	zle.Send()
+	assert.Equal(t, `{"truncated":{"message":6,"multiParams.tag[1]":6,"pathParams.body":10}}`+"\n", buf.String())
+}
+
+func TestChain_Limits(t *testing.T) {
+	LogErrorChain = true
+	FieldLimits = Limits{ChainDepth: 2, InnerError: 10}
+	defer func() {
+		LogErrorChain = false
+		FieldLimits = Limits{}
+	}()
+
+	err := fmt.Errorf("first %w", fmt.Errorf("second %w", errors.New(strings.Repeat("x", 20))))
+	chain := logChainItem(t, err)[ChainKey].([]any)
+
+	assert.Len(t, chain, 3)
+	assert.Equal(t, "first seco", chain[0].(map[string]any)[ChainMessageKey])
+	assert.Equal(t, map[string]any{ChainMessageKey: float64(33)}, chain[0].(map[string]any)[TruncatedKey])
+	assert.Equal(t, map[string]any{TruncatedKey: float64(3)}, chain[2])
+}
+
+// maskRedactor replaces every "secret" with a longer mask and drops the "drop" parameter
+type maskRedactor struct{}
+
+func (maskRedactor) RedactParam(key, value string) (string, bool) {
+	return maskRedactor{}.RedactText(value), key != "drop"
+}
+
+func (maskRedactor) RedactText(text string) string {
+	return strings.ReplaceAll(text, "secret", "[REDACTED]")
+}
+
+func TestTruncations_Redaction(t *testing.T) {
+	Redaction = maskRedactor{}
+	defer func() { Redaction = nil }()
+
+	var truncated Truncations
+
+	// the original lengths are recorded, not those of the redacted values
+	assert.Equal(t, "a [RED", truncated.Text("message", "a secret", 6))
+	assert.Equal(t, map[string]string{"token": "[RED"}, truncated.Params("pathParams", map[string]string{"drop": "x", "token": "secret"}, 4))
+	assert.Equal(t, map[string][]string{"tag": {"a", "[RED"}}, truncated.MultiParams("multiParams", map[string][]string{"drop": {"x"}, "tag": {"a", "secret"}}, 4))
+	assert.Equal(t, Truncations{"message": 8, "multiParams.tag[1]": 6, "pathParams.token": 6}, truncated)
+
+	// redaction applies without limits
+	assert.Equal(t, map[string]string{"token": "[REDACTED]"}, truncated.Params("queryParams", map[string]string{"drop": "x", "token": "secret"}, 0))
+}
+
+func TestLimitMessage(t *testing.T) {
+	assert.Equal(t, "a secret", LimitMessage("a secret"))
+
+	Redaction = maskRedactor{}
+	FieldLimits = Limits{Message: 6}
+	defer func() {
+		Redaction = nil
+		FieldLimits = Limits{}
+	}()
+
+	assert.Equal(t, "a [RED", LimitMessage("a secret"))
+}
@@ -0,0 +1,64 @@
+package slutil
+
+import "github.com/rs/zerolog"
+
+// LogMode controls when the slapi and sldb Log* constructors write errors to the log.
+type LogMode int
+
+const (
+	// LogModeEager logs every error as soon as it is constructed by a Log* function. This is the default.
+	LogModeEager LogMode = iota
+	// LogModeBoundary only builds errors in the Log* functions. Errors are written once at the outermost
+	// boundary (slapi.Handler or an explicit slapi.LogFinal) together with their whole chain.
+	LogModeBoundary
+)
+
+// Mode is the LogMode used by the slapi and sldb Log* constructors
+var Mode = LogModeEager
+
+// Loggable is an error that knows how to log itself to zerolog.
+type Loggable interface {
+	error
+	zerolog.LogObjectMarshaler
+}
+
+// LogTracker is implemented by errors that remember whether they have already been logged.
+type LogTracker interface {
+	Logged() bool
+	MarkLogged()
+}
+
+// ShouldLogEagerly reports whether the Log* constructors should log immediately.
+func ShouldLogEagerly() bool {
+	return Mode == LogModeEager
+}
+
+// ShouldLogChain reports whether errors should emit their wrapped error chain. The chain is always
+// included in LogModeBoundary because the boundary log line is the only one written for an error.
+func ShouldLogChain() bool {
+	return LogErrorChain || Mode == LogModeBoundary
+}
+
+// MarkLogged marks err and every error it wraps that implements LogTracker as logged.
+func MarkLogged(err error) {
+	Walk(err, func(current error, _ int) bool {
+		if tracker, ok := current.(LogTracker); ok {
+			tracker.MarkLogged()
+		}
+		return true
+	})
+}
+
+// IsLogged reports whether the outermost LogTracker in the error tree of err has already been logged.
+func IsLogged(err error) bool {
+	var logged bool
+	Walk(err, func(current error, _ int) bool {
+		tracker, ok := current.(LogTracker)
+		if ok {
+			logged = tracker.Logged()
+		}
+		return !ok
+	})
+
+	return logged
+}
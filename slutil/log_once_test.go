@@ -0,0 +1,64 @@
+package slutil
+
+import (
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+type trackedError struct {
+	inner  error
+	logged bool
+}
+
+func (e *trackedError) Error() string {
+	return "tracked error"
+}
+
+func (e *trackedError) Unwrap() error {
+	return e.inner
+}
+
+func (e *trackedError) Logged() bool {
+	return e.logged
+}
+
+func (e *trackedError) MarkLogged() {
+	e.logged = true
+}
+
+func TestMarkLogged(t *testing.T) {
+	inner := &trackedError{}
+	sibling := &trackedError{}
+	outer := &trackedError{inner: errors.Join(fmt.Errorf("wrapping %w", inner), sibling)}
+
+	assert.False(t, IsLogged(outer))
+	assert.False(t, IsLogged(errors.New("plain")))
+
+	MarkLogged(fmt.Errorf("wrapping %w", outer))
+
+	assert.True(t, IsLogged(outer))
+	assert.True(t, inner.Logged())
+	assert.True(t, sibling.Logged())
+}
+
+func TestIsLogged(t *testing.T) {
+	inner := &trackedError{logged: true}
+	outer := &trackedError{inner: inner}
+
+	// only the outermost tracker decides whether the tree was logged
+	assert.False(t, IsLogged(outer))
+	assert.True(t, IsLogged(fmt.Errorf("wrapping %w", inner)))
+}
+
+func TestShouldLogChain(t *testing.T) {
+	defer func() { Mode = LogModeEager }()
+
+	assert.True(t, ShouldLogEagerly())
+	assert.False(t, ShouldLogChain())
+
+	Mode = LogModeBoundary
+	assert.False(t, ShouldLogEagerly())
+	assert.True(t, ShouldLogChain())
+}
@@ -0,0 +1,72 @@
+package slutil
+
+import (
+	"github.com/rs/zerolog"
+)
+
+// Redactor rewrites sensitive values before they are logged. See the slredact package for a configurable
+// implementation.
+type Redactor interface {
+	// RedactParam returns the value to log for the request parameter key or false to leave the parameter out.
+	RedactParam(key, value string) (string, bool)
+
+	// RedactText returns text with every sensitive value it contains replaced.
+	RedactText(text string) string
+}
+
+// Redaction is applied to request parameters, messages, inner error messages and queries of every logged error.
+// Nothing is redacted while it is nil, which is the default.
+var Redaction Redactor
+
+// RedactText applies Redaction to text.
+func RedactText(text string) string {
+	if Redaction == nil || text == "" {
+		return text
+	}
+
+	return Redaction.RedactText(text)
+}
+
+// redactParam applies Redaction to the value of the request parameter key
+func redactParam(key, value string) (string, bool) {
+	if Redaction == nil {
+		return value, true
+	}
+
+	return Redaction.RedactParam(key, value)
+}
+
+// AddInnerError logs err under key the way zerolog's AnErr does, with the message of errors that do not log
+// their own fields passed through Redaction and truncated to FieldLimits.InnerError.
+func AddInnerError(zle *zerolog.Event, key string, err error, truncated *Truncations) {
+	if err == nil {
+		return
+	}
+
+	if _, ok := err.(zerolog.LogObjectMarshaler); ok {
+		zle.AnErr(key, err)
+		return
+	}
+
+	zle.Str(key, truncated.Text(key, err.Error(), FieldLimits.InnerError))
+}
+
+// FieldEncrypter encrypts the values of selected identifier fields before they are logged. See the slcrypt package
+// for an AES-GCM implementation.
+type FieldEncrypter interface {
+	// EncryptField returns the value to log for the field logged under key.
+	EncryptField(key, value string) string
+}
+
+// Encryption is applied to the caller and owner fields of every logged APIError. Nothing is encrypted while it is
+// nil, which is the default.
+var Encryption FieldEncrypter
+
+// EncryptField applies Encryption to the value of the field logged under key.
+func EncryptField(key, value string) string {
+	if Encryption == nil || value == "" {
+		return value
+	}
+
+	return Encryption.EncryptField(key, value)
+}
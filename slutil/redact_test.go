@@ -0,0 +1,65 @@
+package slutil
+
+import (
+	"bytes"
+	"errors"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"strings"
+	"testing"
+)
+
+// upperRedactor drops the "drop" parameter and upper cases everything else
+type upperRedactor struct{}
+
+func (upperRedactor) RedactParam(key, value string) (string, bool) {
+	return strings.ToUpper(value), key != "drop"
+}
+
+func (upperRedactor) RedactText(text string) string {
+	return strings.ToUpper(text)
+}
+
+func TestRedaction(t *testing.T) {
+	params := map[string]string{"drop": "a", "keep": "b"}
+	multiParams := map[string][]string{"drop": {"a"}, "keep": {"b", "c"}}
+
+	var truncated Truncations
+	assert.Equal(t, params, truncated.Params("pathParams", params, 0), "nothing is redacted without a Redactor")
+	assert.Equal(t, "text", RedactText("text"))
+
+	Redaction = upperRedactor{}
+	defer func() { Redaction = nil }()
+
+	assert.Equal(t, map[string]string{"keep": "B"}, truncated.Params("pathParams", params, 0))
+	assert.Equal(t, map[string][]string{"keep": {"B", "C"}}, truncated.MultiParams("multiParams", multiParams, 0))
+	assert.Nil(t, truncated.Params("pathParams", nil, 0))
+	assert.Equal(t, "TEXT", RedactText("text"))
+	assert.Equal(t, "a", params["drop"], "the params are not modified")
+
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+	zle := logger.Log()
+	AddInnerError(zle, "inner", errors.New("secret"), &truncated)
+	AddInnerError(zle, "missing", nil, &truncated)
+	zle.Send()
+	assert.Equal(t, `{"inner":"SECRET"}`+"\n", buf.String())
+	assert.Empty(t, truncated)
+}
+
+// prefixEncrypter prefixes the values of every field with the name of the field
+type prefixEncrypter struct{}
+
+func (prefixEncrypter) EncryptField(key, value string) string {
+	return key + ":" + value
+}
+
+func TestEncryptField(t *testing.T) {
+	assert.Equal(t, "user-1", EncryptField("ownerId", "user-1"), "nothing is encrypted without a FieldEncrypter")
+
+	Encryption = prefixEncrypter{}
+	defer func() { Encryption = nil }()
+
+	assert.Equal(t, "ownerId:user-1", EncryptField("ownerId", "user-1"))
+	assert.Equal(t, "", EncryptField("ownerId", ""), "empty values stay empty")
+}
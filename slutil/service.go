@@ -0,0 +1,129 @@
+package slutil
+
+import (
+	"github.com/rs/zerolog"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime/debug"
+	"sync/atomic"
+)
+
+// ServiceKey is the key the ServiceInfo set with SetServiceInfo is logged under in every error object
+const ServiceKey = "service"
+
+const ServiceCommitKey = "commit"
+const ServiceEnvironmentKey = "environment"
+const ServiceHostKey = "host"
+const ServiceNameKey = "name"
+const ServicePIDKey = "pid"
+const ServiceVersionKey = "version"
+
+// The environment variables DetectServiceInfo reads.
+const EnvServiceCommit = "SERVICE_COMMIT"
+const EnvServiceEnvironment = "SERVICE_ENVIRONMENT"
+const EnvServiceName = "SERVICE_NAME"
+const EnvServiceVersion = "SERVICE_VERSION"
+
+// ServiceInfo describes the process that logged an error.
+type ServiceInfo struct {
+	Commit      string `json:"commit"`
+	Environment string `json:"environment"`
+	Host        string `json:"host"`
+	Name        string `json:"name"`
+	PID         int    `json:"pid"`
+	Version     string `json:"version"`
+}
+
+var serviceInfo atomic.Pointer[ServiceInfo]
+
+// SetServiceInfo adds info under ServiceKey to every error logged from now on, with the fields left empty filled in
+// by DetectServiceInfo. It is meant to be called once at startup. No service is logged until it is called.
+func SetServiceInfo(info ServiceInfo) {
+	detected := DetectServiceInfo()
+
+	if info.Commit == "" {
+		info.Commit = detected.Commit
+	}
+	if info.Environment == "" {
+		info.Environment = detected.Environment
+	}
+	if info.Host == "" {
+		info.Host = detected.Host
+	}
+	if info.Name == "" {
+		info.Name = detected.Name
+	}
+	if info.PID == 0 {
+		info.PID = detected.PID
+	}
+	if info.Version == "" {
+		info.Version = detected.Version
+	}
+
+	serviceInfo.Store(&info)
+}
+
+// ClearServiceInfo stops logging the ServiceInfo set with SetServiceInfo.
+func ClearServiceInfo() {
+	serviceInfo.Store(nil)
+}
+
+// CurrentServiceInfo returns the ServiceInfo set with SetServiceInfo or nil if none is set.
+func CurrentServiceInfo() *ServiceInfo {
+	return serviceInfo.Load()
+}
+
+// DetectServiceInfo describes the running process from the environment variables, the build info embedded by the Go
+// toolchain and the operating system. The environment variables take precedence over the build info.
+func DetectServiceInfo() ServiceInfo {
+	info := ServiceInfo{
+		Commit:      os.Getenv(EnvServiceCommit),
+		Environment: os.Getenv(EnvServiceEnvironment),
+		Name:        os.Getenv(EnvServiceName),
+		PID:         os.Getpid(),
+		Version:     os.Getenv(EnvServiceVersion),
+	}
+
+	info.Host, _ = os.Hostname()
+
+	if buildInfo, ok := debug.ReadBuildInfo(); ok {
+		if info.Name == "" && buildInfo.Path != "" {
+			info.Name = path.Base(buildInfo.Path)
+		}
+
+		if info.Version == "" && buildInfo.Main.Version != "(devel)" {
+			info.Version = buildInfo.Main.Version
+		}
+
+		for _, setting := range buildInfo.Settings {
+			if setting.Key == "vcs.revision" && info.Commit == "" {
+				info.Commit = setting.Value
+			}
+		}
+	}
+
+	if info.Name == "" && len(os.Args) > 0 {
+		info.Name = filepath.Base(os.Args[0])
+	}
+
+	return info
+}
+
+// MarshalZerologObject logs every field of ServiceInfo.
+func (s *ServiceInfo) MarshalZerologObject(zle *zerolog.Event) {
+	zle.
+		Int(ServicePIDKey, s.PID).
+		Str(ServiceCommitKey, s.Commit).
+		Str(ServiceEnvironmentKey, s.Environment).
+		Str(ServiceHostKey, s.Host).
+		Str(ServiceNameKey, s.Name).
+		Str(ServiceVersionKey, s.Version)
+}
+
+// AddService adds the ServiceInfo set with SetServiceInfo under ServiceKey to zle if one is set.
+func AddService(zle *zerolog.Event) {
+	if info := serviceInfo.Load(); info != nil {
+		zle.Object(ServiceKey, info)
+	}
+}
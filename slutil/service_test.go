@@ -0,0 +1,62 @@
+package slutil
+
+import (
+	"bytes"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"testing"
+)
+
+func TestDetectServiceInfo(t *testing.T) {
+	t.Setenv(EnvServiceCommit, "abc123")
+	t.Setenv(EnvServiceEnvironment, "staging")
+	t.Setenv(EnvServiceName, "billing")
+	t.Setenv(EnvServiceVersion, "v1.2.3")
+
+	hostname, err := os.Hostname()
+	require.NoError(t, err)
+
+	assert.Equal(t, ServiceInfo{
+		Commit:      "abc123",
+		Environment: "staging",
+		Host:        hostname,
+		Name:        "billing",
+		PID:         os.Getpid(),
+		Version:     "v1.2.3",
+	}, DetectServiceInfo())
+
+	t.Setenv(EnvServiceName, "")
+	assert.NotEmpty(t, DetectServiceInfo().Name, "the name falls back to the build info or the executable")
+}
+
+func TestSetServiceInfo(t *testing.T) {
+	t.Setenv(EnvServiceEnvironment, "production")
+	defer ClearServiceInfo()
+
+	var buf bytes.Buffer
+	logger := zerolog.New(&buf)
+
+	logService := func() {
+		buf.Reset()
+		zle := logger.Log()
+		AddService(zle)
+		zle.Send()
+	}
+
+	logService()
+	assert.Equal(t, "{}\n", buf.String(), "nothing is logged before SetServiceInfo")
+	assert.Nil(t, CurrentServiceInfo())
+
+	SetServiceInfo(ServiceInfo{Commit: "abc123", Host: "web-1", Name: "billing", PID: 42, Version: "v1.2.3"})
+	require.NotNil(t, CurrentServiceInfo())
+	assert.Equal(t, "production", CurrentServiceInfo().Environment, "empty fields are detected")
+
+	logService()
+	assert.Equal(t, `{"service":{"pid":42,"commit":"abc123","environment":"production","host":"web-1","name":"billing","version":"v1.2.3"}}`+"\n", buf.String())
+
+	ClearServiceInfo()
+	logService()
+	assert.Equal(t, "{}\n", buf.String())
+}